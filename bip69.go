@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+//SortBIP69 创建交易时是否按BIP69排序input和output（避免通过output顺序推断找零）
+var SortBIP69 = false
+
+//BIP69 按字典序排序input和output：必须在计算交易ID和签名之前调用
+//input按引用的交易ID、索引值排序；output按金额、锁定脚本类型、锁定脚本数据排序
+func (tx *Transaction) BIP69() {
+	sort.SliceStable(tx.TXInputs, func(i, j int) bool {
+		a, b := tx.TXInputs[i], tx.TXInputs[j]
+		if c := bytes.Compare(a.TXID, b.TXID); c != 0 {
+			return c < 0
+		}
+		return a.Index < b.Index
+	})
+	sort.SliceStable(tx.TXOutputs, func(i, j int) bool {
+		a, b := tx.TXOutputs[i], tx.TXOutputs[j]
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		if a.ScriptType != b.ScriptType {
+			return a.ScriptType < b.ScriptType
+		}
+		return bytes.Compare(a.ScriptPubKeyHash, b.ScriptPubKeyHash) < 0
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBIP69Ordering(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	fund := fundTestOutputs(t, bc, w, []int64{100000, 200000})
+	//input按相反的顺序给出，找零金额小于收款金额
+	spentUTXO := map[string][]int64{string(fund.TXID): {1, 0}}
+	const amount, fee = 250000, 1000
+
+	tx, err := buildTransaction(w, address, payee, amount, fee, spentUTXO, 300000, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TXOutputs[0].Value != amount {
+		t.Fatal("不排序时收款output应在找零之前")
+	}
+
+	defer func(sort bool) { SortBIP69 = sort }(SortBIP69)
+	SortBIP69 = true
+	tx, err = buildTransaction(w, address, payee, amount, fee, spentUTXO, 300000, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TXInputs[0].Index != 0 || tx.TXInputs[1].Index != 1 {
+		t.Fatalf("input顺序为%d,%d，期望0,1", tx.TXInputs[0].Index, tx.TXInputs[1].Index)
+	}
+	if tx.TXOutputs[0].Value != 300000-amount-fee || tx.TXOutputs[1].Value != amount {
+		t.Fatalf("output金额顺序为%d,%d，期望按金额排序", tx.TXOutputs[0].Value, tx.TXOutputs[1].Value)
+	}
+	//排序在计算交易ID和签名之前
+	if !bc.VerifyTransaction(tx) {
+		t.Fatal("排序后的交易校验失败")
+	}
+	if err := bc.VerifyTransactionAgainstChain(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBIP69Canonical(t *testing.T) {
+	a, b := bytes.Repeat([]byte{0x0a}, 32), bytes.Repeat([]byte{0x0b}, 32)
+	tx := &Transaction{
+		TXInputs: []TXInput{{TXID: b, Index: 0}, {TXID: a, Index: 2}, {TXID: a, Index: 1}},
+		TXOutputs: []TXOutput{
+			{Value: 2000, ScriptPubKeyHash: []byte{0x01}},
+			{Value: 1000, ScriptPubKeyHash: []byte{0x02}},
+			{Value: 1000, ScriptPubKeyHash: []byte{0x01}},
+		},
+	}
+	tx.BIP69()
+
+	wantInputs := []TXInput{{TXID: a, Index: 1}, {TXID: a, Index: 2}, {TXID: b, Index: 0}}
+	for i, input := range tx.TXInputs {
+		if !bytes.Equal(input.TXID, wantInputs[i].TXID) || input.Index != wantInputs[i].Index {
+			t.Fatalf("第%d个input为%x:%d，期望%x:%d", i, input.TXID, input.Index, wantInputs[i].TXID, wantInputs[i].Index)
+		}
+	}
+	wantOutputs := []TXOutput{
+		{Value: 1000, ScriptPubKeyHash: []byte{0x01}},
+		{Value: 1000, ScriptPubKeyHash: []byte{0x02}},
+		{Value: 2000, ScriptPubKeyHash: []byte{0x01}},
+	}
+	for i, output := range tx.TXOutputs {
+		if output.Value != wantOutputs[i].Value || !bytes.Equal(output.ScriptPubKeyHash, wantOutputs[i].ScriptPubKeyHash) {
+			t.Fatalf("第%d个output为%+v，期望%+v", i, output, wantOutputs[i])
+		}
+	}
+}
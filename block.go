@@ -2,9 +2,7 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/gob"
-	"fmt"
 	"time"
 )
 
@@ -17,11 +15,12 @@ type Block struct {
 	Bits         uint64         //调整比特币挖矿难度的数值（用于计算哈希）
 	Nonce        uint64         //随机数（挖矿时寻找的数值）
 	Hash         []byte         //当前区块哈希值
+	Height       uint64         //区块高度（创世块为0）
 	Transactions []*Transaction //区块数据：区块的交易集合
 }
 
-//NewBlock 创建一个区块(传入交易和前区块的哈希)
-func NewBlock(txs []*Transaction, prevHash []byte) *Block {
+//NewBlock 创建一个区块(传入交易、前区块的哈希和区块高度)
+func NewBlock(txs []*Transaction, prevHash []byte, height uint64) *Block {
 	b := Block{
 		Version:      0,
 		PrevHash:     prevHash,
@@ -30,6 +29,7 @@ func NewBlock(txs []*Transaction, prevHash []byte) *Block {
 		Bits:         0,
 		Nonce:        0,
 		Hash:         nil,
+		Height:       height,
 		Transactions: txs,
 	}
 	//填充梅克尔根值
@@ -54,7 +54,7 @@ func (b *Block) Serialize() []byte {
 	//编码
 	err := encoder.Encode(b)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil
 	}
 	//得字节流
@@ -74,26 +74,19 @@ func DeSerialize(data []byte) *Block {
 	//解码
 	err := decoder.Decode(&block)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil
 	}
 
 	return &block
 }
 
-//HashTransactionMerkleRoot 简易的梅克尔根，把所有交易拼接后计算哈希值
+//HashTransactionMerkleRoot 计算区块交易的梅克尔根
 func (b *Block) HashTransactionMerkleRoot() {
+	b.MerkleRoot = NewMerkleTree(b.txids()).Root()
+}
 
-	var info [][]byte
-	//遍历所有交易并计算哈希值
-	for _, tx := range b.Transactions {
-		//将所有的哈希值拼接后再计算哈希值
-		txHash := tx.TXID
-		info = append(info, txHash)
-	}
-	//拼接字符切片
-	value := bytes.Join(info, []byte{})
-	hash := sha256.Sum256(value)
-	//将最终的哈希值赋值给MerKleRoot
-	b.MerkleRoot = hash[:]
+//区块时间（Unix时间，秒）
+func (b *Block) unixTime() uint64 {
+	return b.TimeStamp / uint64(time.Second)
 }
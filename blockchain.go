@@ -2,18 +2,34 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
+	"crypto"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
 
+/*
+	并发访问：
+		BlockChain.mux保护tail、UTXO集合和交易池，UTXOSet和Mempool没有自己的锁
+		导出的方法自行加锁（读操作加读锁，修改操作加写锁），未导出的方法要求调用者已持有锁，
+		持有锁时只能调用未导出的方法或不访问上述状态的方法（如FindTransaction、GetBlock只读取数据库）
+		加锁顺序：Node.mux -> BlockChain.mux，持有BlockChain.mux时不能再获取其他锁（发送事件时获取的订阅者锁除外）
+*/
+
 //BlockChain 区块链
 type BlockChain struct {
 	// Blocks []*Block
-	db   *bolt.DB //用于存储数据的数据库
-	tail []byte   //最后一个区块的哈希值
+	db      *bolt.DB     //用于存储数据的数据库
+	mux     sync.RWMutex //保护tail、utxoSet和mempool
+	tail    []byte       //最后一个区块的哈希值
+	utxoSet *UTXOSet     //UTXO集合缓存
+	mempool *Mempool     //交易池
+	events  eventFeed    //事件订阅者
+	params  ChainParams  //共识参数
 }
 
 //创世语
@@ -28,8 +44,16 @@ const blockBucket = "blockBucket"
 //数据桶中保存最后一个区块哈希值的字段key
 const lastBlockHashKey = "lastBlockHashKey"
 
-//CreateBlockChain 创建区块链（同时添加创世块）
+//交易索引数据桶：key为交易ID，value为区块高度(8字节)+区块哈希
+const txIndexBucket = "txIndexBucket"
+
+//CreateBlockChain 使用默认共识参数创建区块链（同时添加创世块）
 func CreateBlockChain(address string) error {
+	return CreateBlockChainWithParams(address, DefaultChainParams())
+}
+
+//CreateBlockChainWithParams 使用指定的共识参数创建区块链（创世块的挖矿奖励由参数决定）
+func CreateBlockChainWithParams(address string, params ChainParams) error {
 
 	//判断区块链是否存在
 	if IsFileExist(blockChainDBFile) {
@@ -39,7 +63,7 @@ func CreateBlockChain(address string) error {
 	//打开数据库，没有则创建
 	db, err := bolt.Open(blockChainDBFile, 0600, nil)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return err
 	}
 	defer db.Close()
@@ -56,18 +80,25 @@ func CreateBlockChain(address string) error {
 				return err
 			}
 			//创建挖矿交易
-			coinbase := NewCoinbaseTX(address, genesisInfo)
+			coinbase := newCoinbaseTX(address, genesisInfo, 0, params.BlockReward(0))
+			if coinbase == nil {
+				return errors.New("创建挖矿交易失败")
+			}
 			//拼装交易集合txs
 			txs := []*Transaction{coinbase}
 			//新建创世快
-			genesisBlock := NewBlock(txs, nil)
+			genesisBlock := NewBlock(txs, nil, 0)
 			//将区块数据流写入数据库（key为区块的哈希，value为区块的数据流）
 			bucket.Put(genesisBlock.Hash, genesisBlock.Serialize())
 			//将最后一个区块的哈希写入数据库（key为lastBlockHash,value为创世块的哈希）
 			bucket.Put([]byte(lastBlockHashKey), genesisBlock.Hash)
-			fmt.Println("创建区块链成功")
+			//写入交易索引
+			if err := putTxIndex(tx, genesisBlock, 0); err != nil {
+				return err
+			}
+			logger.Info("创建区块链成功")
 		} else {
-			fmt.Println("区块链已存在")
+			logger.Info("区块链已存在")
 		}
 
 		return nil
@@ -75,8 +106,13 @@ func CreateBlockChain(address string) error {
 	return err
 }
 
-//GetBlockChainInstance 获取区块链实例
+//GetBlockChainInstance 使用默认共识参数获取区块链实例
 func GetBlockChainInstance() (*BlockChain, error) {
+	return GetBlockChainInstanceWithParams(DefaultChainParams())
+}
+
+//GetBlockChainInstanceWithParams 使用指定的共识参数获取区块链实例
+func GetBlockChainInstanceWithParams(params ChainParams) (*BlockChain, error) {
 	//判断区块链是否存在
 	if !IsFileExist(blockChainDBFile) {
 		return nil, errors.New("区块链文件不存在")
@@ -88,7 +124,7 @@ func GetBlockChainInstance() (*BlockChain, error) {
 	//打开数据库
 	db, err := bolt.Open(blockChainDBFile, 0600, nil)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil, err
 	}
 	//不关闭数据库
@@ -105,29 +141,220 @@ func GetBlockChainInstance() (*BlockChain, error) {
 		return nil
 	})
 
+	//从磁盘加载UTXO集合
+	utxoSet, err := LoadUTXOSet(utxoSetFile)
+	if err != nil {
+		utxoSet = NewUTXOSet()
+	}
+
 	//返回区块链实例
-	bc := BlockChain{db, lastHash}
+	bc := BlockChain{db: db, tail: lastHash, utxoSet: utxoSet, params: params}
+	bc.mempool = NewMempool(&bc)
+
+	//交易索引不存在（旧版本创建的区块链），遍历账本构建
+	var hasTxIndex bool
+	db.View(func(tx *bolt.Tx) error {
+		hasTxIndex = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	if !hasTxIndex {
+		logger.Info("构建交易索引")
+		if err := bc.RebuildTxIndex(); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	//UTXO集合不存在或已过期（最后一个区块哈希不一致），遍历账本重新构建
+	if !bytes.Equal(utxoSet.tip, lastHash) {
+		if bc.prunedHeight() != 0 {
+			db.Close()
+			return nil, errors.New("区块链已裁剪，无法重建UTXO集合")
+		}
+		logger.Info("重建UTXO集合")
+		if err := utxoSet.Reindex(&bc); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if err := utxoSet.Save(utxoSetFile); err != nil {
+			logger.Error(err)
+		}
+	}
 	return &bc, nil
 }
 
 //AddBlock 向区块链中添加区块的方法（传入数据：交易集合）
 func (bc *BlockChain) AddBlock(txs0 []*Transaction) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.addBlock(txs0)
+}
+
+func (bc *BlockChain) addBlock(txs0 []*Transaction) error {
+	//获取最后一个区块的哈希
+	lastBlockHash := bc.tail
+	//获取最后一个区块的高度
+	height, err := bc.height()
+	if err != nil {
+		return err
+	}
+
 	//有效的交易集合
 	txs := []*Transaction{}
 
-	//校验交易签名
+	//按顺序校验交易，跳过无效的交易：区块内排在前面的有效交易的output可以被后面的交易使用（CPFP）
+	now := uint64(time.Now().Unix())
+	inBlockTXs := make(map[string]*Transaction)
+	spent := make(map[string]bool)
 	for _, tx := range txs0 {
-		if bc.VerifyTransaction(tx) {
-			txs = append(txs, tx)
+		if err := bc.checkCandidateTx(tx, height+1, now, inBlockTXs, spent); err != nil {
+			logger.Warn(err)
+			continue
+		}
+		txs = append(txs, tx)
+		inBlockTXs[string(tx.TXID)] = tx
+		if !tx.isCoinBaseTX() {
+			for _, input := range tx.TXInputs {
+				spent[outpointKey(input.TXID, input.Index)] = true
+			}
 		}
 	}
 
-	//获取最后一个区块的哈希
-	lastBlockHash := bc.tail
-
 	//创建一个新区块
-	newBlock := NewBlock(txs, lastBlockHash)
+	newBlock := NewBlock(txs, lastBlockHash, height+1)
+
+	//与其他节点的区块使用相同的共识校验（UTXO、双花、挖矿奖励等）
+	if err := bc.verifyBlock(newBlock); err != nil {
+		return err
+	}
+
+	//区块上链
+	return bc.connectBlock(newBlock)
+}
+
+//校验待打包进高度height的区块的交易：交易结构、交易ID、锁定时间、签名、挖矿交易output的成熟度和金额，
+//引用的output必须在UTXO集合中或由区块内已选中的交易inBlockTXs创建，且未被已选中的交易使用（spent）
+func (bc *BlockChain) checkCandidateTx(tx *Transaction, height, now uint64, inBlockTXs map[string]*Transaction, spent map[string]bool) error {
+	if err := tx.CheckSanity(); err != nil {
+		return err
+	}
+	if err := tx.checkTXID(); err != nil {
+		return fmt.Errorf("交易%x: %v", tx.TXID, err)
+	}
+	if !tx.IsFinal(height, now) {
+		return fmt.Errorf("交易%x未到锁定时间", tx.TXID)
+	}
+	if tx.isCoinBaseTX() {
+		return bc.ValidateTxBalance(tx)
+	}
+
+	prevTXs := make(map[string]*Transaction)
+	for _, input := range tx.TXInputs {
+		key := outpointKey(input.TXID, input.Index)
+		if spent[key] {
+			return fmt.Errorf("交易%x引用的output %s已被区块内的交易使用", tx.TXID, key)
+		}
+		//区块内已选中的交易
+		if prevTX, ok := inBlockTXs[string(input.TXID)]; ok {
+			if err := checkOutputIndex(input, prevTX); err != nil {
+				return err
+			}
+			if !prevTX.TXOutputs[input.Index].isSpendable() {
+				return fmt.Errorf("交易%x引用的output %s不可花费", tx.TXID, key)
+			}
+			prevTXs[string(input.TXID)] = prevTX
+			continue
+		}
+		//UTXO集合
+		if _, ok := bc.utxoSet.utxos[key]; !ok {
+			return fmt.Errorf("交易%x引用的output %s不存在或已被消耗", tx.TXID, key)
+		}
+		prevTX, err := bc.FindTransaction(input.TXID)
+		if err != nil {
+			return err
+		}
+		prevTXs[string(input.TXID)] = prevTX
+	}
+	if !tx.Verify(prevTXs) {
+		return fmt.Errorf("交易%x签名校验失败", tx.TXID)
+	}
+	if err := bc.checkCoinbaseMaturity(tx, prevTXs, height); err != nil {
+		return fmt.Errorf("交易%x: %v", tx.TXID, err)
+	}
+	_, err := checkTxBalance(tx, prevTXs)
+	return err
+}
+
+//AcceptBlock 接收其他节点挖出的区块
+//区块连接在最后一个区块之后时直接上链；连接在其他区块之后时保存为分叉，分叉累计工作量更大时进行链重组
+func (bc *BlockChain) AcceptBlock(block *Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	//已存在的区块
+	if bc.GetBlock(block.Hash) != nil {
+		return nil
+	}
+	//前区块必须存在
+	prevBlock := bc.GetBlock(block.PrevHash)
+	if prevBlock == nil {
+		return errors.New("前区块不存在")
+	}
+	if block.Height != prevBlock.Height+1 {
+		return errors.New("区块高度无效")
+	}
+	//区块大小
+	if len(block.Serialize()) > bc.params.MaxBlockSize {
+		return errors.New("区块过大")
+	}
+	//校验工作量证明
+	if !NewProofOfWork(block).IsValid() {
+		return errors.New("区块工作量证明无效")
+	}
+	//校验区块哈希
+	if !bytes.Equal(block.Hash, block.computeHash()) {
+		return errors.New("区块哈希无效")
+	}
+	//校验梅克尔根
+	merkleRoot := block.MerkleRoot
+	block.HashTransactionMerkleRoot()
+	if !bytes.Equal(merkleRoot, block.MerkleRoot) {
+		block.MerkleRoot = merkleRoot
+		return errors.New("区块梅克尔根无效")
+	}
+
+	//分叉：保存区块，累计工作量更大时切换到该分叉
+	if !bytes.Equal(block.PrevHash, bc.tail) {
+		return bc.acceptForkBlock(block)
+	}
 
+	//校验区块
+	err := bc.verifyBlock(block)
+	if err != nil {
+		return err
+	}
+
+	return bc.connectBlock(block)
+}
+
+//GetBlock 根据区块哈希获取区块
+func (bc *BlockChain) GetBlock(hash []byte) *Block {
+	var block *Block
+	bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket == nil {
+			return errors.New("No bucket")
+		}
+		data := bucket.Get(hash)
+		if data != nil {
+			block = DeSerialize(data)
+		}
+		return nil
+	})
+	return block
+}
+
+//将区块写入数据库并更新交易索引、交易池和UTXO集合
+func (bc *BlockChain) connectBlock(newBlock *Block) error {
 	//写入数据库
 	err := bc.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(blockBucket))
@@ -144,11 +371,27 @@ func (bc *BlockChain) AddBlock(txs0 []*Transaction) error {
 		if err != nil {
 			return err
 		}
+		//更新交易索引
+		err = putTxIndex(tx, newBlock, newBlock.Height)
+		if err != nil {
+			return err
+		}
 		//更新区块链的tali值（最后一个区块的哈希值）
 		bc.tail = newBlock.Hash
-		fmt.Println("添加区块成功")
+		logger.Info("添加区块成功")
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	//从交易池移除已打包的交易
+	bc.mempool.removeBlockTransactions(newBlock)
+	//每个区块上链时清理交易池中过期的交易
+	bc.mempool.expireOld(time.Now())
+	//更新UTXO集合并保存
+	bc.utxoSet.Update(newBlock)
+	err = bc.utxoSet.Save(utxoSetFile)
+	bc.events.send(ChainEvent{Type: EventNewBlock, Block: newBlock})
 	return err
 }
 
@@ -160,6 +403,12 @@ type Iterator struct {
 
 //NewIterator 初始化迭代器的方法
 func (bc *BlockChain) NewIterator() *Iterator {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.newIterator()
+}
+
+func (bc *BlockChain) newIterator() *Iterator {
 	it := Iterator{
 		db:          bc.db,
 		currentHash: bc.tail, //最后一个区块的哈希值
@@ -177,14 +426,20 @@ func (it *Iterator) Next() (block *Block) {
 		}
 		//获取到最后一个区块的字节流
 		tmpBlockInfo := bucket.Get([]byte(it.currentHash))
+		if tmpBlockInfo == nil {
+			return fmt.Errorf("区块%x不存在", it.currentHash)
+		}
 		//获取最后一个区块结构
 		block = DeSerialize(tmpBlockInfo)
+		if block == nil {
+			return fmt.Errorf("区块%x解析失败", it.currentHash)
+		}
 		//游标前移：从区块结构获取前一个区块的哈希值并赋值给游标
 		it.currentHash = block.PrevHash
 		return nil
 	})
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil
 	}
 	return
@@ -202,18 +457,21 @@ func (bc *BlockChain) FindMyUTXO(pubKeyHash []byte) []UTXOInfo {
 	var utxoInfos []UTXOInfo                //UTXO集合
 	var spentUtxos = make(map[string][]int) //定义一个存放已消耗交易输出集合的集合
 
-	it := bc.NewIterator() //定义迭代器
+	it := bc.NewIterator() //定义迭代器（只在创建时读取最后一个区块的哈希）
 
 	for {
 		//遍历区块
 		block := it.Next()
+		if block == nil {
+			break
+		}
 		//遍历交易
 		for _, tx := range block.Transactions {
 		LABEL:
 			//遍历outputs，判断其锁定脚本是否为目标地址
 			for outputIndex, output := range tx.TXOutputs {
 				//判断与付款人有关的UTXO
-				if bytes.Equal(output.ScriptPubKeyHash, pubKeyHash) { //对比两个哈希是否相同
+				if output.isLockedWith(pubKeyHash) { //对比两个哈希是否相同
 					//过滤
 					currentTXID := string(tx.TXID)
 					//在集合中查找集合
@@ -259,94 +517,889 @@ func (bc *BlockChain) FindMyUTXO(pubKeyHash []byte) []UTXOInfo {
 
 }
 
-//遍历账本（转账人地址，转账金额）找到from能使用的utxo集合及包含的所有金额
-func (bc *BlockChain) findNeedUTXO(pubKeyHash []byte, amount float64) (map[string][]int64, float64) {
-	var retMap = make(map[string][]int64)
-	var retValue float64
+//SignTransaction 签名函数
+func (bc *BlockChain) SignTransaction(tx *Transaction, priKey crypto.PrivateKey) bool {
+	//根据TX获取所有需要的prevTXs
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+
+	//执行签名
+	return tx.Sign(priKey, prevTXs, SigHashAll|SigHashBIP143)
+
+}
+
+//ErrTxNotFound 账本中没有找到交易
+var ErrTxNotFound = errors.New("没有找到交易")
 
-	//遍历账本，找到所有utxo集合
-	utxoInfos := bc.FindMyUTXO(pubKeyHash)
-	//遍历utxo,统计总金额
-	for _, utxoInfo := range utxoInfos {
-		retValue += utxoInfo.Value                        //utxo总额
-		key := string(utxoInfo.TXID)                      //
-		retMap[key] = append(retMap[key], utxoInfo.Index) //将要使用的utxo集合
-		//如果总金额大于转账金额，直接返回
-		if retValue >= amount {
-			break
+//FindTransaction 根据交易ID获取交易
+func (bc *BlockChain) FindTransaction(txid []byte) (*Transaction, error) {
+	tx, _, err := bc.findTransactionBlock(txid)
+	return tx, err
+}
+
+//根据交易ID获取交易及其所在的区块
+func (bc *BlockChain) findTransactionBlock(txid []byte) (*Transaction, *Block, error) {
+	//通过交易索引找到交易所在的区块，在区块中查找交易
+	var block *Block
+	bc.db.View(func(tx *bolt.Tx) error {
+		indexBucket := tx.Bucket([]byte(txIndexBucket))
+		if indexBucket == nil {
+			return nil
+		}
+		value := indexBucket.Get(txid)
+		if len(value) <= 8 {
+			return nil
 		}
-		//否则继续遍历
+		block = DeSerialize(tx.Bucket([]byte(blockBucket)).Get(value[8:]))
+		return nil
+	})
+	if block == nil {
+		return nil, nil, ErrTxNotFound
 	}
 
-	return retMap, retValue
+	for _, tx := range block.Transactions {
+		//判断当前交易ID和要查找的ID是否相同
+		if bytes.Equal(tx.TXID, txid) {
+			return tx, block, nil
+		}
+	}
+	return nil, nil, ErrTxNotFound
 }
 
-//SignTransaction 签名函数
-func (bc *BlockChain) SignTransaction(tx *Transaction, priKey *ecdsa.PrivateKey) bool {
-	//根据TX获取所有需要的prevTXs
-	prevTXs := make(map[string]*Transaction)
-	//遍历账本，找到所有需要的交易集合
-	for _, input := range tx.TXInputs {
-		//该input引用的交易
-		prevTX := bc.FindTransaction(input.TXID) //根据ID获得交易
-		if prevTX == nil {
-			fmt.Println("没有找到有效的引用交易")
-			return false
+//TxBlockHeight 根据交易ID获取交易所在区块的高度
+func (bc *BlockChain) TxBlockHeight(txid []byte) (uint64, bool) {
+	var height uint64
+	var found bool
+	bc.db.View(func(tx *bolt.Tx) error {
+		indexBucket := tx.Bucket([]byte(txIndexBucket))
+		if indexBucket == nil {
+			return nil
 		}
-		prevTXs[string(input.TXID)] = prevTX
+		value := indexBucket.Get(txid)
+		if len(value) < 8 {
+			return nil
+		}
+		height = ByteSliceToUint(value[:8])
+		found = true
+		return nil
+	})
+	return height, found
+}
+
+//Height 获取区块链高度（最后一个区块的高度）
+func (bc *BlockChain) Height() (uint64, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.height()
+}
+
+func (bc *BlockChain) height() (uint64, error) {
+	lastBlock := bc.newIterator().Next()
+	if lastBlock == nil {
+		return 0, errors.New("获取最后一个区块失败")
 	}
+	return lastBlock.Height, nil
+}
 
-	//执行签名
-	return tx.Sign(priKey, prevTXs)
+//Confirmations 获取交易的确认数：区块链高度-交易所在区块高度+1
+//交易只存在于交易池时确认数为0
+func (bc *BlockChain) Confirmations(txid []byte) (int, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
 
+	txHeight, ok := bc.TxBlockHeight(txid)
+	if !ok {
+		if bc.mempool.get(txid) != nil {
+			return 0, nil
+		}
+		return 0, ErrTxNotFound
+	}
+	height, err := bc.height()
+	if err != nil {
+		return 0, err
+	}
+	return int(height-txHeight) + 1, nil
 }
 
-//FindTransaction 根据交易ID获取交易
-func (bc *BlockChain) FindTransaction(txid []byte) *Transaction {
-	//遍历区块和账本，比较txid和交易ID，如果相同则返回交易，否则返回nil
+//OutputStatus 查询交易output是否已被消耗（与UTXO集合一致），已消耗时返回消耗它的交易ID
+func (bc *BlockChain) OutputStatus(txid []byte, index int) (spent bool, spender []byte, err error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
 
-	it := bc.NewIterator() //迭代器
+	tx, err := bc.FindTransaction(txid)
+	if err != nil {
+		return false, nil, err
+	}
+	if index < 0 || index >= len(tx.TXOutputs) {
+		return false, nil, errors.New("output不存在")
+	}
+	//数据output不可花费
+	if !tx.TXOutputs[index].isSpendable() {
+		return false, nil, nil
+	}
+	//未消耗
+	if _, ok := bc.utxoSet.utxos[outpointKey(txid, int64(index))]; ok {
+		return false, nil, nil
+	}
 
+	//已消耗：从最后一个区块向前查找消耗它的交易，直到交易所在的区块
+	txHeight, _ := bc.TxBlockHeight(txid)
+	it := bc.newIterator()
 	for {
 		block := it.Next()
-		for _, tx := range block.Transactions {
-			//判断当前交易ID和要查找的ID是否相同
-			if bytes.Equal(tx.TXID, txid) {
-				return tx
+		if block == nil || block.Height < txHeight {
+			break
+		}
+		for _, blockTX := range block.Transactions {
+			if blockTX.isCoinBaseTX() {
+				continue
+			}
+			for _, input := range blockTX.TXInputs {
+				if bytes.Equal(input.TXID, txid) && input.Index == int64(index) {
+					return true, blockTX.TXID, nil
+				}
 			}
 		}
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
+	return false, nil, errors.New("未找到消耗output的交易")
+}
+
+//将区块中所有交易写入交易索引
+func putTxIndex(tx *bolt.Tx, block *Block, height uint64) error {
+	indexBucket, err := tx.CreateBucketIfNotExists([]byte(txIndexBucket))
+	if err != nil {
+		return err
+	}
+	value := append(UintToByteSlice(height), block.Hash...)
+	for _, transaction := range block.Transactions {
+		err = indexBucket.Put(transaction.TXID, value)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-//VerifyTransaction 交易签名校验
-func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
+//RebuildTxIndex 遍历账本，重建交易索引
+func (bc *BlockChain) RebuildTxIndex() error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.rebuildTxIndex()
+}
 
-	//挖矿交易不用校验
-	if tx.isCoinBaseTX() {
-		return true
+func (bc *BlockChain) rebuildTxIndex() error {
+	//从最后一个区块向前遍历，获取所有区块
+	var blocks []*Block
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return errors.New("读取区块失败")
+		}
+		blocks = append(blocks, block)
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
 
-	//根据TX获取所有需要的prevTXs
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		//删除旧的交易索引
+		if tx.Bucket([]byte(txIndexBucket)) != nil {
+			err := tx.DeleteBucket([]byte(txIndexBucket))
+			if err != nil {
+				return err
+			}
+		}
+		//从创世块开始写入，高度依次递增
+		for i := len(blocks) - 1; i >= 0; i-- {
+			err := putTxIndex(tx, blocks[i], uint64(len(blocks)-1-i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//GetPrevTXs 获取交易所有inputs引用的交易（key为交易ID），用于签名和校验
+func (bc *BlockChain) GetPrevTXs(tx *Transaction) (map[string]*Transaction, error) {
 	prevTXs := make(map[string]*Transaction)
 	//遍历账本，找到所有需要的交易集合
 	for _, input := range tx.TXInputs {
 		//该input引用的交易
-		prevTX := bc.FindTransaction(input.TXID) //根据ID获得交易
-		if prevTX == nil {
-			fmt.Println("没有找到有效的引用交易")
-			return false
+		prevTX, err := bc.FindTransaction(input.TXID) //根据ID获得交易
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOutputIndex(input, prevTX); err != nil {
+			return nil, err
 		}
 		prevTXs[string(input.TXID)] = prevTX
 	}
+	return prevTXs, nil
+}
+
+//VerifyTransaction 交易签名校验
+func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
+
+	//挖矿交易不用校验
+	if tx.isCoinBaseTX() {
+		return true
+	}
+
+	//根据TX获取所有需要的prevTXs
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
 
 	//执行签名
 	return tx.Verify(prevTXs)
 }
 
+//VerifyTransactionAgainstChain 根据账本校验交易：引用的交易必须在账本中，引用的output必须未被消耗，
+//然后校验签名和金额（不使用调用者提供的prevTXs）
+func (bc *BlockChain) VerifyTransactionAgainstChain(tx *Transaction) error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if err := tx.CheckSanity(); err != nil {
+		return err
+	}
+	if tx.isCoinBaseTX() {
+		return errors.New("挖矿交易只能出现在区块中")
+	}
+
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		return err
+	}
+	//引用的output必须在UTXO集合中
+	for _, input := range tx.TXInputs {
+		if _, ok := bc.utxoSet.utxos[outpointKey(input.TXID, input.Index)]; !ok {
+			return fmt.Errorf("交易%x引用的output %x:%d已被消耗", tx.TXID, input.TXID, input.Index)
+		}
+	}
+	if !tx.Verify(prevTXs) {
+		return fmt.Errorf("交易%x签名校验失败", tx.TXID)
+	}
+	_, err = checkTxBalance(tx, prevTXs)
+	return err
+}
+
+//ErrImmatureCoinbase 交易花费了未成熟的挖矿交易output
+var ErrImmatureCoinbase = errors.New("挖矿交易的output未成熟，不能花费")
+
+//校验交易没有花费未成熟的挖矿交易output：交易在高度spendHeight花费时，挖矿交易所在区块需至少有CoinbaseMaturity个确认
+func (bc *BlockChain) checkCoinbaseMaturity(tx *Transaction, prevTXs map[string]*Transaction, spendHeight uint64) error {
+	for _, input := range tx.TXInputs {
+		prevTX, ok := prevTXs[string(input.TXID)]
+		if !ok || !prevTX.isCoinBaseTX() {
+			continue
+		}
+		height, ok := prevTX.coinbaseHeight()
+		if !ok {
+			return fmt.Errorf("挖矿交易%x没有区块高度", prevTX.TXID)
+		}
+		if spendHeight < height+uint64(bc.params.CoinbaseMaturity) {
+			return ErrImmatureCoinbase
+		}
+	}
+	return nil
+}
+
+//ErrOutOfOrderSpend 交易使用了同一区块中排在其后面的交易的output
+var ErrOutOfOrderSpend = errors.New("交易引用了区块中位于其后的交易")
+
+//ValidateTxBalance 校验交易金额：inputs引用的output总额不能小于outputs总额（差额为手续费）
+//挖矿交易没有inputs，outputs总额不能超过其高度的挖矿奖励（区块中的挖矿交易还可以加上手续费，见VerifyBlockTransactions）
+func (bc *BlockChain) ValidateTxBalance(tx *Transaction) error {
+	if tx.isCoinBaseTX() {
+		height, ok := tx.coinbaseHeight()
+		if !ok {
+			return fmt.Errorf("挖矿交易%x没有区块高度", tx.TXID)
+		}
+		return bc.ValidateCoinbase(tx, height, 0)
+	}
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		return err
+	}
+	_, err = checkTxBalance(tx, prevTXs)
+	return err
+}
+
+//校验普通交易的金额并返回手续费
+func checkTxBalance(tx *Transaction, prevTXs map[string]*Transaction) (int64, error) {
+	for _, output := range tx.TXOutputs {
+		if output.Value < 0 {
+			return 0, fmt.Errorf("交易%x的output金额为负数", tx.TXID)
+		}
+	}
+	fee, err := txFee(tx, prevTXs)
+	if err != nil {
+		return 0, fmt.Errorf("交易%x: %v", tx.TXID, err)
+	}
+	if fee < 0 {
+		return 0, fmt.Errorf("交易%x的输出金额大于输入金额", tx.TXID)
+	}
+	return fee, nil
+}
+
+//ValidateCoinbase 校验挖矿交易：必须包含区块高度height，outputs总额不能超过该高度的挖矿奖励+区块内交易的手续费totalFees
+func (bc *BlockChain) ValidateCoinbase(tx *Transaction, height uint64, totalFees int64) error {
+	if !tx.isCoinBaseTX() {
+		return fmt.Errorf("交易%x不是挖矿交易", tx.TXID)
+	}
+	if h, ok := tx.coinbaseHeight(); !ok || h != height {
+		return fmt.Errorf("挖矿交易%x的区块高度无效", tx.TXID)
+	}
+	for _, output := range tx.TXOutputs {
+		if output.Value < 0 {
+			return fmt.Errorf("交易%x的output金额为负数", tx.TXID)
+		}
+	}
+	outputsTotal, err := tx.outputsTotal()
+	if err != nil {
+		return err
+	}
+	limit, err := addSatoshi(bc.params.BlockReward(height), totalFees)
+	if err != nil {
+		return err
+	}
+	if outputsTotal > limit {
+		return fmt.Errorf("挖矿交易%x的金额超过挖矿奖励和手续费", tx.TXID)
+	}
+	return nil
+}
+
+//VerifyBlockTransactions 按顺序校验区块中的所有交易
+//已校验的区块内交易的output可以被后面的交易使用
+func (bc *BlockChain) VerifyBlockTransactions(block *Block) error {
+	//交易在区块中的位置
+	positions := make(map[string]int)
+	for i, tx := range block.Transactions {
+		positions[string(tx.TXID)] = i
+	}
+
+	//区块内已校验的交易
+	inBlockTXs := make(map[string]*Transaction)
+	//区块内交易的手续费总额
+	var fees int64
+
+	for i, tx := range block.Transactions {
+		//交易结构必须有效（不能重复引用同一个output），交易ID必须与交易内容一致
+		if err := tx.CheckSanity(); err != nil {
+			return err
+		}
+		if err := tx.checkTXID(); err != nil {
+			return fmt.Errorf("交易%x: %v", tx.TXID, err)
+		}
+		//交易必须已到锁定时间
+		if !tx.IsFinal(block.Height, block.unixTime()) {
+			return fmt.Errorf("交易%x未到锁定时间", tx.TXID)
+		}
+		if !tx.isCoinBaseTX() {
+			prevTXs := make(map[string]*Transaction)
+			for _, input := range tx.TXInputs {
+				//优先使用区块内已校验的交易
+				prevTX, ok := inBlockTXs[string(input.TXID)]
+				if !ok {
+					//引用的交易在区块中位于当前交易之后（或就是自身）
+					if pos, ok := positions[string(input.TXID)]; ok && pos >= i {
+						return ErrOutOfOrderSpend
+					}
+					var err error
+					prevTX, err = bc.FindTransaction(input.TXID)
+					if err != nil {
+						return err
+					}
+				}
+				prevTXs[string(input.TXID)] = prevTX
+			}
+			if !tx.Verify(prevTXs) {
+				return fmt.Errorf("交易%x校验失败", tx.TXID)
+			}
+			//挖矿交易的output必须已成熟
+			if err := bc.checkCoinbaseMaturity(tx, prevTXs, block.Height); err != nil {
+				return fmt.Errorf("交易%x: %v", tx.TXID, err)
+			}
+			//校验金额，累计手续费
+			fee, err := checkTxBalance(tx, prevTXs)
+			if err != nil {
+				return err
+			}
+			if fees, err = addSatoshi(fees, fee); err != nil {
+				return err
+			}
+		}
+		//校验通过，加入区块内的交易集合
+		inBlockTXs[string(tx.TXID)] = tx
+	}
+
+	//挖矿交易必须包含区块高度，且最多获得挖矿奖励+手续费
+	for _, tx := range block.Transactions {
+		if tx.isCoinBaseTX() {
+			err := bc.ValidateCoinbase(tx, block.Height, fees)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//VerifyBlock 校验连接在最后一个区块之后的区块（共识规则的入口）：
+//时间戳大于中位时间且不过分超前本地时间，梅克尔根正确，第一个交易是区块中唯一的挖矿交易，交易的签名、金额、挖矿奖励和花费的挖矿交易output的成熟度有效（见VerifyBlockTransactions），
+//区块内没有双花，input引用的output在UTXO集合中或由区块内排在前面的交易创建
+func (bc *BlockChain) VerifyBlock(block *Block) error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.verifyBlock(block)
+}
+
+func (bc *BlockChain) verifyBlock(block *Block) error {
+	if !bytes.Equal(block.PrevHash, bc.tail) {
+		return errors.New("区块没有连接在最后一个区块之后")
+	}
+	if err := bc.checkBlockTime(block, time.Now()); err != nil {
+		return err
+	}
+	if err := checkBlockStructure(block); err != nil {
+		return err
+	}
+
+	//签名、金额和挖矿奖励
+	if err := bc.VerifyBlockTransactions(block); err != nil {
+		return err
+	}
+
+	return checkBlockSpends(block, bc.utxoSet)
+}
+
+//校验区块的梅克尔根，以及挖矿交易有且只有一个，位于区块的第一个
+func checkBlockStructure(block *Block) error {
+	if !bytes.Equal(NewMerkleTree(block.txids()).Root(), block.MerkleRoot) {
+		return errors.New("区块梅克尔根无效")
+	}
+	if len(block.Transactions) == 0 || !block.Transactions[0].isCoinBaseTX() {
+		return errors.New("区块的第一个交易不是挖矿交易")
+	}
+	for _, tx := range block.Transactions[1:] {
+		if tx.isCoinBaseTX() {
+			return fmt.Errorf("区块包含多个挖矿交易: %x", tx.TXID)
+		}
+	}
+	return nil
+}
+
+//校验区块内没有双花，input引用的output在UTXO集合utxo中或由区块内排在前面的交易创建
+func checkBlockSpends(block *Block, utxo *UTXOSet) error {
+	spent := make(map[string]bool)
+	created := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if !tx.isCoinBaseTX() {
+			for _, input := range tx.TXInputs {
+				key := outpointKey(input.TXID, input.Index)
+				if spent[key] {
+					return fmt.Errorf("区块内的交易%x重复使用output %s", tx.TXID, key)
+				}
+				spent[key] = true
+				if _, ok := utxo.utxos[key]; !ok && !created[key] {
+					return fmt.Errorf("交易%x引用的output %s不存在或已被消耗", tx.TXID, key)
+				}
+			}
+		}
+		for i, output := range tx.TXOutputs {
+			if output.isSpendable() {
+				created[outpointKey(tx.TXID, int64(i))] = true
+			}
+		}
+	}
+	return nil
+}
+
+//Balance 获取地址对应的金额（UTXO集合中该地址所有utxo的总额），地址无效时返回错误
+func (bc *BlockChain) Balance(address string) (int64, error) {
+	if !IsValidAddress(address) {
+		return 0, errors.New("传入地址无效")
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return 0, err
+	}
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.utxoSet.Balance(pubKeyHash), nil
+}
+
+//FindUTXO 获取公钥哈希对应的所有utxo（UTXO集合中）
+func (bc *BlockChain) FindUTXO(pubKeyHash []byte) []UTXOInfo {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.utxoSet.FindUTXO(pubKeyHash)
+}
+
+//FindUTXOInRange 获取公钥哈希对应的金额在[min, max]范围内的utxo，按金额从小到大排序（用于手动选择utxo）
+func (bc *BlockChain) FindUTXOInRange(pubKeyHash []byte, min, max int64) []UTXOInfo {
+	var utxoInfos []UTXOInfo
+	for _, utxoInfo := range bc.FindUTXO(pubKeyHash) {
+		if utxoInfo.Value >= min && utxoInfo.Value <= max {
+			utxoInfos = append(utxoInfos, utxoInfo)
+		}
+	}
+	sort.Slice(utxoInfos, func(i, j int) bool {
+		return utxoInfos[i].Value < utxoInfos[j].Value
+	})
+	return utxoInfos
+}
+
+//BalanceDetail 获取公钥哈希对应的已确认金额和计入交易池交易后的待确认金额
+func (bc *BlockChain) BalanceDetail(pubKeyHash []byte) (confirmed, pending int64) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.utxoSet.BalanceDetail(pubKeyHash, bc.mempool)
+}
+
+//BalanceAtHeight 获取地址在指定高度时的金额：只统计高度不超过height的区块（遍历账本，不使用UTXO集合）
+func (bc *BlockChain) BalanceAtHeight(address string, height uint64) (int64, error) {
+	if !IsValidAddress(address) {
+		return 0, errors.New("传入地址无效")
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return 0, err
+	}
+	if bc.prunedHeight() != 0 {
+		return 0, errors.New("区块链已裁剪，无法查询历史金额")
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	tip, err := bc.height()
+	if err != nil {
+		return 0, err
+	}
+	if height > tip {
+		return 0, fmt.Errorf("高度%d超过区块链高度%d", height, tip)
+	}
+
+	//从后向前遍历：output被消耗的区块不早于其所在区块，先记录已消耗的output
+	//同一区块内的交易可以花费排在前面的交易的output，所以先记录整个区块的input，再统计output
+	spent := make(map[string]bool)
+	var total int64
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return 0, errors.New("读取区块失败")
+		}
+		if block.Height <= height {
+			for _, tx := range block.Transactions {
+				if tx.isCoinBaseTX() {
+					continue
+				}
+				for _, input := range tx.TXInputs {
+					spent[outpointKey(input.TXID, input.Index)] = true
+				}
+			}
+			for _, tx := range block.Transactions {
+				for i, output := range tx.TXOutputs {
+					if output.isLockedWith(pubKeyHash) && !spent[outpointKey(tx.TXID, int64(i))] {
+						total += output.Value
+					}
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+//CoinDaysDestroyed 交易销毁的币天数：每个input引用的output金额（BTC）乘以其未被花费的天数之和
+//output的年龄从其所在区块的时间计算到交易所在区块的时间，交易未上链时计算到当前时间
+func (bc *BlockChain) CoinDaysDestroyed(tx *Transaction) (float64, error) {
+	if tx.isCoinBaseTX() {
+		return 0, nil
+	}
+	spendTime := uint64(time.Now().Unix())
+	if _, block, err := bc.findTransactionBlock(tx.TXID); err == nil {
+		spendTime = block.unixTime()
+	}
+
+	var total float64
+	for _, input := range tx.TXInputs {
+		prevTX, block, err := bc.findTransactionBlock(input.TXID)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkOutputIndex(input, prevTX); err != nil {
+			return 0, err
+		}
+		age := int64(spendTime) - int64(block.unixTime())
+		if age < 0 {
+			age = 0
+		}
+		days := float64(age) / float64(24*time.Hour/time.Second)
+		total += float64(prevTX.TXOutputs[input.Index].Value) / SatoshiPerBTC * days
+	}
+	return total, nil
+}
+
+//AddressTx 地址的一条交易记录
+type AddressTx struct {
+	TXID      []byte //交易ID
+	Height    uint64 //交易所在区块的高度
+	TimeStamp uint64 //交易所在区块的时间（Unix时间，秒）
+	Value     int64  //地址的金额变化：收到为正，支出为负（扣除找零）
+}
+
+//AddressHistory 获取地址的交易记录（已上链的交易，按区块顺序排列）
+func (bc *BlockChain) AddressHistory(address string) ([]AddressTx, error) {
+	if !IsValidAddress(address) {
+		return nil, errors.New("传入地址无效")
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return nil, err
+	}
+	if bc.prunedHeight() != 0 {
+		return nil, errors.New("区块链已裁剪，无法查询交易记录")
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if len(bc.tail) == 0 {
+		return nil, nil
+	}
+
+	//从后向前遍历得到所有区块，再从创世块开始按顺序处理
+	var blocks []*Block
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return nil, errors.New("读取区块失败")
+		}
+		blocks = append(blocks, block)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	//支付给地址的output的金额（key为output位置），被消耗时从中扣除
+	owned := make(map[string]int64)
+	var history []AddressTx
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		for _, tx := range block.Transactions {
+			var value int64
+			var involved bool
+			if !tx.isCoinBaseTX() {
+				for _, input := range tx.TXInputs {
+					key := outpointKey(input.TXID, input.Index)
+					if v, ok := owned[key]; ok {
+						value -= v
+						involved = true
+						delete(owned, key)
+					}
+				}
+			}
+			for j, output := range tx.TXOutputs {
+				if output.isLockedWith(pubKeyHash) {
+					value += output.Value
+					involved = true
+					owned[outpointKey(tx.TXID, int64(j))] = output.Value
+				}
+			}
+			if involved {
+				history = append(history, AddressTx{tx.TXID, block.Height, block.unixTime(), value})
+			}
+		}
+	}
+	return history, nil
+}
+
+//IsAddressReused 判断地址是否被重复使用（在多于一个已上链的交易中收到过金额），同时返回收款交易数
+//地址重复使用会降低隐私，钱包可以据此提示用户；地址无效时返回false, 0
+func (bc *BlockChain) IsAddressReused(address string) (bool, int) {
+	if !IsValidAddress(address) {
+		return false, 0
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return false, 0
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if len(bc.tail) == 0 {
+		return false, 0
+	}
+
+	//同一交易中支付给地址的多个output只计一次
+	var count int
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			break
+		}
+		for _, tx := range block.Transactions {
+			for _, output := range tx.TXOutputs {
+				if output.isLockedWith(pubKeyHash) {
+					count++
+					break
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return count > 1, count
+}
+
+//TotalSupply 获取指定高度时的货币总量：高度不超过height的区块中挖矿交易实际发行的金额之和，减去被销毁（数据output中）的金额
+//挖矿交易的output包含区块内交易的手续费，手续费来自已有的货币，不计入发行量
+//height超过区块链高度时按当前高度计算；区块链已裁剪时无法计算手续费，返回0
+func (bc *BlockChain) TotalSupply(height uint64) int64 {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if len(bc.tail) == 0 {
+		return 0
+	}
+	if bc.prunedHeight() != 0 {
+		logger.Error("区块链已裁剪，无法计算货币总量")
+		return 0
+	}
+
+	var total int64
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			logger.Error("读取区块失败")
+			return 0
+		}
+		if block.Height <= height {
+			for _, tx := range block.Transactions {
+				if tx.isCoinBaseTX() {
+					for _, output := range tx.TXOutputs {
+						total += output.Value
+					}
+				} else {
+					prevTXs, err := bc.GetPrevTXs(tx)
+					if err != nil {
+						logger.Error(err)
+						return 0
+					}
+					fee, err := tx.Fee(prevTXs)
+					if err != nil {
+						logger.Error(err)
+						return 0
+					}
+					total -= fee
+				}
+				for _, output := range tx.TXOutputs {
+					if !output.isSpendable() {
+						total -= output.Value
+					}
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return total
+}
+
+//余额统计的确认数要求
+const minConfirmations = 6
+
+//BalanceByDepth 按确认深度统计地址的金额
+//confirmed：确认数达到minConfirmations，pending：确认数不足，immature：未成熟的挖矿奖励
+func (bc *BlockChain) BalanceByDepth(address string) (confirmed, pending, immature uint64, err error) {
+	if !IsValidAddress(address) {
+		return 0, 0, 0, errors.New("传入地址无效")
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	//遍历账本，记录每个交易的确认数（最后一个区块的确认数为1）
+	depths := make(map[string]int)
+	coinbases := make(map[string]bool)
+	if len(bc.tail) != 0 {
+		it := bc.newIterator()
+		for depth := 1; ; depth++ {
+			block := it.Next()
+			if block == nil {
+				return 0, 0, 0, errors.New("读取区块失败")
+			}
+			for _, tx := range block.Transactions {
+				depths[string(tx.TXID)] = depth
+				coinbases[string(tx.TXID)] = tx.isCoinBaseTX()
+			}
+			if len(block.PrevHash) == 0 {
+				break
+			}
+		}
+	}
+
+	//按确认数对utxo分类
+	for _, utxoInfo := range bc.utxoSet.FindUTXO(pubKeyHash) {
+		depth := depths[string(utxoInfo.TXID)]
+		value := uint64(utxoInfo.Value)
+		switch {
+		case coinbases[string(utxoInfo.TXID)] && depth < bc.params.CoinbaseMaturity:
+			immature += value
+		case depth < minConfirmations:
+			pending += value
+		default:
+			confirmed += value
+		}
+	}
+	return confirmed, pending, immature, nil
+}
+
+//ReindexAll 遍历账本，清空并重建所有索引
+func (bc *BlockChain) ReindexAll() error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.prunedHeight() != 0 {
+		return errors.New("区块链已裁剪，无法重建UTXO集合")
+	}
+	logger.Info("开始重建交易索引...")
+	err := bc.rebuildTxIndex()
+	if err != nil {
+		return err
+	}
+	logger.Info("交易索引重建完成")
+
+	logger.Info("开始重建UTXO集合...")
+	if err := bc.utxoSet.Reindex(bc); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("UTXO集合重建完成，共%d个utxo", len(bc.utxoSet.utxos)))
+	return bc.utxoSet.Save(utxoSetFile)
+}
+
 /*
 
 
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//测试用钱包
+func newTestWallet(t testing.TB) *Wallet {
+	t.Helper()
+	w := NewWalletKeyPair()
+	if w == nil {
+		t.Fatal("创建钱包失败")
+	}
+	return w
+}
+
+//在临时目录中创建区块链，创世块的挖矿奖励属于返回的钱包，挖矿奖励可以立即花费
+//返回的函数关闭区块链并删除临时目录
+func newTestChain(t testing.TB) (*BlockChain, *Wallet, func()) {
+	t.Helper()
+	params := DefaultChainParams()
+	params.CoinbaseMaturity = 0
+	return newTestChainWithParams(t, params)
+}
+
+//在临时目录中使用指定的共识参数创建区块链
+func newTestChainWithParams(t testing.TB, params ChainParams) (*BlockChain, *Wallet, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hibtc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	restore := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+
+	w := newTestWallet(t)
+	if err := CreateBlockChainWithParams(w.getAddress(activeNetwork), params); err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	bc, err := GetBlockChainInstanceWithParams(params)
+	if err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	return bc, w, func() {
+		bc.db.Close()
+		restore()
+	}
+}
+
+//创建并签名交易：将prev的第index个output（属于钱包w）支付给to，手续费为fee
+func newTestSpend(t testing.TB, w *Wallet, prev *Transaction, index int64, to string, fee int64) *Transaction {
+	t.Helper()
+	output, err := NewTXOutput(to, prev.TXOutputs[index].Value-fee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: prev.TXID, Index: index, PubKey: w.PublicKey, Sequence: MaxRBFSequence}},
+		TXOutputs: []TXOutput{output},
+		TimeStamp: uint64(time.Now().Unix()),
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, map[string]*Transaction{string(prev.TXID): prev})
+	return tx
+}
+
+//创建下一个区块的挖矿交易
+func newTestCoinbase(t testing.TB, bc *BlockChain, miner, data string) *Transaction {
+	t.Helper()
+	height, err := bc.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc.NewCoinbaseTX(miner, data, height+1)
+}
+
+//使用钱包w的私钥签名交易
+func signTestTX(t testing.TB, tx *Transaction, w *Wallet, prevTXs map[string]*Transaction) {
+	t.Helper()
+	if !tx.Sign(w.signingKey(), prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+}
+
+//花费创世块的挖矿奖励，向钱包w支付金额为values的多个output，剩余金额支付给其他地址，打包上链
+func fundTestOutputs(t testing.TB, bc *BlockChain, w *Wallet, values []int64) *Transaction {
+	t.Helper()
+	address := w.getAddress(activeNetwork)
+	other := newTestWallet(t).getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: coinbase.TXID, Index: 0, PubKey: w.PublicKey, Sequence: MaxRBFSequence}},
+		TimeStamp: uint64(time.Now().Unix()),
+	}
+	change := coinbase.TXOutputs[0].Value
+	for _, value := range values {
+		output, err := NewTXOutput(address, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+		change -= value
+	}
+	output, err := NewTXOutput(other, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TXOutputs = append(tx.TXOutputs, output)
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, map[string]*Transaction{string(coinbase.TXID): coinbase})
+
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, other, "fund"), tx}); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+//将钱包保存到钱包文件，使按地址查找私钥的接口可以使用该钱包
+func saveTestWallet(t testing.TB, w *Wallet) {
+	t.Helper()
+	wm := NewWalletManager()
+	if wm == nil {
+		t.Fatal("打开钱包失败")
+	}
+	wm.Wallets[w.getAddress(activeNetwork)] = w
+	if !wm.saveFile() {
+		t.Fatal("保存钱包失败")
+	}
+}
+
+//获取创世块的挖矿交易
+func genesisCoinbase(t testing.TB, bc *BlockChain) *Transaction {
+	t.Helper()
+	it := bc.NewIterator()
+	for {
+		block := it.Next()
+		if len(block.PrevHash) == 0 {
+			return block.Transactions[0]
+		}
+	}
+}
+
+func TestVerifyBlockTransactionsOrder(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	//tx2花费tx1的output
+	tx1 := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 10000)
+	tx2 := newTestSpend(t, w, tx1, 0, address, 10000)
+	coinbase := bc.NewCoinbaseTX(address, "", 0)
+
+	block := &Block{Transactions: []*Transaction{coinbase, tx1, tx2}}
+	if err := bc.VerifyBlockTransactions(block); err != nil {
+		t.Fatalf("按顺序排列的交易应通过校验: %v", err)
+	}
+
+	block = &Block{Transactions: []*Transaction{coinbase, tx2, tx1}}
+	if err := bc.VerifyBlockTransactions(block); err != ErrOutOfOrderSpend {
+		t.Fatalf("期望ErrOutOfOrderSpend，实际为%v", err)
+	}
+}
+
+func TestBalanceByDepth(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+
+	//深度确认的收款
+	deep := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "1"), deep}); err != nil {
+		t.Fatal(err)
+	}
+	appendTestBlocks(t, bc, minConfirmations, address, address)
+
+	//最近的收款和未成熟的挖矿奖励
+	utxoInfo := bc.utxoSet.FindUTXO(GetPubKeyHashFromPublicKey(w.PublicKey))[0]
+	prev, err := bc.FindTransaction(utxoInfo.TXID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := newTestSpend(t, w, prev, utxoInfo.Index, payee, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, payee, "2"), recent}); err != nil {
+		t.Fatal(err)
+	}
+
+	bc.params.CoinbaseMaturity = DefaultChainParams().CoinbaseMaturity
+	confirmed, pending, immature, err := bc.BalanceByDepth(payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed != uint64(deep.TXOutputs[0].Value) {
+		t.Errorf("confirmed为%d，期望%d", confirmed, deep.TXOutputs[0].Value)
+	}
+	if pending != uint64(recent.TXOutputs[0].Value) {
+		t.Errorf("pending为%d，期望%d", pending, recent.TXOutputs[0].Value)
+	}
+	if immature != uint64(initialReward) {
+		t.Errorf("immature为%d，期望%d", immature, initialReward)
+	}
+
+	if _, _, _, err := bc.BalanceByDepth("invalid"); err == nil {
+		t.Error("无效地址应返回错误")
+	}
+}
+
+func TestBalance(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	if balance, err := bc.Balance(address); err != nil || balance != initialReward {
+		t.Fatalf("金额为%d(%v)，期望%d", balance, err, initialReward)
+	}
+	if balance, err := bc.Balance(newTestWallet(t).getAddress(activeNetwork)); err != nil || balance != 0 {
+		t.Fatalf("空地址金额为%d(%v)，期望0", balance, err)
+	}
+
+	//校验码错误的地址
+	malformed := []byte(address)
+	if malformed[len(malformed)-1] == '2' {
+		malformed[len(malformed)-1] = '3'
+	} else {
+		malformed[len(malformed)-1] = '2'
+	}
+	for _, invalid := range []string{"", "invalid", string(malformed)} {
+		if _, err := bc.Balance(invalid); err == nil {
+			t.Errorf("无效地址%q应返回错误", invalid)
+		}
+	}
+}
+
+func TestBalanceAtHeight(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+	appendTestBlocks(t, bc, 2, miner, miner)
+
+	//高度3：收到1 BTC
+	fund := &Transaction{
+		TXInputs:  []TXInput{{TXID: coinbase.TXID, Index: 0, PubKey: w.PublicKey, Sequence: MaxRBFSequence}},
+		TimeStamp: uint64(time.Now().Unix()),
+	}
+	for _, payment := range []struct {
+		to    string
+		value int64
+	}{{payeeAddress, SatoshiPerBTC}, {address, initialReward - SatoshiPerBTC - 1000}} {
+		output, err := NewTXOutput(payment.to, payment.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fund.TXOutputs = append(fund.TXOutputs, output)
+	}
+	if err := fund.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, fund, w, map[string]*Transaction{string(coinbase.TXID): coinbase})
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, "3"), fund}); err != nil {
+		t.Fatal(err)
+	}
+	appendTestBlocks(t, bc, 3, miner, miner)
+
+	//高度7：全部花费
+	spend := newTestSpend(t, payee, fund, 0, address, 1000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, "7"), spend}); err != nil {
+		t.Fatal(err)
+	}
+	appendTestBlocks(t, bc, 1, miner, miner)
+
+	for _, want := range []struct {
+		height  uint64
+		balance int64
+	}{{0, 0}, {2, 0}, {3, SatoshiPerBTC}, {4, SatoshiPerBTC}, {6, SatoshiPerBTC}, {7, 0}, {8, 0}} {
+		balance, err := bc.BalanceAtHeight(payeeAddress, want.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != want.balance {
+			t.Errorf("高度%d的金额为%d，期望%d", want.height, balance, want.balance)
+		}
+	}
+	if balance, err := bc.BalanceAtHeight(address, 0); err != nil || balance != initialReward {
+		t.Errorf("创世块高度的金额为%d(%v)，期望%d", balance, err, initialReward)
+	}
+
+	if _, err := bc.BalanceAtHeight(payeeAddress, 9); err == nil {
+		t.Error("超过区块链高度时应返回错误")
+	}
+	if _, err := bc.BalanceAtHeight("invalid", 1); err == nil {
+		t.Error("无效地址应返回错误")
+	}
+}
+
+func TestBalanceAtHeightInBlockChain(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	other := newTestWallet(t).getAddress(activeNetwork)
+
+	//同一区块内：tx1向payee付款，tx2花费tx1的output
+	tx1 := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payeeAddress, 1000)
+	tx2 := newTestSpend(t, payee, tx1, 0, other, 1000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, other, "1"), tx1, tx2}); err != nil {
+		t.Fatal(err)
+	}
+	if height, ok := bc.TxBlockHeight(tx2.TXID); !ok || height != 1 {
+		t.Fatalf("tx2应打包在高度1，实际为%d, %v", height, ok)
+	}
+
+	if balance, err := bc.BalanceAtHeight(payeeAddress, 1); err != nil || balance != 0 {
+		t.Errorf("payee在高度1的金额为%d(%v)，期望0", balance, err)
+	}
+	want := tx2.TXOutputs[0].Value + initialReward
+	if balance, err := bc.BalanceAtHeight(other, 1); err != nil || balance != want {
+		t.Errorf("other在高度1的金额为%d(%v)，期望%d", balance, err, want)
+	}
+}
+
+func TestTotalSupply(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	appendTestBlocks(t, bc, 4, miner, miner)
+
+	//每个区块的奖励相同
+	for height := uint64(0); height <= 4; height++ {
+		if got, want := bc.TotalSupply(height), int64(height+1)*initialReward; got != want {
+			t.Fatalf("高度%d的货币总量为%d，期望%d", height, got, want)
+		}
+	}
+
+	//高度5：销毁5000聪（数据output不可花费）
+	coinbase := genesisCoinbase(t, bc)
+	burn := &Transaction{
+		TXInputs:  []TXInput{{TXID: coinbase.TXID, Index: 0, PubKey: w.PublicKey, Sequence: MaxRBFSequence}},
+		TXOutputs: []TXOutput{{Value: 5000, ScriptType: ScriptData, ScriptPubKeyHash: []byte("burn")}},
+		TimeStamp: uint64(time.Now().Unix()),
+	}
+	change, err := NewTXOutput(address, initialReward-5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	burn.TXOutputs = append(burn.TXOutputs, change)
+	if err := burn.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, burn, w, map[string]*Transaction{string(coinbase.TXID): coinbase})
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, "burn"), burn}); err != nil {
+		t.Fatal(err)
+	}
+	if block := bc.GetBlock(bc.tail); len(block.Transactions) != 2 {
+		t.Fatal("销毁交易应被打包")
+	}
+
+	if got, want := bc.TotalSupply(4), 5*initialReward; got != want {
+		t.Fatalf("高度4的货币总量为%d，期望%d", got, want)
+	}
+	if got, want := bc.TotalSupply(5), 6*initialReward-5000; got != want {
+		t.Fatalf("高度5的货币总量为%d，期望%d", got, want)
+	}
+
+	//高度6：挖矿交易领取奖励和10000聪手续费，手续费不是新发行的货币
+	feeTX := newTestSpend(t, w, burn, 1, address, 10000)
+	acceptTestBlockAt(t, bc, []*Transaction{newCoinbaseTX(miner, "fee", 6, initialReward+10000), feeTX}, time.Now())
+	//高度7：挖矿交易只领取一半的奖励，未领取的部分没有发行
+	acceptTestBlockAt(t, bc, []*Transaction{newCoinbaseTX(miner, "half", 7, initialReward/2)}, time.Now())
+
+	if got, want := bc.TotalSupply(6), 7*initialReward-5000; got != want {
+		t.Fatalf("高度6的货币总量为%d，期望%d", got, want)
+	}
+	for _, height := range []uint64{7, 100} {
+		if got, want := bc.TotalSupply(height), 7*initialReward+initialReward/2-5000; got != want {
+			t.Fatalf("高度%d的货币总量为%d，期望%d", height, got, want)
+		}
+	}
+}
+
+func TestFindTransaction(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	coinbase := genesisCoinbase(t, bc)
+
+	tx, err := bc.FindTransaction(coinbase.TXID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.TXID, coinbase.TXID) {
+		t.Fatalf("找到的交易为%x，期望%x", tx.TXID, coinbase.TXID)
+	}
+
+	if _, err := bc.FindTransaction([]byte("no such transaction")); err != ErrTxNotFound {
+		t.Fatalf("期望ErrTxNotFound，实际为%v", err)
+	}
+
+	//GetPrevTXs返回签名和校验所需的引用交易
+	spend := newTestSpend(t, w, coinbase, 0, w.getAddress(activeNetwork), 10000)
+	prevTXs, err := bc.GetPrevTXs(spend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prevTXs) != 1 || prevTXs[string(coinbase.TXID)] == nil {
+		t.Fatalf("引用交易为%v", prevTXs)
+	}
+	if !spend.Verify(prevTXs) {
+		t.Fatal("使用GetPrevTXs的结果校验签名失败")
+	}
+	spend.TXInputs[0].TXID = []byte("no such transaction")
+	if _, err := bc.GetPrevTXs(spend); err != ErrTxNotFound {
+		t.Fatalf("期望ErrTxNotFound，实际为%v", err)
+	}
+}
+
+//检查区块链中每个交易的索引高度与所在区块一致
+func checkTxIndex(t *testing.T, bc *BlockChain) int {
+	t.Helper()
+	count := 0
+	it := bc.NewIterator()
+	for {
+		block := it.Next()
+		for _, tx := range block.Transactions {
+			height, ok := bc.TxBlockHeight(tx.TXID)
+			if !ok || height != block.Height {
+				t.Fatalf("交易%x的索引高度为%d(%v)，期望%d", tx.TXID, height, ok, block.Height)
+			}
+			count++
+		}
+		if len(block.PrevHash) == 0 {
+			return count
+		}
+	}
+}
+
+func TestTxIndexConsistent(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	prev := genesisCoinbase(t, bc)
+	for i := 1; i <= 3; i++ {
+		tx := newTestSpend(t, w, prev, 0, address, 10000)
+		if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, fmt.Sprint(i)), tx}); err != nil {
+			t.Fatal(err)
+		}
+		if height, ok := bc.TxBlockHeight(tx.TXID); !ok || height != uint64(i) {
+			t.Fatalf("交易的区块高度为%d(%v)，期望%d", height, ok, i)
+		}
+		prev = tx
+	}
+	if count := checkTxIndex(t, bc); count != 7 {
+		t.Fatalf("索引了%d个交易，期望7个", count)
+	}
+	if _, ok := bc.TxBlockHeight([]byte("no such transaction")); ok {
+		t.Fatal("不存在的交易不应有区块高度")
+	}
+
+	//删除交易索引后重建
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(txIndexBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bc.TxBlockHeight(prev.TXID); ok {
+		t.Fatal("交易索引已删除")
+	}
+	if err := bc.RebuildTxIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if count := checkTxIndex(t, bc); count != 7 {
+		t.Fatalf("重建后索引了%d个交易，期望7个", count)
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 10000)
+	if err := bc.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := bc.Confirmations(tx.TXID); err != nil || n != 0 {
+		t.Fatalf("交易池中的交易确认数为%d(%v)，期望0", n, err)
+	}
+
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "confirm"), tx}); err != nil {
+		t.Fatal(err)
+	}
+	if bc.mempool.Get(tx.TXID) != nil {
+		t.Fatal("已打包的交易应从交易池移除")
+	}
+	if n, err := bc.Confirmations(tx.TXID); err != nil || n != 1 {
+		t.Fatalf("刚打包的交易确认数为%d(%v)，期望1", n, err)
+	}
+
+	appendTestBlocks(t, bc, 5, address, payee)
+	if n, err := bc.Confirmations(tx.TXID); err != nil || n != 6 {
+		t.Fatalf("交易确认数为%d(%v)，期望6", n, err)
+	}
+
+	if _, err := bc.Confirmations([]byte("no such transaction")); err != ErrTxNotFound {
+		t.Fatalf("未知交易应返回ErrTxNotFound，实际为%v", err)
+	}
+}
+
+func TestValidateTxBalance(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	valid := newTestSpend(t, w, coinbase, 0, address, 10000)
+	if err := bc.ValidateTxBalance(valid); err != nil {
+		t.Fatalf("金额正确的交易应通过校验: %v", err)
+	}
+
+	//outputs总额比inputs多1聪，签名有效
+	inflated := newTestSpend(t, w, coinbase, 0, address, -1)
+	if !bc.VerifyTransaction(inflated) {
+		t.Fatal("签名应有效")
+	}
+	if err := bc.ValidateTxBalance(inflated); err == nil {
+		t.Fatal("输出金额大于输入金额的交易应被拒绝")
+	}
+	block := &Block{Transactions: []*Transaction{bc.NewCoinbaseTX(address, "", 0), inflated}}
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("包含凭空创造金额交易的区块应被拒绝")
+	}
+
+	//挖矿交易最多获得挖矿奖励+手续费
+	miner := bc.NewCoinbaseTX(address, "fees", 0)
+	miner.TXOutputs[0].Value += 10000
+	miner.setHash()
+	if err := bc.ValidateTxBalance(miner); err == nil {
+		t.Fatal("单独的挖矿交易金额不能超过挖矿奖励")
+	}
+	block = &Block{Transactions: []*Transaction{miner, valid}}
+	if err := bc.VerifyBlockTransactions(block); err != nil {
+		t.Fatalf("挖矿交易可以获得区块内交易的手续费: %v", err)
+	}
+	miner.TXOutputs[0].Value++
+	miner.setHash()
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("挖矿交易金额超过挖矿奖励和手续费时区块应被拒绝")
+	}
+}
+
+func TestVerifyTransactionAgainstChain(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	tx := newTestSpend(t, w, coinbase, 0, payee, 10000)
+	if err := bc.VerifyTransactionAgainstChain(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, ""), tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	//签名有效，但引用的output已被消耗
+	double := newTestSpend(t, w, coinbase, 0, address, 20000)
+	if !double.Verify(map[string]*Transaction{string(coinbase.TXID): coinbase}) {
+		t.Fatal("交易签名应有效")
+	}
+	if err := bc.VerifyTransactionAgainstChain(double); err == nil {
+		t.Fatal("花费已消耗output的交易应被拒绝")
+	}
+
+	//引用的交易不在账本中
+	fake := bc.NewCoinbaseTX(address, "fake", 100)
+	if err := bc.VerifyTransactionAgainstChain(newTestSpend(t, w, fake, 0, payee, 10000)); err == nil {
+		t.Fatal("引用账本中不存在的交易应被拒绝")
+	}
+	if err := bc.VerifyTransactionAgainstChain(fake); err == nil {
+		t.Fatal("单独的挖矿交易应被拒绝")
+	}
+}
+
+func TestOutputStatus(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	//未消耗
+	spent, spender, err := bc.OutputStatus(coinbase.TXID, 0)
+	if err != nil || spent || spender != nil {
+		t.Fatalf("未消耗的output状态为%v %x %v", spent, spender, err)
+	}
+
+	//已消耗
+	tx := newTestSpend(t, w, coinbase, 0, address, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "1"), tx}); err != nil {
+		t.Fatal(err)
+	}
+	appendTestBlocks(t, bc, 2, address, address)
+	spent, spender, err = bc.OutputStatus(coinbase.TXID, 0)
+	if err != nil || !spent || !bytes.Equal(spender, tx.TXID) {
+		t.Fatalf("已消耗的output状态为%v %x %v，期望被%x消耗", spent, spender, err, tx.TXID)
+	}
+	if spent, _, err := bc.OutputStatus(tx.TXID, 0); err != nil || spent {
+		t.Fatalf("新交易的output状态为%v %v", spent, err)
+	}
+
+	//不存在
+	if _, _, err := bc.OutputStatus(coinbase.TXID, 1); err == nil {
+		t.Fatal("不存在的output应返回错误")
+	}
+	if _, _, err := bc.OutputStatus([]byte("no such transaction"), 0); err != ErrTxNotFound {
+		t.Fatalf("不存在的交易应返回ErrTxNotFound，实际为%v", err)
+	}
+}
+
+func TestAddressHistory(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	miner := newTestWallet(t).getAddress(activeNetwork)
+
+	//高度1：收到款项；高度2：全部付回
+	receive := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payeeAddress, 1000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, "1"), receive}); err != nil {
+		t.Fatal(err)
+	}
+	send := newTestSpend(t, payee, receive, 0, address, 1000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, "2"), send}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := bc.AddressHistory(payeeAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		txid   []byte
+		height uint64
+		value  int64
+	}{{receive.TXID, 1, initialReward - 1000}, {send.TXID, 2, -(initialReward - 1000)}}
+	if len(history) != len(want) {
+		t.Fatalf("交易记录有%d条，期望%d条", len(history), len(want))
+	}
+	for i, entry := range history {
+		if !bytes.Equal(entry.TXID, want[i].txid) || entry.Height != want[i].height || entry.Value != want[i].value {
+			t.Errorf("第%d条记录为%+v，期望高度%d金额%d", i, entry, want[i].height, want[i].value)
+		}
+		if entry.TimeStamp == 0 {
+			t.Errorf("第%d条记录没有时间", i)
+		}
+	}
+
+	//付款方的记录包括挖矿奖励
+	history, err = bc.AddressHistory(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Value != initialReward || history[1].Value != -initialReward || history[2].Value != initialReward-2000 {
+		t.Fatalf("付款方的交易记录为%+v", history)
+	}
+
+	if history, err := bc.AddressHistory(newTestWallet(t).getAddress(activeNetwork)); err != nil || len(history) != 0 {
+		t.Errorf("新地址的交易记录为%+v(%v)", history, err)
+	}
+	if _, err := bc.AddressHistory("invalid"); err == nil {
+		t.Error("无效地址应返回错误")
+	}
+}
+
+//创建指定时间的区块，接在最后一个区块之后
+func acceptTestBlockAt(t *testing.T, bc *BlockChain, txs []*Transaction, at time.Time) *Block {
+	t.Helper()
+	height, err := bc.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := NewBlock(txs, bc.tail, height+1)
+	block.TimeStamp = uint64(at.UnixNano())
+	block.Hash, block.Nonce = NewProofOfWork(block).Run()
+	if err := bc.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestCoinDaysDestroyed(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t)
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	//区块时间戳必须大于中位时间，且最多超前本地时间2小时
+	start := time.Now().Add(time.Minute)
+
+	//output在区块中存在90分钟后被花费
+	fund := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee.getAddress(activeNetwork), 1000)
+	acceptTestBlockAt(t, bc, []*Transaction{bc.NewCoinbaseTX(miner, "fund", 1), fund}, start)
+	spend := newTestSpend(t, payee, fund, 0, miner, 1000)
+	acceptTestBlockAt(t, bc, []*Transaction{bc.NewCoinbaseTX(miner, "spend", 2), spend}, start.Add(90*time.Minute))
+
+	cdd, err := bc.CoinDaysDestroyed(spend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(fund.TXOutputs[0].Value) / SatoshiPerBTC * 90 / (24 * 60); math.Abs(cdd-want) > 1e-9 {
+		t.Fatalf("销毁的币天数为%v，期望%v", cdd, want)
+	}
+
+	//未上链的交易计算到当前时间，output的区块时间晚于当前时间时年龄为0
+	pending := newTestSpend(t, w, spend, 0, miner, 1000)
+	if cdd, err := bc.CoinDaysDestroyed(pending); err != nil || cdd != 0 {
+		t.Fatalf("未上链交易销毁的币天数为%v(%v)，期望0", cdd, err)
+	}
+
+	if cdd, err := bc.CoinDaysDestroyed(bc.NewCoinbaseTX(miner, "", 3)); err != nil || cdd != 0 {
+		t.Errorf("挖矿交易销毁的币天数为%v(%v)，期望0", cdd, err)
+	}
+	missing := newTestSpend(t, w, bc.NewCoinbaseTX(miner, "missing", 3), 0, miner, 1000)
+	if _, err := bc.CoinDaysDestroyed(missing); err == nil {
+		t.Error("引用不存在的交易应返回错误")
+	}
+}
+
+func TestVerifyBlock(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+	newCoinbase := func(data string) *Transaction { return bc.NewCoinbaseTX(address, data, 1) }
+
+	spend := newTestSpend(t, w, coinbase, 0, payeeAddress, 1000)
+	//区块内花费前面交易创建的output
+	chained := newTestSpend(t, payee, spend, 0, address, 1000)
+	valid := NewBlock([]*Transaction{newCoinbase("valid"), spend, chained}, bc.tail, 1)
+	if err := bc.VerifyBlock(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	badMerkle := NewBlock([]*Transaction{newCoinbase("merkle"), spend}, bc.tail, 1)
+	badMerkle.MerkleRoot = append([]byte{}, badMerkle.MerkleRoot...)
+	badMerkle.MerkleRoot[0] ^= 1
+
+	invalid := map[string]*Block{
+		"两个挖矿交易":    NewBlock([]*Transaction{newCoinbase("1"), newCoinbase("2")}, bc.tail, 1),
+		"第一个不是挖矿交易": NewBlock([]*Transaction{spend, newCoinbase("last")}, bc.tail, 1),
+		"没有交易":      NewBlock(nil, bc.tail, 1),
+		"区块内双花":     NewBlock([]*Transaction{newCoinbase("double"), spend, newTestSpend(t, w, coinbase, 0, address, 2000)}, bc.tail, 1),
+		"梅克尔根无效":    badMerkle,
+		"花费顺序颠倒":    NewBlock([]*Transaction{newCoinbase("order"), chained, spend}, bc.tail, 1),
+		"前区块不是最后一个": NewBlock([]*Transaction{newCoinbase("prev"), spend}, []byte("other"), 1),
+	}
+	for name, block := range invalid {
+		if err := bc.VerifyBlock(block); err == nil {
+			t.Errorf("%s: 区块校验成功", name)
+		}
+	}
+
+	//已被消耗的output
+	if err := bc.AcceptBlock(valid); err != nil {
+		t.Fatal(err)
+	}
+	respend := NewBlock([]*Transaction{bc.NewCoinbaseTX(address, "respend", 2), spend}, bc.tail, 2)
+	if err := bc.VerifyBlock(respend); err == nil {
+		t.Error("花费已消耗output的区块校验成功")
+	}
+	if err := bc.AcceptBlock(respend); err == nil {
+		t.Error("接收了花费已消耗output的区块")
+	}
+}
+
+func TestIsAddressReused(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	once := w.getAddress(activeNetwork)
+	reused := newTestWallet(t).getAddress(activeNetwork)
+
+	//reused在三个区块的挖矿交易中收款
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, reused, fmt.Sprintf("reuse %d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if isReused, count := bc.IsAddressReused(once); isReused || count != 1 {
+		t.Fatalf("只收款一次的地址: %v %d", isReused, count)
+	}
+	if isReused, count := bc.IsAddressReused(reused); !isReused || count != 3 {
+		t.Fatalf("收款三次的地址: %v %d", isReused, count)
+	}
+	if isReused, count := bc.IsAddressReused(newTestWallet(t).getAddress(activeNetwork)); isReused || count != 0 {
+		t.Fatalf("未收款的地址: %v %d", isReused, count)
+	}
+	if isReused, count := bc.IsAddressReused("invalid"); isReused || count != 0 {
+		t.Fatalf("无效地址: %v %d", isReused, count)
+	}
+
+	//同一交易中的多个output只计一次
+	fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, 2 * SatoshiPerBTC, 3 * SatoshiPerBTC})
+	if isReused, count := bc.IsAddressReused(once); !isReused || count != 2 {
+		t.Fatalf("在两个交易中收款的地址: %v %d", isReused, count)
+	}
+}
+
+//获取主链上指定高度的区块
+func blockAtHeight(t *testing.T, bc *BlockChain, height uint64) *Block {
+	t.Helper()
+	it := bc.NewIterator()
+	for block := it.Next(); block != nil; block = it.Next() {
+		if block.Height == height {
+			return block
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	t.Fatalf("没有高度为%d的区块", height)
+	return nil
+}
+
+func TestBalanceByDepthTruncatedChain(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	addTestBlocks(t, bc, address, 2)
+	if _, _, _, err := bc.BalanceByDepth(address); err != nil {
+		t.Fatal(err)
+	}
+
+	//删除中间的区块，遍历账本时读不到该区块
+	hash := blockAtHeight(t, bc, 1).Hash
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(blockBucket)).Delete(hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := bc.BalanceByDepth(address); err == nil {
+		t.Fatal("区块缺失时应返回错误")
+	}
+}
+
+func TestAddBlockRejectsDoubleSpend(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	payeeHash, _ := GetPubKeyHashFromAddress(payee, activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	tx1 := newTestSpend(t, w, coinbase, 0, payee, 1000)
+	if err := bc.AddBlock([]*Transaction{bc.NewCoinbaseTX(address, "", 1), tx1}); err != nil {
+		t.Fatal(err)
+	}
+	balance := bc.utxoSet.Balance(payeeHash)
+
+	//再次花费已上链交易消耗的output（不经过交易池）
+	tx2 := newTestSpend(t, w, coinbase, 0, payee, 2000)
+	bc.AddBlock([]*Transaction{bc.NewCoinbaseTX(address, "", 2), tx2})
+	if _, ok := bc.TxBlockHeight(tx2.TXID); ok {
+		t.Fatal("双花交易不应上链")
+	}
+	if got := bc.utxoSet.Balance(payeeHash); got != balance {
+		t.Fatalf("收款人金额从%d变为%d", balance, got)
+	}
+	if err := bc.VerifyChain(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+/*
+	区块签名批量校验：
+		同步区块时签名校验是最耗时的部分。VerifyBlockSignatures先为区块中每个交易找到inputs引用的output
+		（UTXO集合中或区块内排在前面的交易），再由多个goroutine并行校验所有交易的签名。
+		同一交易的inputs共用签名数据缓存，因此以交易为单位分配给goroutine。
+		只校验签名，金额、锁定时间等由VerifyBlockTransactions校验。
+*/
+
+//VerifyBlockSignatures 并行校验区块中所有交易的签名，失败时返回区块中第一个失败的交易及input索引
+//utxo为区块连接之前的UTXO集合（调用者需持有区块链的锁）
+func VerifyBlockSignatures(block *Block, utxo *UTXOSet) error {
+	//交易在区块中的位置
+	positions := make(map[string]int)
+	for i, tx := range block.Transactions {
+		positions[string(tx.TXID)] = i
+	}
+
+	//为每个交易准备inputs引用的交易：区块内的交易直接使用，UTXO集合中的output放入只包含被引用output的交易
+	//（同一交易的output被多个交易引用时共用，校验开始后不再修改）
+	prevTXsList := make([]map[string]*Transaction, len(block.Transactions))
+	utxoTXs := make(map[string]*Transaction)
+	for i, tx := range block.Transactions {
+		if tx.isCoinBaseTX() {
+			continue
+		}
+		prevTXs := make(map[string]*Transaction)
+		for j, input := range tx.TXInputs {
+			if pos, ok := positions[string(input.TXID)]; ok {
+				if pos >= i {
+					return ErrOutOfOrderSpend
+				}
+				prevTXs[string(input.TXID)] = block.Transactions[pos]
+				continue
+			}
+			utxoInfo, ok := utxo.utxos[outpointKey(input.TXID, input.Index)]
+			if !ok {
+				return fmt.Errorf("交易%x的第%d个input引用的output不存在或已被消耗", tx.TXID, j)
+			}
+			prevTX, ok := utxoTXs[string(input.TXID)]
+			if !ok {
+				prevTX = &Transaction{TXID: input.TXID}
+				utxoTXs[string(input.TXID)] = prevTX
+			}
+			prevTXs[string(input.TXID)] = prevTX
+			for int64(len(prevTX.TXOutputs)) <= input.Index {
+				prevTX.TXOutputs = append(prevTX.TXOutputs, TXOutput{})
+			}
+			prevTX.TXOutputs[input.Index] = utxoInfo.TXOutput
+		}
+		prevTXsList[i] = prevTXs
+	}
+
+	//并行校验，每个交易的结果单独保存
+	errs := make([]error, len(block.Transactions))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = verifyInputSignatures(block.Transactions[i], prevTXsList[i])
+			}
+		}()
+	}
+	for i, tx := range block.Transactions {
+		if !tx.isCoinBaseTX() {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//校验交易所有input的签名，返回第一个失败的input
+func verifyInputSignatures(tx *Transaction, prevTXs map[string]*Transaction) error {
+	cache := newSigHashCache(tx, prevTXs)
+	for i, input := range tx.TXInputs {
+		output, err := prevOutput(input, prevTXs)
+		if err != nil {
+			return err
+		}
+		script, err := output.Script()
+		if err != nil {
+			return fmt.Errorf("交易%x的第%d个input: %v", tx.TXID, i, err)
+		}
+		if !script.CanUnlock(input, cache.sigHasher(i)) {
+			return fmt.Errorf("交易%x的第%d个input签名校验失败", tx.TXID, i)
+		}
+	}
+	return nil
+}
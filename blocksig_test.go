@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//创建包含n个交易的区块：每个交易花费prev的一个output（属于钱包w），prev的output都在返回的UTXO集合中
+func newSignedTestBlock(t testing.TB, w *Wallet, n int) (*Block, *UTXOSet, *Transaction) {
+	t.Helper()
+	address := w.getAddress(activeNetwork)
+	prev := &Transaction{TimeStamp: 1}
+	for i := 0; i < n; i++ {
+		output, err := NewTXOutput(address, 20000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev.TXOutputs = append(prev.TXOutputs, output)
+	}
+	if err := prev.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	utxo := NewUTXOSet()
+	for i, output := range prev.TXOutputs {
+		utxo.utxos[outpointKey(prev.TXID, int64(i))] = UTXOInfo{prev.TXID, int64(i), output}
+	}
+
+	txs := []*Transaction{newCoinbaseTX(address, "", 1, initialReward)}
+	for i := 0; i < n; i++ {
+		txs = append(txs, newTestSpend(t, w, prev, int64(i), address, 1000))
+	}
+	return NewBlock(txs, []byte("prev"), 1), utxo, prev
+}
+
+func TestVerifyBlockSignatures(t *testing.T) {
+	w := newTestWallet(t)
+	block, utxo, _ := newSignedTestBlock(t, w, 10)
+	if err := VerifyBlockSignatures(block, utxo); err != nil {
+		t.Fatal(err)
+	}
+
+	//花费区块内排在前面的交易创建的output
+	chained := newTestSpend(t, w, block.Transactions[1], 0, w.getAddress(activeNetwork), 1000)
+	block.Transactions = append(block.Transactions, chained)
+	if err := VerifyBlockSignatures(block, utxo); err != nil {
+		t.Fatal(err)
+	}
+
+	//返回第一个失败的交易及input索引
+	bad := block.Transactions[5]
+	bad.TXInputs[0].ScriptSign = append([]byte{}, bad.TXInputs[0].ScriptSign...)
+	bad.TXInputs[0].ScriptSign[10] ^= 1
+	block.Transactions[7].TXInputs[0].ScriptSign = nil
+	err := VerifyBlockSignatures(block, utxo)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%x", bad.TXID)) || !strings.Contains(err.Error(), "第0个input") {
+		t.Fatalf("返回%v，期望交易%x的第0个input校验失败", err, bad.TXID)
+	}
+
+	//引用区块内排在后面的交易
+	block, utxo, _ = newSignedTestBlock(t, w, 1)
+	parent := block.Transactions[1]
+	block.Transactions[1] = newTestSpend(t, w, parent, 0, w.getAddress(activeNetwork), 1000)
+	block.Transactions = append(block.Transactions, parent)
+	if err := VerifyBlockSignatures(block, utxo); err != ErrOutOfOrderSpend {
+		t.Fatalf("返回%v，期望%v", err, ErrOutOfOrderSpend)
+	}
+
+	//引用的output不在UTXO集合中
+	block, _, _ = newSignedTestBlock(t, w, 2)
+	if err := VerifyBlockSignatures(block, NewUTXOSet()); err == nil {
+		t.Fatal("引用不存在的output时应返回错误")
+	}
+}
+
+//500个交易的区块：逐个交易校验与并行批量校验
+func BenchmarkVerifyBlockSignatures(b *testing.B) {
+	w := newTestWallet(b)
+	block, utxo, prev := newSignedTestBlock(b, w, 500)
+	prevTXs := map[string]*Transaction{string(prev.TXID): prev}
+
+	b.Run("per-tx", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, tx := range block.Transactions {
+				if !tx.Verify(prevTXs) {
+					b.Fatal("交易校验失败")
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := VerifyBlockSignatures(block, utxo); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
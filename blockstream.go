@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+	区块的流式编码（用于在磁盘和网络上传输大区块）：
+		Serialize需要把整个区块编码到一个缓冲区中，区块很大时占用较多内存。
+		WriteTo先写区块头，再逐个写入交易，每个交易为长度前缀+交易的二进制格式（见EncodeBinary）；
+		ReadBlock按同样的顺序逐个读取交易，不需要先把整个区块读入内存。
+		格式：格式版本号 | 版本号 | 前区块哈希 | 梅克尔根 | 时间戳 | Bits | 随机数 | 区块哈希 | 高度 | 交易个数 | 每个交易的(长度, 数据)
+*/
+
+//区块流式编码的格式版本
+const blockStreamVersion uint64 = 1
+
+//流中单个交易的最大字节数：防止错误的长度前缀导致分配过多内存
+const maxStreamTxSize = 1 << 24
+
+//流中哈希值字段的最大字节数
+const maxStreamHashSize = 64
+
+//WriteTo 实现io.WriterTo：将区块流式写入w，返回写入的字节数
+func (b *Block) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	var header bytes.Buffer
+	writeUvarint(&header, blockStreamVersion)
+	writeUvarint(&header, b.Version)
+	writeBytes(&header, b.PrevHash)
+	writeBytes(&header, b.MerkleRoot)
+	writeUvarint(&header, b.TimeStamp)
+	writeUvarint(&header, b.Bits)
+	writeUvarint(&header, b.Nonce)
+	writeBytes(&header, b.Hash)
+	writeUvarint(&header, b.Height)
+	writeUvarint(&header, uint64(len(b.Transactions)))
+	if _, err := cw.Write(header.Bytes()); err != nil {
+		return cw.n, err
+	}
+
+	//每个交易单独编码，同一时间只有一个交易的数据在缓冲区中
+	for _, tx := range b.Transactions {
+		var buffer bytes.Buffer
+		writeBytes(&buffer, tx.EncodeBinary())
+		if _, err := cw.Write(buffer.Bytes()); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+//ReadBlock 从r中读取一个流式编码的区块（见WriteTo），不会读取区块之后的数据
+//r中没有数据时返回io.EOF，区块数据不完整时返回io.ErrUnexpectedEOF
+func ReadBlock(r io.Reader) (*Block, error) {
+	reader, ok := r.(streamReader)
+	if !ok {
+		reader = singleByteReader{r}
+	}
+
+	version, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version != blockStreamVersion {
+		return nil, fmt.Errorf("区块格式版本%d不支持", version)
+	}
+	block, err := readBlockBody(reader)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return block, err
+}
+
+//读取格式版本号之后的区块数据
+func readBlockBody(reader streamReader) (*Block, error) {
+	var b Block
+	var err error
+	if b.Version, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	if b.PrevHash, err = readStreamBytes(reader, maxStreamHashSize); err != nil {
+		return nil, err
+	}
+	if b.MerkleRoot, err = readStreamBytes(reader, maxStreamHashSize); err != nil {
+		return nil, err
+	}
+	if b.TimeStamp, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	if b.Bits, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	if b.Nonce, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	if b.Hash, err = readStreamBytes(reader, maxStreamHashSize); err != nil {
+		return nil, err
+	}
+	if b.Height, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		data, err := readStreamBytes(reader, maxStreamTxSize)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := DecodeBinaryTransaction(data)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个交易: %v", i, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return &b, nil
+}
+
+//从流中读取字节切片：长度+内容，长度不能超过max
+func readStreamBytes(reader streamReader, max uint64) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > max {
+		return nil, errors.New("数据长度无效")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+//可以逐字节读取的reader（读取变长整数需要）
+type streamReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+//逐字节读取：不预读，不会消耗区块之后的数据
+type singleByteReader struct {
+	io.Reader
+}
+
+func (r singleByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+//统计写入字节数的writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
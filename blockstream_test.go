@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+//包含挖矿交易和普通交易的区块
+func newStreamTestBlock(t *testing.T) *Block {
+	t.Helper()
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, 2 * SatoshiPerBTC})
+	return bc.NewIterator().Next()
+}
+
+func TestBlockStreamPipe(t *testing.T) {
+	block := newStreamTestBlock(t)
+
+	r, w := io.Pipe()
+	written := make(chan int64, 1)
+	go func() {
+		n, err := block.WriteTo(w)
+		w.CloseWithError(err)
+		written <- n
+	}()
+	got, err := ReadBlock(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Serialize(), block.Serialize()) {
+		t.Fatal("读取的区块与写入的区块不一致")
+	}
+	//区块之后没有数据
+	if _, err := ReadBlock(r); err != io.EOF {
+		t.Fatalf("读取结束后返回%v，期望io.EOF", err)
+	}
+
+	var buffer bytes.Buffer
+	if _, err := block.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-written; n != int64(buffer.Len()) {
+		t.Fatalf("WriteTo返回%d字节，实际写入%d字节", n, buffer.Len())
+	}
+}
+
+func TestBlockStreamConsecutive(t *testing.T) {
+	block := newStreamTestBlock(t)
+
+	//连续的两个区块：ReadBlock不会读取区块之后的数据
+	var buffer bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if _, err := block.WriteTo(&buffer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//MultiReader没有实现io.ByteReader，ReadBlock逐字节读取
+	r := io.MultiReader(&buffer)
+	for i := 0; i < 2; i++ {
+		got, err := ReadBlock(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Hash, block.Hash) {
+			t.Fatalf("第%d个区块不一致", i)
+		}
+	}
+}
+
+func TestBlockStreamTruncated(t *testing.T) {
+	block := newStreamTestBlock(t)
+	var buffer bytes.Buffer
+	if _, err := block.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	if _, err := ReadBlock(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("空数据返回%v，期望io.EOF", err)
+	}
+	for _, n := range []int{1, 10, len(data) / 2, len(data) - 1} {
+		r, w := io.Pipe()
+		go func(n int) {
+			w.Write(data[:n])
+			w.Close()
+		}(n)
+		if _, err := ReadBlock(r); err != io.ErrUnexpectedEOF {
+			t.Fatalf("截断到%d字节时返回%v，期望io.ErrUnexpectedEOF", n, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+	区块时间：
+		中位时间(MTP)：最后medianTimeBlocks个区块时间戳的中位数，单个矿工无法通过伪造时间戳操纵它。
+		新区块的时间戳必须大于中位时间，且不能比本地时间超前maxFutureBlockTime以上，
+		防止矿工通过调整时间戳提前解锁按时间锁定的交易。
+*/
+
+//计算中位时间使用的区块数
+const medianTimeBlocks = 11
+
+//区块时间戳最多比本地时间超前的时间
+const maxFutureBlockTime = 2 * time.Hour
+
+//MedianTimePast 最后medianTimeBlocks个区块时间戳的中位数（与Block.TimeStamp单位相同）
+func (bc *BlockChain) MedianTimePast() (uint64, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.medianTimePast()
+}
+
+func (bc *BlockChain) medianTimePast() (uint64, error) {
+	var timeStamps []uint64
+	it := bc.newIterator()
+	for len(timeStamps) < medianTimeBlocks {
+		block := it.Next()
+		if block == nil {
+			return 0, errors.New("读取区块失败")
+		}
+		timeStamps = append(timeStamps, block.TimeStamp)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	sort.Slice(timeStamps, func(i, j int) bool {
+		return timeStamps[i] < timeStamps[j]
+	})
+	return timeStamps[len(timeStamps)/2], nil
+}
+
+//检查连接在最后一个区块之后的区块的时间戳：必须大于中位时间，且不超过本地时间now加maxFutureBlockTime
+func (bc *BlockChain) checkBlockTime(block *Block, now time.Time) error {
+	mtp, err := bc.medianTimePast()
+	if err != nil {
+		return err
+	}
+	if block.TimeStamp <= mtp {
+		return fmt.Errorf("区块时间戳%d不大于中位时间%d", block.TimeStamp, mtp)
+	}
+	if block.TimeStamp > uint64(now.Add(maxFutureBlockTime).UnixNano()) {
+		return fmt.Errorf("区块时间戳%d超前本地时间过多", block.TimeStamp)
+	}
+	return nil
+}
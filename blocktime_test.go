@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockTimeMedianTimePast(t *testing.T) {
+	bc, _, cleanup := newTestChain(t)
+	defer cleanup()
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	start := time.Now()
+
+	//创世块和10个区块，时间戳依次增加1分钟，中位数为第6个区块
+	for i := 1; i <= 10; i++ {
+		txs := []*Transaction{bc.NewCoinbaseTX(miner, "", uint64(i))}
+		acceptTestBlockAt(t, bc, txs, start.Add(time.Duration(i)*time.Minute))
+	}
+	mtp, err := bc.MedianTimePast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(start.Add(5 * time.Minute).UnixNano()); mtp != want {
+		t.Fatalf("中位时间为%d，期望%d", mtp, want)
+	}
+
+	newBlockAt := func(timeStamp uint64) *Block {
+		block := NewBlock([]*Transaction{bc.NewCoinbaseTX(miner, "", 11)}, bc.tail, 11)
+		block.TimeStamp = timeStamp
+		block.Hash, block.Nonce = NewProofOfWork(block).Run()
+		return block
+	}
+	future := uint64(time.Now().Add(maxFutureBlockTime + time.Minute).UnixNano())
+	for name, timeStamp := range map[string]uint64{"等于中位时间": mtp, "小于中位时间": mtp - 1, "超前本地时间": future} {
+		block := newBlockAt(timeStamp)
+		if err := bc.VerifyBlock(block); err == nil {
+			t.Errorf("%s: 区块校验成功", name)
+		}
+		if err := bc.AcceptBlock(block); err == nil {
+			t.Errorf("%s: 区块被接收", name)
+		}
+	}
+
+	//略大于中位时间（早于最后一个区块）的区块可以上链
+	block := newBlockAt(mtp + 1)
+	if err := bc.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	//创世块不再参与计算，新区块的时间戳成为中位数
+	if got, err := bc.MedianTimePast(); err != nil || got != mtp+1 {
+		t.Fatalf("新区块上链后中位时间为%d(%v)，期望%d", got, err, mtp+1)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+/*
+	布隆过滤器（BIP37）：
+		轻节点把关心的数据（地址的公钥哈希、output位置）加入过滤器并发送给全节点，
+		全节点只转发与过滤器匹配的交易，轻节点不需要下载所有交易，全节点也无法确切知道轻节点的地址。
+		过滤器可能误判（把无关交易判为匹配），误判率在创建时指定，但不会漏判。
+		交易的output匹配时，该output的位置会被加入过滤器，之后花费它的交易同样匹配。
+*/
+
+//过滤器的最大字节数和最多的哈希函数个数
+const (
+	maxBloomFilterSize = 36000
+	maxBloomHashFuncs  = 50
+)
+
+//BloomFilter 布隆过滤器
+type BloomFilter struct {
+	bits      []byte //位数组
+	hashFuncs uint32 //哈希函数个数
+	tweak     uint32 //哈希种子的随机调整值：不同过滤器对同一数据使用不同的位
+}
+
+//NewBloomFilter 创建能容纳elements个元素、误判率为fpRate的布隆过滤器，tweak为哈希种子的调整值
+func NewBloomFilter(elements int, fpRate float64, tweak uint32) (*BloomFilter, error) {
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, errors.New("误判率必须在0和1之间")
+	}
+	if elements < 1 {
+		elements = 1
+	}
+
+	//位数 = -n*ln(p)/(ln2)^2，哈希函数个数 = 位数/n*ln2
+	size := int(-1 / (math.Ln2 * math.Ln2) * float64(elements) * math.Log(fpRate) / 8)
+	if size < 1 {
+		size = 1
+	}
+	if size > maxBloomFilterSize {
+		size = maxBloomFilterSize
+	}
+	hashFuncs := uint32(float64(size*8) / float64(elements) * math.Ln2)
+	if hashFuncs < 1 {
+		hashFuncs = 1
+	}
+	if hashFuncs > maxBloomHashFuncs {
+		hashFuncs = maxBloomHashFuncs
+	}
+
+	f := BloomFilter{
+		bits:      make([]byte, size),
+		hashFuncs: hashFuncs,
+		tweak:     tweak,
+	}
+	return &f, nil
+}
+
+//第i个哈希函数对应的位
+func (f *BloomFilter) bitIndex(i uint32, data []byte) uint32 {
+	return murmur3(i*0xfba4c795+f.tweak, data) % uint32(len(f.bits)*8)
+}
+
+//Add 把数据加入过滤器
+func (f *BloomFilter) Add(data []byte) {
+	for i := uint32(0); i < f.hashFuncs; i++ {
+		index := f.bitIndex(i, data)
+		f.bits[index/8] |= 1 << (index % 8)
+	}
+}
+
+//AddOutpoint 把output位置（交易ID+索引值）加入过滤器
+func (f *BloomFilter) AddOutpoint(txid []byte, index int64) {
+	f.Add(outpointBytes(txid, index))
+}
+
+//Contains 判断数据是否（可能）在过滤器中
+func (f *BloomFilter) Contains(data []byte) bool {
+	for i := uint32(0); i < f.hashFuncs; i++ {
+		index := f.bitIndex(i, data)
+		if f.bits[index/8]&(1<<(index%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//MatchesTransaction 判断交易是否与过滤器匹配：交易ID、output的锁定脚本数据（P2PKH为公钥哈希）或input引用的output位置在过滤器中
+//匹配的output的位置会被加入过滤器，使之后花费它的交易也能匹配
+func (f *BloomFilter) MatchesTransaction(tx *Transaction) bool {
+	matched := f.Contains(tx.TXID)
+	for i, output := range tx.TXOutputs {
+		if len(output.ScriptPubKeyHash) != 0 && f.Contains(output.ScriptPubKeyHash) {
+			matched = true
+			if output.isSpendable() {
+				f.AddOutpoint(tx.TXID, int64(i))
+			}
+		}
+	}
+	if matched || tx.isCoinBaseTX() {
+		return matched
+	}
+	for _, input := range tx.TXInputs {
+		if f.Contains(outpointBytes(input.TXID, input.Index)) {
+			return true
+		}
+	}
+	return false
+}
+
+//output位置的字节表示：交易ID + 索引值(8字节，小端)
+func outpointBytes(txid []byte, index int64) []byte {
+	data := make([]byte, len(txid)+8)
+	copy(data, txid)
+	binary.LittleEndian.PutUint64(data[len(txid):], uint64(index))
+	return data
+}
+
+//编码过滤器：哈希函数个数 | 调整值 | 位数组
+func encodeBloomFilter(f *BloomFilter) []byte {
+	var buffer bytes.Buffer
+	writeUvarint(&buffer, uint64(f.hashFuncs))
+	writeUvarint(&buffer, uint64(f.tweak))
+	writeBytes(&buffer, f.bits)
+	return buffer.Bytes()
+}
+
+//解码过滤器，拒绝超过大小限制的过滤器
+func decodeBloomFilter(data []byte) (*BloomFilter, error) {
+	reader := bytes.NewReader(data)
+	hashFuncs, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	tweak, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	filterBits, err := readBytes(reader)
+	if err != nil {
+		return nil, err
+	}
+	if hashFuncs < 1 || hashFuncs > maxBloomHashFuncs || tweak > math.MaxUint32 ||
+		len(filterBits) == 0 || len(filterBits) > maxBloomFilterSize || reader.Len() != 0 {
+		return nil, errors.New("布隆过滤器格式错误")
+	}
+	f := BloomFilter{
+		bits:      filterBits,
+		hashFuncs: uint32(hashFuncs),
+		tweak:     uint32(tweak),
+	}
+	return &f, nil
+}
+
+//MurmurHash3（32位）
+func murmur3(seed uint32, data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+
+	h := seed
+	blocks := len(data) / 4
+	for i := 0; i < blocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[blocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMurmur3(t *testing.T) {
+	for _, c := range []struct {
+		seed uint32
+		data string
+		want uint32
+	}{
+		{0, "", 0},
+		{1, "", 0x514e28b7},
+		{0xffffffff, "", 0x81f16f39},
+		{0, "\x00\x00\x00\x00", 0x2362f9de},
+		{0, "hello", 0x248bfa47},
+		{0, "Hello, world!", 0xc0363e43},
+	} {
+		if got := murmur3(c.seed, []byte(c.data)); got != c.want {
+			t.Errorf("murmur3(%x, %q) = %x，期望%x", c.seed, c.data, got, c.want)
+		}
+	}
+}
+
+//向公钥哈希支付的交易
+func newBloomTestTX(t *testing.T, pubKeyHash []byte, i int) *Transaction {
+	t.Helper()
+	txid := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: txid[:], Index: 0, Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 10000, ScriptType: ScriptP2PKH, ScriptPubKeyHash: pubKeyHash}},
+		TimeStamp: uint64(i),
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestBloomFilterMatchesTransaction(t *testing.T) {
+	const fpRate = 0.01
+	//容量包括地址和之后加入的output位置
+	filter, err := NewBloomFilter(10, fpRate, 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyHash := GetPubKeyHashFromPublicKey(newTestWallet(t).PublicKey)
+	filter.Add(pubKeyHash)
+
+	//支付给地址的交易匹配，花费该output的交易也匹配
+	pay := newBloomTestTX(t, pubKeyHash, 0)
+	if !filter.MatchesTransaction(pay) {
+		t.Fatal("支付给地址的交易不匹配")
+	}
+	spend := &Transaction{
+		TXInputs:  []TXInput{{TXID: pay.TXID, Index: 0, Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 9000, ScriptType: ScriptP2PKH, ScriptPubKeyHash: make([]byte, 20)}},
+	}
+	if err := spend.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.MatchesTransaction(spend) {
+		t.Fatal("花费匹配output的交易不匹配")
+	}
+
+	//无关交易的误判率接近创建时指定的误判率
+	const trials = 2000
+	matched := 0
+	for i := 1; i <= trials; i++ {
+		var data [4]byte
+		binary.BigEndian.PutUint32(data[:], uint32(i))
+		other := sha256.Sum256(data[:])
+		if filter.MatchesTransaction(newBloomTestTX(t, other[:20], i)) {
+			matched++
+		}
+	}
+	if matched > trials*fpRate*5 {
+		t.Fatalf("%d个无关交易中有%d个匹配", trials, matched)
+	}
+
+	if _, err := NewBloomFilter(10, 0, 0); err == nil {
+		t.Error("误判率为0时应返回错误")
+	}
+	if _, err := NewBloomFilter(10, 1, 0); err == nil {
+		t.Error("误判率为1时应返回错误")
+	}
+}
+
+func TestBloomFilterEncoding(t *testing.T) {
+	filter, err := NewBloomFilter(10, 0.001, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.Add([]byte("data"))
+	decoded, err := decodeBloomFilter(encodeBloomFilter(filter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.hashFuncs != filter.hashFuncs || decoded.tweak != filter.tweak || !bytes.Equal(decoded.bits, filter.bits) {
+		t.Fatal("解码后的过滤器不一致")
+	}
+	if !decoded.Contains([]byte("data")) {
+		t.Fatal("解码后的过滤器不包含已加入的数据")
+	}
+
+	var buffer bytes.Buffer
+	writeUvarint(&buffer, maxBloomHashFuncs+1)
+	writeUvarint(&buffer, 0)
+	writeBytes(&buffer, []byte{1})
+	if _, err := decodeBloomFilter(buffer.Bytes()); err == nil {
+		t.Error("哈希函数过多的过滤器应被拒绝")
+	}
+	buffer.Reset()
+	writeUvarint(&buffer, 1)
+	writeUvarint(&buffer, 0)
+	writeBytes(&buffer, make([]byte, maxBloomFilterSize+1))
+	if _, err := decodeBloomFilter(buffer.Bytes()); err == nil {
+		t.Error("过大的过滤器应被拒绝")
+	}
+}
+
+//加载了过滤器的节点只收到匹配的交易
+func TestRelayFilteredTransactions(t *testing.T) {
+	bc, _, cleanup := newTestChain(t)
+	defer cleanup()
+	n := NewNode(bc)
+	pubKeyHash := GetPubKeyHashFromPublicKey(newTestWallet(t).PublicKey)
+
+	//轻节点通过filterload加载过滤器
+	filter, err := NewBloomFilter(10, 0.0001, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.Add(pubKeyHash)
+	spvConn, spvRemote := net.Pipe()
+	fullConn, fullRemote := net.Pipe()
+	defer spvRemote.Close()
+	defer fullRemote.Close()
+	spv, full := &peer{conn: spvConn}, &peer{conn: fullConn}
+	n.peers["spv"], n.peers["full"] = spv, full
+	if err := n.handleMessage(spv, cmdFilterLoad, encodeBloomFilter(filter)); err != nil {
+		t.Fatal(err)
+	}
+
+	//读取发给节点的inv消息，超时返回nil
+	readInv := func(conn net.Conn) []byte {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		command, payload, err := readMessage(conn)
+		if err != nil {
+			return nil
+		}
+		inv, err := decodeInventory(payload)
+		if command != cmdInv || err != nil || len(inv.Hashes) != 1 {
+			t.Errorf("收到消息%s %x", command, payload)
+			return nil
+		}
+		return inv.Hashes[0]
+	}
+	//两个节点同时读取：relayTx依次写入各节点，写入会阻塞到对方读取
+	relay := func(tx *Transaction) (spvHash, fullHash []byte) {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			spvHash = readInv(spvRemote)
+		}()
+		go func() {
+			defer wg.Done()
+			fullHash = readInv(fullRemote)
+		}()
+		n.relayTx(tx, nil)
+		wg.Wait()
+		return
+	}
+
+	matching := newBloomTestTX(t, pubKeyHash, 1)
+	if spvHash, fullHash := relay(matching); !bytes.Equal(spvHash, matching.TXID) || !bytes.Equal(fullHash, matching.TXID) {
+		t.Fatal("匹配的交易没有转发给所有节点")
+	}
+	other := newBloomTestTX(t, make([]byte, 20), 2)
+	if spvHash, fullHash := relay(other); spvHash != nil || !bytes.Equal(fullHash, other.TXID) {
+		t.Fatal("不匹配的交易应只转发给没有过滤器的节点")
+	}
+
+	if err := n.handleMessage(spv, cmdFilterLoad, []byte{0}); err == nil {
+		t.Error("格式错误的过滤器应被拒绝")
+	}
+}
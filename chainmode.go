@@ -0,0 +1,43 @@
+package main
+
+import "math/big"
+
+//ChainMode 运行模式
+type ChainMode int
+
+const (
+	//ModeMainnet 主网
+	ModeMainnet ChainMode = iota
+	//ModeTestnet 测试网：使用测试网地址
+	ModeTestnet
+	//ModeRegtest 开发测试模式：使用测试网地址，挖矿难度极低（几乎立即出块），默认共识参数中挖矿奖励不需要等待成熟，
+	//可以使用MineTo和GenerateBlocks直接生成区块
+	ModeRegtest
+)
+
+//当前运行模式
+var activeMode = ModeMainnet
+
+//SetChainMode 设置运行模式并切换地址所属的网络，需要在创建钱包和打开区块链之前设置
+func SetChainMode(mode ChainMode) {
+	activeMode = mode
+	if mode == ModeMainnet {
+		activeNetwork = Mainnet
+	} else {
+		activeNetwork = Testnet
+	}
+}
+
+//默认难度目标值
+var defaultTarget, _ = new(big.Int).SetString("0001000000000000000000000000000000000000000000000000000000000000", 16)
+
+//开发测试模式的难度目标值：2^255，平均两次计算即可找到随机数
+var regtestTarget = new(big.Int).Lsh(big.NewInt(1), 255)
+
+//当前运行模式的难度目标值
+func powTarget() *big.Int {
+	if activeMode == ModeRegtest {
+		return new(big.Int).Set(regtestTarget)
+	}
+	return new(big.Int).Set(defaultTarget)
+}
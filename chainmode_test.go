@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestRegtestDisablesCoinbaseMaturity(t *testing.T) {
+	for _, c := range []struct {
+		mode     ChainMode
+		maturity int
+		wantErr  error
+	}{
+		{ModeMainnet, 100, ErrImmatureCoinbase},
+		{ModeRegtest, 0, nil},
+	} {
+		restore := useTestChainMode(c.mode)
+		bc, w, cleanup := newTestChainWithParams(t, DefaultChainParams())
+		address := w.getAddress(activeNetwork)
+		if got := bc.Params().CoinbaseMaturity; got != c.maturity {
+			cleanup()
+			restore()
+			t.Fatalf("模式%d: CoinbaseMaturity = %d，期望%d", c.mode, got, c.maturity)
+		}
+
+		//立即花费创世块的挖矿奖励
+		tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 1000)
+		err := bc.mempool.Add(tx)
+		_, _, immature, balanceErr := bc.BalanceByDepth(address)
+		cleanup()
+		restore()
+		if err != c.wantErr {
+			t.Fatalf("模式%d: 期望%v，实际为%v", c.mode, c.wantErr, err)
+		}
+		if balanceErr != nil {
+			t.Fatal(balanceErr)
+		}
+		if wantImmature := c.maturity != 0; (immature != 0) != wantImmature {
+			t.Fatalf("模式%d: 未成熟金额为%d", c.mode, immature)
+		}
+	}
+}
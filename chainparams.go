@@ -0,0 +1,43 @@
+package main
+
+//ChainParams 共识参数：每个区块链实例持有自己的参数，同一进程中的多条区块链互不影响
+type ChainParams struct {
+	InitialReward    int64  //初始挖矿奖励（聪）
+	HalvingInterval  uint64 //挖矿奖励减半的区块间隔（为0时不减半）
+	CoinbaseMaturity int    //挖矿交易的output需要经过的确认数才能花费（交易池和区块校验时检查）
+	MaxBlockSize     int    //区块序列化后的最大字节数
+}
+
+//初始挖矿奖励（12.5 BTC）
+const initialReward int64 = 12.5 * SatoshiPerBTC
+
+//DefaultChainParams 当前运行模式的默认共识参数（开发测试模式下挖矿奖励不需要等待成熟）
+func DefaultChainParams() ChainParams {
+	params := ChainParams{
+		InitialReward:    initialReward,
+		HalvingInterval:  210000,
+		CoinbaseMaturity: 100,
+		MaxBlockSize:     1000000,
+	}
+	if activeMode == ModeRegtest {
+		params.CoinbaseMaturity = 0
+	}
+	return params
+}
+
+//BlockReward 指定高度区块的挖矿奖励：每HalvingInterval个区块减半，直到为0
+func (p ChainParams) BlockReward(height uint64) int64 {
+	if p.HalvingInterval == 0 {
+		return p.InitialReward
+	}
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return p.InitialReward >> halvings
+}
+
+//Params 区块链的共识参数
+func (bc *BlockChain) Params() ChainParams {
+	return bc.params
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChainParams(t *testing.T) {
+	params := ChainParams{
+		InitialReward:    50 * SatoshiPerBTC,
+		HalvingInterval:  2,
+		CoinbaseMaturity: 1,
+		MaxBlockSize:     1000000,
+	}
+	bc, w, cleanup := newTestChainWithParams(t, params)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	if bc.Params() != params {
+		t.Fatalf("区块链的共识参数为%+v，期望%+v", bc.Params(), params)
+	}
+
+	//创世块和挖出的区块按区块链的参数获得奖励：高度0、1为50 BTC，高度2、3为25 BTC
+	for i := 0; i < 3; i++ {
+		if err := bc.MineBlock(address, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height, want := range []int64{50, 100, 125, 150} {
+		if got := bc.TotalSupply(uint64(height)); got != want*SatoshiPerBTC {
+			t.Errorf("高度%d的货币总量为%d，期望%d", height, got, want*SatoshiPerBTC)
+		}
+	}
+	if balance, err := bc.Balance(address); err != nil || balance != 150*SatoshiPerBTC {
+		t.Fatalf("金额为%d(%v)，期望%d", balance, err, 150*SatoshiPerBTC)
+	}
+	if coinbase := bc.NewCoinbaseTX(address, "", 4); coinbase.TXOutputs[0].Value != 12.5*SatoshiPerBTC {
+		t.Fatalf("高度4的挖矿奖励为%d", coinbase.TXOutputs[0].Value)
+	}
+	if err := bc.ValidateCoinbase(newCoinbaseTX(address, "", 2, 50*SatoshiPerBTC), 2, 0); err == nil {
+		t.Fatal("领取减半前奖励的挖矿交易应被拒绝")
+	}
+
+	//挖矿交易的output经过CoinbaseMaturity个确认后成熟
+	if _, _, immature, err := bc.BalanceByDepth(address); err != nil || immature != 0 {
+		t.Fatalf("未成熟金额为%d(%v)，期望0", immature, err)
+	}
+
+	//修改一条区块链的参数不影响默认参数
+	bc.params.InitialReward = 1
+	if DefaultChainParams().InitialReward != initialReward {
+		t.Fatal("默认共识参数被修改")
+	}
+}
+
+func TestCoinbaseMaturityEnforced(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	bc.params.CoinbaseMaturity = 3
+	address := w.getAddress(activeNetwork)
+
+	//创世块（高度0）的挖矿奖励在高度3才能花费
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 1000)
+	for height := uint64(1); height < 3; height++ {
+		if err := bc.mempool.Add(tx); err != ErrImmatureCoinbase {
+			t.Fatalf("高度%d: 期望ErrImmatureCoinbase，实际为%v", height, err)
+		}
+		block := &Block{Height: height, Transactions: []*Transaction{bc.NewCoinbaseTX(address, "", height), tx}}
+		if err := bc.VerifyBlockTransactions(block); err == nil || !strings.Contains(err.Error(), ErrImmatureCoinbase.Error()) {
+			t.Fatalf("高度%d: 区块应因挖矿交易未成熟被拒绝，实际为%v", height, err)
+		}
+		//打包时跳过未成熟的花费
+		if err := bc.AddBlock([]*Transaction{bc.NewCoinbaseTX(address, "", height), tx}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := bc.TxBlockHeight(tx.TXID); ok {
+			t.Fatalf("高度%d: 未成熟的花费不应上链", height)
+		}
+	}
+
+	if err := bc.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	if height, ok := bc.TxBlockHeight(tx.TXID); !ok || height != 3 {
+		t.Fatalf("交易应在高度3上链，实际为%d, %v", height, ok)
+	}
+}
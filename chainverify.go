@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+/*
+	区块链完整性自检：
+		程序崩溃或手工修改数据文件后，VerifyChain从最后一个区块回溯到创世块，校验每个区块的哈希、工作量证明、
+		与前区块的连接和高度；再从创世块开始按顺序重新校验每个区块的梅克尔根、挖矿交易、交易签名和金额、挖矿奖励，
+		并用一个新的UTXO集合检查双花；最后将重新构建的UTXO集合与当前的UTXO集合比较。
+		区块时间只在上链时校验（依赖当时的本地时间），自检时不再校验。
+*/
+
+//VerifyChain 校验整个区块链的一致性，发现问题时返回出错区块的高度和原因
+func (bc *BlockChain) VerifyChain() error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	if bc.prunedHeight() != 0 {
+		return errors.New("区块链已裁剪，无法校验")
+	}
+	if len(bc.tail) == 0 {
+		return nil
+	}
+
+	//从最后一个区块回溯到创世块
+	var blocks []*Block
+	hash := bc.tail
+	for {
+		block := bc.GetBlock(hash)
+		if block == nil {
+			if len(blocks) == 0 {
+				return fmt.Errorf("最后一个区块%x不存在", hash)
+			}
+			return fmt.Errorf("高度%d: 前区块%x不存在", blocks[len(blocks)-1].Height, hash)
+		}
+		if !bytes.Equal(block.Hash, hash) || !bytes.Equal(block.Hash, block.computeHash()) {
+			return fmt.Errorf("高度%d: 区块哈希无效", block.Height)
+		}
+		if !NewProofOfWork(block).IsValid() {
+			return fmt.Errorf("高度%d: 区块工作量证明无效", block.Height)
+		}
+		if len(blocks) != 0 && blocks[len(blocks)-1].Height != block.Height+1 {
+			return fmt.Errorf("高度%d: 区块高度与前区块不连续", blocks[len(blocks)-1].Height)
+		}
+		blocks = append(blocks, block)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+		hash = block.PrevHash
+	}
+	if genesis := blocks[len(blocks)-1]; genesis.Height != 0 {
+		return fmt.Errorf("高度%d: 区块没有前区块", genesis.Height)
+	}
+
+	//从创世块开始按顺序校验，同时重新构建UTXO集合
+	utxo := NewUTXOSet()
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		if err := checkBlockStructure(block); err != nil {
+			return fmt.Errorf("高度%d: %v", block.Height, err)
+		}
+		if err := bc.VerifyBlockTransactions(block); err != nil {
+			return fmt.Errorf("高度%d: %v", block.Height, err)
+		}
+		if err := checkBlockSpends(block, utxo); err != nil {
+			return fmt.Errorf("高度%d: %v", block.Height, err)
+		}
+		utxo.Update(block)
+	}
+
+	//比较重新构建的UTXO集合与当前的UTXO集合
+	tip := blocks[0]
+	if !bytes.Equal(bc.utxoSet.tip, tip.Hash) {
+		return fmt.Errorf("高度%d: UTXO集合对应的区块%x不是最后一个区块", tip.Height, bc.utxoSet.tip)
+	}
+	for key, info := range utxo.utxos {
+		current, ok := bc.utxoSet.utxos[key]
+		if !ok {
+			return fmt.Errorf("高度%d: UTXO集合缺少output %s", tip.Height, key)
+		}
+		if !utxoInfoEqual(info, current) {
+			return fmt.Errorf("高度%d: UTXO集合中的output %s与区块链不一致", tip.Height, key)
+		}
+	}
+	for key := range bc.utxoSet.utxos {
+		if _, ok := utxo.utxos[key]; !ok {
+			return fmt.Errorf("高度%d: UTXO集合中的output %s不存在或已被消耗", tip.Height, key)
+		}
+	}
+	return nil
+}
+
+//比较两个utxo的位置和output
+func utxoInfoEqual(a, b UTXOInfo) bool {
+	return bytes.Equal(a.TXID, b.TXID) && a.Index == b.Index && a.Value == b.Value &&
+		a.ScriptType == b.ScriptType && bytes.Equal(a.ScriptPubKeyHash, b.ScriptPubKeyHash)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+//不经过校验直接把区块写入账本作为最后一个区块，用于构造损坏的区块链
+func storeTestTip(t *testing.T, bc *BlockChain, block *Block) {
+	t.Helper()
+	block.Hash, block.Nonce = NewProofOfWork(block).Run()
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if err := bucket.Put(block.Hash, block.Serialize()); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(lastBlockHashKey), block.Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.tail = block.Hash
+	bc.utxoSet.Update(block)
+}
+
+//在区块链上追加n个只有挖矿交易的区块
+func addTestBlocks(t *testing.T, bc *BlockChain, miner string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, miner, fmt.Sprintf("block %d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	addTestBlocks(t, bc, w.getAddress(activeNetwork), 2)
+	fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC})
+
+	if err := bc.VerifyChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyChainBrokenLinkage(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	addTestBlocks(t, bc, address, 1)
+
+	//高度2的区块指向不存在的前区块
+	missing := bytes.Repeat([]byte{0xab}, 32)
+	storeTestTip(t, bc, NewBlock([]*Transaction{bc.NewCoinbaseTX(address, "broken", 2)}, missing, 2))
+
+	want := fmt.Sprintf("高度2: 前区块%x不存在", missing)
+	if err := bc.VerifyChain(); err == nil || err.Error() != want {
+		t.Fatalf("错误为%v，期望%s", err, want)
+	}
+}
+
+func TestVerifyChainInflatedCoinbase(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	addTestBlocks(t, bc, address, 1)
+
+	//高度2的挖矿交易领取两倍的挖矿奖励
+	coinbase := bc.NewCoinbaseTX(address, "inflated", 2)
+	coinbase.TXOutputs[0].Value *= 2
+	if err := coinbase.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	storeTestTip(t, bc, NewBlock([]*Transaction{coinbase}, bc.tail, 2))
+
+	want := fmt.Sprintf("高度2: 挖矿交易%x的金额超过挖矿奖励和手续费", coinbase.TXID)
+	if err := bc.VerifyChain(); err == nil || err.Error() != want {
+		t.Fatalf("错误为%v，期望%s", err, want)
+	}
+}
+
+func TestVerifyChainUTXOMismatch(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	addTestBlocks(t, bc, w.getAddress(activeNetwork), 1)
+
+	//从UTXO集合中删除创世块的挖矿奖励
+	key := outpointKey(genesisCoinbase(t, bc).TXID, 0)
+	delete(bc.utxoSet.utxos, key)
+
+	want := fmt.Sprintf("高度1: UTXO集合缺少output %s", key)
+	if err := bc.VerifyChain(); err == nil || err.Error() != want {
+		t.Fatalf("错误为%v，期望%s", err, want)
+	}
+}
@@ -17,19 +17,31 @@ Usage:
 	getbalance <address> "获取地址对应的金额"
 	print "打印区块链" 
 	send <from> <to> <amount> <miner> <data> "转账：付款人 收款人 转账金额 矿工 数据"
-	createwallet "创建钱包"
+	createwallet [ed25519] "创建钱包（默认使用ECDSA-P256签名）"
 	listaddress "获取所有钱包地址"
+	migratewallet "将旧版本的钱包文件升级到当前版本"
+	importkey <wif> "导入WIF格式私钥"
+	importaddress <address> "导入只读地址（只能查询金额，不能转账）"
+	exportkey <address> "导出地址对应的WIF格式私钥"
 	printtx "打印区块的所有交易"
+	decoderawtx <hex> "解析十六进制编码的交易"
+	reindex "重建所有索引"
+	verifychain "校验整个区块链的一致性"
+	prune <keepblocks> "裁剪区块链，保留最后keepblocks个区块的完整交易"
+	rpcserver <addr> "启动RPC服务，例如 rpcserver :8332"
+	startnode <addr> [peer...] "启动P2P节点并连接其他节点，例如 startnode :8333 127.0.0.1:8334"
 `
 
 //Run 解析用户输入命令的方法
 func (cli *CLI) Run() {
+	//命令行输出所有日志
+	SetLogger(NewStdLogger())
 
 	//获取输入参数
 	cmds := os.Args
 	if len(cmds) < 2 {
 		fmt.Println("请输入命令参数")
-		fmt.Println(Usage)
+		fmt.Print(Usage)
 		return
 	}
 
@@ -62,21 +74,106 @@ func (cli *CLI) Run() {
 		}
 		from := cmds[2]
 		to := cmds[3]
-		amount, _ := strconv.ParseFloat(cmds[4], 64)
+		amount, err := ParseAmount(cmds[4])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 		miner := cmds[5]
 		data := cmds[6]
-		cli.send(from, to, amount, miner, data)
+		cli.send(from, to, int64(amount), miner, data)
 	case "createwallet":
 		fmt.Println("创建钱包")
-		cli.createWallet()
+		scheme := SchemeECDSAP256
+		if len(cmds) == 3 {
+			if cmds[2] != "ed25519" {
+				fmt.Println("不支持的签名算法:", cmds[2])
+				return
+			}
+			scheme = SchemeEd25519
+		}
+		cli.createWallet(scheme)
 
 	case "listaddress":
 		fmt.Println("所有钱包地址")
 		cli.listAddresses()
 
+	case "migratewallet":
+		fmt.Println("升级钱包文件")
+		cli.migrateWallet()
+
+	case "importkey":
+		fmt.Println("导入私钥")
+		if len(cmds) != 3 {
+			fmt.Println("请输入WIF格式私钥")
+			return
+		}
+		cli.importKey(cmds[2])
+
+	case "importaddress":
+		fmt.Println("导入只读地址")
+		if len(cmds) != 3 {
+			fmt.Println("请输入地址")
+			return
+		}
+		cli.importAddress(cmds[2])
+
+	case "exportkey":
+		fmt.Println("导出私钥")
+		if len(cmds) != 3 {
+			fmt.Println("请输入地址")
+			return
+		}
+		cli.exportKey(cmds[2])
+
 	case "printtx":
 		fmt.Println("打印区块的所有交易")
 		cli.printTX()
+
+	case "decoderawtx":
+		fmt.Println("解析交易")
+		if len(cmds) != 3 {
+			fmt.Println("请输入十六进制编码的交易")
+			return
+		}
+		cli.decodeRawTX(cmds[2])
+
+	case "rpcserver":
+		fmt.Println("启动RPC服务")
+		if len(cmds) != 3 {
+			fmt.Println("请输入监听地址")
+			return
+		}
+		cli.rpcServer(cmds[2])
+
+	case "startnode":
+		fmt.Println("启动P2P节点")
+		if len(cmds) < 3 {
+			fmt.Println("请输入监听地址")
+			return
+		}
+		cli.startNode(cmds[2], cmds[3:])
+
+	case "reindex":
+		fmt.Println("重建所有索引")
+		cli.reindex()
+
+	case "verifychain":
+		fmt.Println("校验区块链")
+		cli.verifyChain()
+
+	case "prune":
+		fmt.Println("裁剪区块链")
+		if len(cmds) != 3 {
+			fmt.Println("请输入保留的区块数")
+			return
+		}
+		keepBlocks, err := strconv.Atoi(cmds[2])
+		if err != nil {
+			fmt.Println("保留的区块数无效")
+			return
+		}
+		cli.prune(keepBlocks)
 	default:
 		fmt.Println("输入参数错误")
 	}
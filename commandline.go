@@ -34,18 +34,16 @@ func (cli *CLI) getBalance(address string) {
 		fmt.Println(err)
 		return
 	}
-	//获得地址对应的公钥哈希
-	pubKeyHash := GetPubKeyHashFromAddress(address)
+	defer bc.db.Close()
 
-	//获取地址的utxo详情
-	utxoInfos := bc.FindMyUTXO(pubKeyHash)
-	//遍历累加金额
-	total := 0.0
-	for _, utxo := range utxoInfos {
-		total += utxo.TXOutput.Value
+	//从UTXO集合获取金额
+	total, err := bc.Balance(address)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
-	fmt.Printf("%s的金额为: %f\n", address, total)
+	fmt.Printf("%s的金额为: %f\n", address, float64(total)/SatoshiPerBTC)
 }
 
 //打印区块链
@@ -62,8 +60,13 @@ func (cli *CLI) printBlockChain() {
 	for {
 		//使用迭代器Next方法获取区块并移动游标
 		block := it.Next()
+		if block == nil {
+			fmt.Println("读取区块失败")
+			return
+		}
 		//打印区块链
 		fmt.Println("===============================")
+		fmt.Printf("Height: %d\n", block.Height)
 		fmt.Printf("Version: %d\n", block.Version)
 		fmt.Printf("PrevHash: %x\n", block.PrevHash)
 		fmt.Printf("MerkleRoot: %x\n", block.MerkleRoot)
@@ -85,7 +88,7 @@ func (cli *CLI) printBlockChain() {
 }
 
 //转账：每次转账时便添加一个区块
-func (cli *CLI) send(from string, to string, amount float64, miner string, data string) {
+func (cli *CLI) send(from string, to string, amount int64, miner string, data string) {
 	if !IsValidAddress(from) {
 		fmt.Println("传入from地址无效")
 		return
@@ -107,8 +110,19 @@ func (cli *CLI) send(from string, to string, amount float64, miner string, data
 	}
 	defer bc.db.Close()
 
+	//获取新区块的高度
+	height, err := bc.Height()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	//创建挖矿交易
-	coinbaseTX := NewCoinbaseTX(miner, data)
+	coinbaseTX := bc.NewCoinbaseTX(miner, data, height+1)
+	if coinbaseTX == nil {
+		fmt.Println("创建挖矿交易失败")
+		return
+	}
 
 	//创建交易集合，添加有效交易
 	txs := []*Transaction{coinbaseTX}
@@ -131,15 +145,15 @@ func (cli *CLI) send(from string, to string, amount float64, miner string, data
 }
 
 //创建钱包
-func (cli *CLI) createWallet() {
+func (cli *CLI) createWallet(scheme SchemeID) {
 	wm := NewWalletManager()
 	if wm == nil {
 		fmt.Println("打开钱包失败")
 		return
 	}
-	address := wm.createWallet()
-	if len(address) == 0 {
-		fmt.Println("创建钱包失败")
+	address, err := wm.createWalletWithScheme(scheme)
+	if err != nil {
+		fmt.Println("创建钱包失败:", err)
 		return
 	}
 	fmt.Println("创建钱包成功:", address)
@@ -152,10 +166,73 @@ func (cli *CLI) listAddresses() {
 		fmt.Println("打开钱包失败")
 		return
 	}
-	addresses := wm.listAddresses()
+	addresses := wm.Addresses()
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+	for _, address := range wm.WatchAddresses() {
+		fmt.Println(address, "(watch-only)")
+	}
+}
+
+//导入WIF格式私钥
+func (cli *CLI) importKey(wif string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	address, err := wm.ImportKey(wif)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("导入私钥成功:", address)
+}
+
+//升级钱包文件
+func (cli *CLI) migrateWallet() {
+	err := MigrateWallets(walletFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("升级钱包文件成功")
+}
+
+//导入只读地址
+func (cli *CLI) importAddress(address string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	err := wm.ImportAddress(address)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("导入只读地址成功:", address)
+}
+
+//导出地址对应的WIF格式私钥
+func (cli *CLI) exportKey(address string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	wallet, ok := wm.Wallets[address]
+	if !ok {
+		fmt.Println("未找到地址对应的私钥")
+		return
+	}
+	wif, err := wallet.ExportWIF()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(wif)
 }
 
 //打印区块的所有交易
@@ -172,6 +249,10 @@ func (cli *CLI) printTX() {
 
 	for {
 		block := it.Next()
+		if block == nil {
+			fmt.Println("读取区块失败")
+			return
+		}
 		fmt.Println("==============================")
 
 		for _, tx := range block.Transactions {
@@ -183,3 +264,134 @@ func (cli *CLI) printTX() {
 		}
 	}
 }
+
+//解析十六进制编码的交易
+func (cli *CLI) decodeRawTX(hexStr string) {
+	tx, err := DecodeRawTransaction(hexStr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(tx)
+
+	//区块链存在时计算手续费
+	var prevTXs map[string]*Transaction
+	if IsFileExist(blockChainDBFile) && !tx.isCoinBaseTX() {
+		bc, err := GetBlockChainInstance()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer bc.db.Close()
+		prevTXs, err = bc.GetPrevTXs(tx)
+		if err != nil {
+			fmt.Println("未找到引用的交易，无法计算手续费")
+		}
+	}
+	summary, err := tx.InspectWithPrevTXs(prevTXs)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(summary)
+}
+
+//重建所有索引
+func (cli *CLI) reindex() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	err = bc.ReindexAll()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("重建索引成功")
+}
+
+//校验整个区块链的一致性
+func (cli *CLI) verifyChain() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	err = bc.VerifyChain()
+	if err != nil {
+		fmt.Println("区块链校验失败:", err)
+		return
+	}
+	fmt.Println("区块链校验通过")
+}
+
+//裁剪区块链
+func (cli *CLI) prune(keepBlocks int) {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	err = bc.Prune(keepBlocks)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("裁剪区块链成功")
+}
+
+//启动RPC服务
+func (cli *CLI) rpcServer(addr string) {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	err = NewRPCServer(bc).ListenAndServe(addr)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//启动P2P节点
+func (cli *CLI) startNode(addr string, peers []string) {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	node := NewNode(bc)
+	listener, err := node.Listen(addr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer listener.Close()
+	fmt.Println("P2P节点启动:", addr)
+
+	for _, peer := range peers {
+		err := node.Connect(peer)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	//持续运行
+	select {}
+}
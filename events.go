@@ -0,0 +1,76 @@
+package main
+
+import "sync"
+
+/*
+	区块链事件订阅：
+		区块上链时发送EventNewBlock事件，交易加入交易池时发送EventNewMempoolTx事件。
+		每个订阅者有一个容量为eventBufferSize的缓冲通道，发送事件时不等待订阅者：
+		通道已满（订阅者处理过慢）时丢弃该订阅者的这个事件，区块链不会被阻塞。
+		事件在持有BlockChain.mux时发送，订阅者收到事件后可以调用区块链的方法。
+*/
+
+//ChainEventType 区块链事件类型
+type ChainEventType int
+
+const (
+	//EventNewBlock 新区块上链（Block为上链的区块）
+	EventNewBlock ChainEventType = iota
+	//EventNewMempoolTx 新交易加入交易池（Tx为加入的交易）
+	EventNewMempoolTx
+)
+
+//ChainEvent 区块链事件
+type ChainEvent struct {
+	Type  ChainEventType
+	Block *Block       //EventNewBlock事件的区块
+	Tx    *Transaction //EventNewMempoolTx事件的交易
+}
+
+//每个订阅者的事件缓冲区大小
+const eventBufferSize = 64
+
+//事件订阅者集合
+type eventFeed struct {
+	mux    sync.Mutex
+	nextID int
+	subs   map[int]chan ChainEvent
+}
+
+//Subscribe 订阅区块链事件，返回事件通道和取消订阅的函数（取消订阅后通道被关闭）
+func (bc *BlockChain) Subscribe() (<-chan ChainEvent, func()) {
+	feed := &bc.events
+	feed.mux.Lock()
+	defer feed.mux.Unlock()
+
+	if feed.subs == nil {
+		feed.subs = make(map[int]chan ChainEvent)
+	}
+	id := feed.nextID
+	feed.nextID++
+	ch := make(chan ChainEvent, eventBufferSize)
+	feed.subs[id] = ch
+
+	unsubscribe := func() {
+		feed.mux.Lock()
+		defer feed.mux.Unlock()
+		if ch, ok := feed.subs[id]; ok {
+			delete(feed.subs, id)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+//向所有订阅者发送事件，订阅者的缓冲区已满时丢弃
+func (feed *eventFeed) send(event ChainEvent) {
+	feed.mux.Lock()
+	defer feed.mux.Unlock()
+	for _, ch := range feed.subs {
+		select {
+		case ch <- event:
+		default:
+			logger.Warn("订阅者处理事件过慢，丢弃事件")
+		}
+	}
+}
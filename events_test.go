@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+//等待下一个事件
+func nextTestEvent(t *testing.T, events <-chan ChainEvent) ChainEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("事件通道已关闭")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到事件")
+	}
+	return ChainEvent{}
+}
+
+func TestSubscribe(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	events, unsubscribe := bc.Subscribe()
+
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 10000)
+	if err := bc.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextTestEvent(t, events); event.Type != EventNewMempoolTx || !event.Tx.Equals(tx) {
+		t.Fatalf("收到事件%+v，期望交易加入交易池", event)
+	}
+
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextTestEvent(t, events); event.Type != EventNewBlock || !bytes.Equal(event.Block.Hash, bc.tail) {
+		t.Fatalf("收到事件%+v，期望新区块", event)
+	}
+
+	//取消订阅后通道被关闭，不再收到事件
+	unsubscribe()
+	if event, ok := <-events; ok {
+		t.Fatalf("取消订阅后收到事件%+v", event)
+	}
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe()
+}
+
+func TestSubscribeSlowConsumer(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	slow, unsubscribeSlow := bc.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := bc.Subscribe()
+	defer unsubscribeFast()
+
+	//不读取事件的订阅者不会阻塞区块链，超出缓冲区的事件被丢弃
+	received := make(chan int)
+	go func() {
+		count := 0
+		for range fast {
+			count++
+		}
+		received <- count
+	}()
+	for i := 0; i < eventBufferSize+10; i++ {
+		if err := bc.MineBlock(w.getAddress(activeNetwork), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(slow) != eventBufferSize {
+		t.Fatalf("缓冲区中有%d个事件，期望%d个", len(slow), eventBufferSize)
+	}
+	unsubscribeFast()
+	if count := <-received; count != eventBufferSize+10 {
+		t.Fatalf("及时读取的订阅者收到%d个事件，期望%d个", count, eventBufferSize+10)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+//FallbackFeeRate 没有手续费历史时使用的手续费率（聪/字节）
+var FallbackFeeRate int64 = 1
+
+//手续费估算采样的区块数
+const feeEstimateBlocks = 10
+
+//EstimateFeeRate 估算交易在targetBlocks个区块内被确认所需的手续费率（聪/字节）
+//统计最近区块中交易的手续费率，目标区块数越小，取越高的百分位
+func (bc *BlockChain) EstimateFeeRate(targetBlocks int) (int64, error) {
+	if targetBlocks < 1 {
+		return 0, errors.New("目标区块数必须大于0")
+	}
+
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	//最近区块中交易的手续费率
+	var rates []int64
+	it := bc.newIterator()
+	for i := 0; i < feeEstimateBlocks; i++ {
+		block := it.Next()
+		if block == nil {
+			return 0, errors.New("读取区块失败")
+		}
+		for _, tx := range block.Transactions {
+			if tx.isCoinBaseTX() {
+				continue
+			}
+			prevTXs, err := bc.GetPrevTXs(tx)
+			if err != nil {
+				continue
+			}
+			rate, err := tx.FeeRate(prevTXs)
+			if err != nil {
+				continue
+			}
+			rates = append(rates, rate)
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	if len(rates) == 0 {
+		return FallbackFeeRate, nil
+	}
+
+	//目标为1个区块时取第90百分位，每多1个区块降低10个百分点，最低取第10百分位
+	percentile := 90 - (targetBlocks-1)*10
+	if percentile < 10 {
+		percentile = 10
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	rate := rates[(len(rates)-1)*percentile/100]
+	if rate < FallbackFeeRate {
+		rate = FallbackFeeRate
+	}
+	return rate, nil
+}
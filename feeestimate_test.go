@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEstimateFeeRate(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	//只有创世块时使用默认手续费率
+	if rate, err := bc.EstimateFeeRate(1); err != nil || rate != FallbackFeeRate {
+		t.Fatalf("手续费率为%d(%v)，期望%d", rate, err, FallbackFeeRate)
+	}
+	if _, err := bc.EstimateFeeRate(0); err == nil {
+		t.Fatal("目标区块数为0时应返回错误")
+	}
+
+	//最近10个区块各包含一个交易，手续费率为10、20、...、100聪/字节
+	var values []int64
+	for i := 0; i < 10; i++ {
+		values = append(values, SatoshiPerBTC)
+	}
+	fund := fundTestOutputs(t, bc, w, values)
+	for i := 0; i < 10; i++ {
+		fee := int64((i+1)*10) * int64(EstimateSize(1, 1))
+		tx := newTestSpend(t, w, fund, int64(i), address, fee)
+		if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, ""), tx}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		targetBlocks int
+		min, max     int64
+	}{
+		{1, 80, 100}, //第90百分位
+		{5, 40, 60},  //第50百分位
+		{20, 5, 15},  //第10百分位
+	}
+	for _, tt := range tests {
+		rate, err := bc.EstimateFeeRate(tt.targetBlocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate < tt.min || rate > tt.max {
+			t.Errorf("%d个区块内确认的手续费率为%d，期望在%d到%d之间", tt.targetBlocks, rate, tt.min, tt.max)
+		}
+	}
+	fast, _ := bc.EstimateFeeRate(1)
+	slow, _ := bc.EstimateFeeRate(10)
+	if fast < slow {
+		t.Fatalf("目标区块数越小手续费率应越高: %d < %d", fast, slow)
+	}
+}
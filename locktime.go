@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+	锁定时间：
+		交易的LockTime不为0时，交易只能被打包进高度（或时间）大于LockTime的区块，
+		所有input的序列号都为SequenceFinal时忽略LockTime。
+		时间锁定output（CLTV）：只有LockTime不小于解锁时间的交易才能花费该output，
+		结合交易的锁定时间，output在解锁时间之前无法被花费。
+*/
+
+//LockTimeThreshold 锁定时间小于该值时表示区块高度，否则表示Unix时间（秒）
+const LockTimeThreshold = 500000000
+
+//IsFinal 判断交易能否被打包进指定高度和时间的区块
+func (tx *Transaction) IsFinal(height uint64, blockTime uint64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	limit := height
+	if tx.LockTime >= LockTimeThreshold {
+		limit = blockTime
+	}
+	if tx.LockTime < limit {
+		return true
+	}
+	//所有input的序列号都为最大值时，锁定时间不生效
+	for _, input := range tx.TXInputs {
+		if input.Sequence != SequenceFinal {
+			return false
+		}
+	}
+	return true
+}
+
+//判断交易的锁定时间是否达到output的解锁时间
+func (tx *Transaction) lockTimeReached(input TXInput, unlockTime uint64) bool {
+	//锁定时间与解锁时间必须同为区块高度或同为Unix时间
+	if (tx.LockTime < LockTimeThreshold) != (unlockTime < LockTimeThreshold) {
+		return false
+	}
+	if tx.LockTime < unlockTime {
+		return false
+	}
+	//序列号为最大值时交易的锁定时间不生效
+	return input.Sequence != SequenceFinal
+}
+
+//LockTimeScript 需要检查花费交易锁定时间的锁定脚本
+type LockTimeScript interface {
+	Script
+	//UnlockTime 解锁时间：区块高度或Unix时间（秒）
+	UnlockTime() uint64
+}
+
+//时间锁定：解锁时间之后才能由公钥哈希对应的私钥花费
+type timeLockScript struct {
+	unlockTime uint64
+	p2pkhScript
+}
+
+//锁定脚本数据：解锁时间(8字节) + 公钥哈希
+func parseTimeLockScript(lockData []byte) (Script, error) {
+	if len(lockData) != 8+20 {
+		return nil, errors.New("时间锁定脚本长度无效")
+	}
+	s := timeLockScript{
+		unlockTime:  binary.LittleEndian.Uint64(lockData[:8]),
+		p2pkhScript: p2pkhScript{lockData[8:]},
+	}
+	return &s, nil
+}
+
+func (s *timeLockScript) Lock() []byte {
+	var buffer bytes.Buffer
+	buffer.Write(UintToByteSlice(s.unlockTime))
+	buffer.Write(s.pubKeyHash)
+	return buffer.Bytes()
+}
+
+func (s *timeLockScript) UnlockTime() uint64 {
+	return s.unlockTime
+}
+
+//NewTimeLockedTXOutput 创建时间锁定的output：解锁时间为区块高度或Unix时间（秒）
+func NewTimeLockedTXOutput(address string, amount int64, unlockTime uint64) (TXOutput, error) {
+	output, err := NewTXOutput(address, amount)
+	if err != nil {
+		return output, err
+	}
+	script := timeLockScript{unlockTime, p2pkhScript{output.ScriptPubKeyHash}}
+	output.ScriptType = ScriptTimeLock
+	output.ScriptPubKeyHash = script.Lock()
+	return output, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+//创建花费时间锁定output的交易，锁定时间为lockTime
+func newLockTimeTestTX(t *testing.T, w *Wallet, prev *Transaction, lockTime uint64, sequence uint32) *Transaction {
+	t.Helper()
+	output, err := NewTXOutput(w.getAddress(activeNetwork), SatoshiPerBTC-10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: prev.TXID, Index: 0, PubKey: w.PublicKey, Sequence: sequence}},
+		TXOutputs: []TXOutput{output},
+		TimeStamp: 1600000600,
+		LockTime:  lockTime,
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, map[string]*Transaction{string(prev.TXID): prev})
+	return tx
+}
+
+func TestTimeLockedOutput(t *testing.T) {
+	w := newTestWallet(t)
+	vesting, err := NewTimeLockedTXOutput(w.getAddress(activeNetwork), SatoshiPerBTC, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := &Transaction{
+		TXInputs:  []TXInput{{Index: -1, PubKey: []byte("vesting"), Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{vesting},
+		TimeStamp: 1600000000,
+	}
+	prev.setHash()
+	prevTXs := map[string]*Transaction{string(prev.TXID): prev}
+
+	tests := []struct {
+		name     string
+		lockTime uint64
+		sequence uint32
+		valid    bool
+	}{
+		{"解锁高度之前", 999, MaxRBFSequence, false},
+		{"到达解锁高度", 1000, MaxRBFSequence, true},
+		{"解锁高度之后", 5000, MaxRBFSequence, true},
+		{"锁定时间不生效", 1000, SequenceFinal, false},
+		{"锁定时间为Unix时间", LockTimeThreshold + 1000, MaxRBFSequence, false},
+	}
+	for _, tt := range tests {
+		tx := newLockTimeTestTX(t, w, prev, tt.lockTime, tt.sequence)
+		if got := tx.Verify(prevTXs); got != tt.valid {
+			t.Errorf("%s: 校验结果为%v，期望%v", tt.name, got, tt.valid)
+		}
+	}
+
+	//锁定时间为1000的交易只能打包进高度大于1000的区块
+	tx := newLockTimeTestTX(t, w, prev, 1000, MaxRBFSequence)
+	if tx.IsFinal(1000, 0) {
+		t.Error("交易不能打包进高度为1000的区块")
+	}
+	if !tx.IsFinal(1001, 0) {
+		t.Error("交易可以打包进高度为1001的区块")
+	}
+}
+
+func TestMempoolRejectsNonFinal(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	coinbase := genesisCoinbase(t, bc)
+
+	tx := newTestSpend(t, w, coinbase, 0, w.getAddress(activeNetwork), 10000)
+	tx.LockTime = 1000
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, map[string]*Transaction{string(coinbase.TXID): coinbase})
+	if err := bc.mempool.Add(tx); err == nil {
+		t.Fatal("未到锁定时间的交易不应加入交易池")
+	}
+	block := &Block{Height: 1, Transactions: []*Transaction{bc.NewCoinbaseTX(w.getAddress(activeNetwork), "", 1), tx}}
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("包含未到锁定时间交易的区块应被拒绝")
+	}
+}
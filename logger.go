@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+)
+
+//Logger 日志接口：库代码的所有输出都通过Logger，默认不输出任何内容
+type Logger interface {
+	Debug(v ...interface{}) //调试信息
+	Info(v ...interface{})  //一般信息
+	Warn(v ...interface{})  //校验失败等可恢复的问题
+	Error(v ...interface{}) //错误
+}
+
+//不输出任何内容的日志
+type nopLogger struct{}
+
+func (nopLogger) Debug(v ...interface{}) {}
+func (nopLogger) Info(v ...interface{})  {}
+func (nopLogger) Warn(v ...interface{})  {}
+func (nopLogger) Error(v ...interface{}) {}
+
+//输出到标准输出的日志（命令行使用）
+type stdLogger struct{}
+
+func (stdLogger) Debug(v ...interface{}) { fmt.Println(v...) }
+func (stdLogger) Info(v ...interface{})  { fmt.Println(v...) }
+func (stdLogger) Warn(v ...interface{})  { fmt.Println(v...) }
+func (stdLogger) Error(v ...interface{}) { fmt.Println(v...) }
+
+//当前使用的日志
+var logger Logger = nopLogger{}
+
+//SetLogger 设置区块链、交易和钱包使用的日志，传入nil时不输出日志
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+}
+
+//NewStdLogger 创建输出到标准输出的日志
+func NewStdLogger() Logger {
+	return stdLogger{}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//记录所有日志的Logger
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) Debug(v ...interface{}) { l.lines = append(l.lines, fmt.Sprint(v...)) }
+func (l *recordLogger) Info(v ...interface{})  { l.lines = append(l.lines, fmt.Sprint(v...)) }
+func (l *recordLogger) Warn(v ...interface{})  { l.lines = append(l.lines, fmt.Sprint(v...)) }
+func (l *recordLogger) Error(v ...interface{}) { l.lines = append(l.lines, fmt.Sprint(v...)) }
+
+//执行一次完整的签名、校验和上链过程
+func runSignVerifyCycle(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, newTestWallet(t).getAddress(activeNetwork), 10000)
+	if !bc.VerifyTransaction(tx) {
+		t.Fatal("交易校验失败")
+	}
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, w.getAddress(activeNetwork), ""), tx}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultLoggerSilent(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(nil)
+
+	//将标准输出重定向到管道
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := make(chan []byte)
+	go func() {
+		output, _ := ioutil.ReadAll(reader)
+		outputs <- output
+	}()
+	stdout := os.Stdout
+	os.Stdout = writer
+	func() {
+		defer func() { os.Stdout = stdout }()
+		runSignVerifyCycle(t)
+	}()
+	writer.Close()
+
+	if output := <-outputs; len(output) != 0 {
+		t.Fatalf("默认日志不应输出任何内容，实际输出:\n%s", output)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(logger)
+	l := &recordLogger{}
+	SetLogger(l)
+
+	runSignVerifyCycle(t)
+	if len(l.lines) == 0 {
+		t.Fatal("设置的日志没有收到任何内容")
+	}
+}
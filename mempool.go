@@ -0,0 +1,454 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+//Mempool 交易池：保存尚未被打包进区块的交易（由区块链的锁保护）
+type Mempool struct {
+	bc         *BlockChain              //区块链：用于查找交易引用的output
+	entries    map[string]*mempoolEntry //交易池中的交易（key为交易ID）
+	spent      map[string]string        //已被交易池中交易使用的output（key为output位置，value为使用它的交易ID）
+	bytes      int                      //交易池中所有交易的字节数
+	minFeeRate int64                    //最低手续费率（聪/字节）：交易池满时被驱逐交易的手续费率
+}
+
+//MaxMempoolBytes 交易池中交易的最大总字节数，超过时驱逐手续费率最低的交易
+var MaxMempoolBytes = 300 << 20
+
+//MempoolTTL 交易在交易池中的最长保留时间（从加入交易池开始计算）
+var MempoolTTL = 14 * 24 * time.Hour
+
+//MinRelayFeeRate 交易池接受和转发交易的最低手续费率（聪/字节），0表示不限制
+//与交易池是否已满无关，用于防止低手续费交易占用网络
+var MinRelayFeeRate int64
+
+//ErrBelowRelayFee 交易手续费率低于最低转发手续费率
+var ErrBelowRelayFee = errors.New("交易手续费率低于最低转发手续费率")
+
+//交易池中的交易
+type mempoolEntry struct {
+	tx    *Transaction //交易本身
+	fee   int64        //手续费：inputs总额-outputs总额
+	size  int          //交易序列化后的字节数
+	added time.Time    //交易加入交易池的时间
+}
+
+//手续费率（聪/字节）
+func (e *mempoolEntry) feeRate() float64 {
+	return float64(e.fee) / float64(e.size)
+}
+
+//NewMempool 创建交易池
+func NewMempool(bc *BlockChain) *Mempool {
+	m := Mempool{
+		bc:      bc,
+		entries: make(map[string]*mempoolEntry),
+		spent:   make(map[string]string),
+	}
+	return &m
+}
+
+//output位置：交易ID+索引值
+func outpointKey(txid []byte, index int64) string {
+	return fmt.Sprintf("%x:%d", txid, index)
+}
+
+//ErrTxInMempool 交易已存在于交易池
+var ErrTxInMempool = errors.New("交易已存在于交易池")
+
+//Add 向交易池添加交易
+//如果新交易与池中交易使用了相同的output，只有被替换的交易可替换(RBF)且新交易手续费更高时才能替换
+func (m *Mempool) Add(tx *Transaction) error {
+	m.bc.mux.Lock()
+	defer m.bc.mux.Unlock()
+	return m.add(tx)
+}
+
+func (m *Mempool) add(tx *Transaction) error {
+	if tx.isCoinBaseTX() {
+		return errors.New("挖矿交易不能加入交易池")
+	}
+	//交易结构必须有效（不能重复引用同一个output）
+	if err := tx.CheckSanity(); err != nil {
+		return err
+	}
+	//交易ID必须与交易内容一致
+	if err := tx.checkTXID(); err != nil {
+		return err
+	}
+	//重复提交的交易不再校验
+	if entry, ok := m.entries[string(tx.TXID)]; ok {
+		if entry.tx.Equals(tx) {
+			return ErrTxInMempool
+		}
+		return errors.New("交易池中已有交易ID相同但签名数据不同的交易")
+	}
+
+	//交易必须能被打包进下一个区块
+	height, err := m.bc.height()
+	if err != nil {
+		return err
+	}
+	if !tx.IsFinal(height+1, uint64(time.Now().Unix())) {
+		return errors.New("交易未到锁定时间")
+	}
+
+	//找到交易引用的所有交易（交易池或账本中）
+	prevTXs, err := m.findPrevTXs(tx)
+	if err != nil {
+		return err
+	}
+	//引用的output必须未被消耗：在UTXO集合中，或由交易池中的交易创建（与交易池中交易的冲突按下面的替换规则处理）
+	for _, input := range tx.TXInputs {
+		key := outpointKey(input.TXID, input.Index)
+		if _, ok := m.bc.utxoSet.utxos[key]; ok {
+			continue
+		}
+		if parent, ok := m.entries[string(input.TXID)]; ok && parent.tx.TXOutputs[input.Index].isSpendable() {
+			continue
+		}
+		return fmt.Errorf("交易%x引用的output %s不存在或已被消耗", tx.TXID, key)
+	}
+	//校验签名
+	if !tx.Verify(prevTXs) {
+		return errors.New("交易签名校验失败")
+	}
+	//花费的挖矿交易output在下一个区块中必须已成熟
+	if err := m.bc.checkCoinbaseMaturity(tx, prevTXs, height+1); err != nil {
+		return err
+	}
+
+	//计算手续费
+	fee, err := txFee(tx, prevTXs)
+	if err != nil {
+		return err
+	}
+	if fee < 0 {
+		return errors.New("交易输出金额大于输入金额")
+	}
+
+	//手续费率不能低于最低转发手续费率（等于时接受）
+	entry := &mempoolEntry{tx, fee, tx.SerializedSize(), time.Now()}
+	if fee < MinRelayFeeRate*int64(entry.size) {
+		return ErrBelowRelayFee
+	}
+
+	//交易池已满时，手续费率必须不低于最低手续费率
+	if entry.feeRate() < float64(m.minFeeRate) {
+		return errors.New("交易手续费率低于交易池最低手续费率")
+	}
+
+	//找到与新交易冲突（使用了相同output）的交易
+	conflicts := make(map[string]bool)
+	for _, input := range tx.TXInputs {
+		if txid, ok := m.spent[outpointKey(input.TXID, input.Index)]; ok {
+			conflicts[txid] = true
+		}
+	}
+
+	replaced := make(map[string]bool)
+	if len(conflicts) != 0 {
+		//被替换的交易必须声明可替换
+		for txid := range conflicts {
+			if !m.entries[txid].tx.isReplaceable() {
+				return errors.New("交易池中存在冲突交易且该交易不可替换")
+			}
+		}
+		//被替换的交易及其后代交易都将被移除，新交易的手续费必须高于它们的手续费总和
+		replaced = m.withDescendants(conflicts)
+		var replacedFee int64
+		for txid := range replaced {
+			replacedFee += m.entries[txid].fee
+		}
+		if fee <= replacedFee {
+			return errors.New("替换交易的手续费必须高于被替换交易")
+		}
+	}
+
+	//交易池已满时先确定需要驱逐的交易：新交易自身会被驱逐时直接拒绝，交易池保持不变
+	evicted, minFeeRate, ok := m.planTrim(entry, replaced)
+	if !ok {
+		return errors.New("交易池已满，交易手续费率过低")
+	}
+	for txid := range replaced {
+		m.remove(txid)
+	}
+
+	//加入交易池
+	m.entries[string(tx.TXID)] = entry
+	m.bytes += entry.size
+	for _, input := range tx.TXInputs {
+		m.spent[outpointKey(input.TXID, input.Index)] = string(tx.TXID)
+	}
+
+	//驱逐手续费率最低的交易
+	for txid := range evicted {
+		m.remove(txid)
+	}
+	m.minFeeRate = minFeeRate
+	m.bc.events.send(ChainEvent{Type: EventNewMempoolTx, Tx: tx})
+	return nil
+}
+
+//Size 交易池中的交易个数
+func (m *Mempool) Size() int {
+	m.bc.mux.RLock()
+	defer m.bc.mux.RUnlock()
+	return len(m.entries)
+}
+
+//Bytes 交易池中所有交易的字节数
+func (m *Mempool) Bytes() int {
+	m.bc.mux.RLock()
+	defer m.bc.mux.RUnlock()
+	return m.bytes
+}
+
+//MinFeeRate 交易池接受新交易的最低手续费率（聪/字节）
+func (m *Mempool) MinFeeRate() int64 {
+	m.bc.mux.RLock()
+	defer m.bc.mux.RUnlock()
+	return m.minFeeRate
+}
+
+//计算新交易entry加入交易池（同时移除被替换的交易replaced）后需要驱逐的交易：超过MaxMempoolBytes时，
+//依次驱逐手续费率最低的交易及其后代交易，并提高最低手续费率；新交易会被驱逐时返回false
+//只计算不修改交易池，返回被驱逐的交易和新的最低手续费率
+func (m *Mempool) planTrim(entry *mempoolEntry, replaced map[string]bool) (map[string]bool, int64, bool) {
+	evicted := make(map[string]bool)
+	minFeeRate := m.minFeeRate
+	size := m.bytes + entry.size
+	for txid := range replaced {
+		size -= m.entries[txid].size
+	}
+
+	for size > MaxMempoolBytes {
+		//手续费率相同时先驱逐新交易
+		lowest := entry
+		for txid, e := range m.entries {
+			if !replaced[txid] && !evicted[txid] && e.feeRate() < lowest.feeRate() {
+				lowest = e
+			}
+		}
+		if lowest == entry {
+			return nil, 0, false
+		}
+		//新交易的手续费率必须高于被驱逐的交易
+		rate := int64(math.Ceil(lowest.feeRate()))
+		if rate <= int64(lowest.feeRate()) {
+			rate++
+		}
+		if rate > minFeeRate {
+			minFeeRate = rate
+		}
+		for txid := range m.withDescendants(map[string]bool{string(lowest.tx.TXID): true}) {
+			if !replaced[txid] && !evicted[txid] {
+				evicted[txid] = true
+				size -= m.entries[txid].size
+			}
+		}
+		//新交易使用了被驱逐交易的output，同样会被驱逐
+		for _, input := range entry.tx.TXInputs {
+			if evicted[string(input.TXID)] {
+				return nil, 0, false
+			}
+		}
+	}
+	return evicted, minFeeRate, true
+}
+
+//ExpireOld 移除在交易池中超过MempoolTTL的交易及其后代交易，返回被移除的交易
+func (m *Mempool) ExpireOld(now time.Time) []*Transaction {
+	m.bc.mux.Lock()
+	defer m.bc.mux.Unlock()
+	return m.expireOld(now)
+}
+
+func (m *Mempool) expireOld(now time.Time) []*Transaction {
+	expired := make(map[string]bool)
+	for txid, entry := range m.entries {
+		if now.Sub(entry.added) > MempoolTTL {
+			expired[txid] = true
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	var txs []*Transaction
+	for txid := range m.withDescendants(expired) {
+		txs = append(txs, m.entries[txid].tx)
+		m.remove(txid)
+	}
+	return txs
+}
+
+//Get 根据交易ID获取交易池中的交易
+func (m *Mempool) Get(txid []byte) *Transaction {
+	m.bc.mux.RLock()
+	defer m.bc.mux.RUnlock()
+	return m.get(txid)
+}
+
+func (m *Mempool) get(txid []byte) *Transaction {
+	entry, ok := m.entries[string(txid)]
+	if !ok {
+		return nil
+	}
+	return entry.tx
+}
+
+//RemoveBlockTransactions 区块上链后，从交易池移除已被打包的交易以及与其冲突的交易
+func (m *Mempool) RemoveBlockTransactions(block *Block) {
+	m.bc.mux.Lock()
+	defer m.bc.mux.Unlock()
+	m.removeBlockTransactions(block)
+}
+
+func (m *Mempool) removeBlockTransactions(block *Block) {
+	for _, tx := range block.Transactions {
+		m.remove(string(tx.TXID))
+		if tx.isCoinBaseTX() {
+			continue
+		}
+		//使用了相同output的交易已无效，连同其后代交易一起移除
+		for _, input := range tx.TXInputs {
+			if txid, ok := m.spent[outpointKey(input.TXID, input.Index)]; ok {
+				for evicted := range m.withDescendants(map[string]bool{txid: true}) {
+					m.remove(evicted)
+				}
+			}
+		}
+	}
+	//交易池使用量降到一半以下时取消最低手续费率
+	if m.bytes < MaxMempoolBytes/2 {
+		m.minFeeRate = 0
+	}
+}
+
+//从交易池移除交易
+func (m *Mempool) remove(txid string) {
+	entry, ok := m.entries[txid]
+	if !ok {
+		return
+	}
+	for _, input := range entry.tx.TXInputs {
+		delete(m.spent, outpointKey(input.TXID, input.Index))
+	}
+	delete(m.entries, txid)
+	m.bytes -= entry.size
+}
+
+//获取交易集合及交易池中所有依赖它们的后代交易
+func (m *Mempool) withDescendants(txids map[string]bool) map[string]bool {
+	result := make(map[string]bool)
+	queue := []string{}
+	for txid := range txids {
+		result[txid] = true
+		queue = append(queue, txid)
+	}
+
+	for len(queue) != 0 {
+		txid := queue[0]
+		queue = queue[1:]
+		//遍历该交易的outputs，找到使用它们的交易
+		for i := range m.entries[txid].tx.TXOutputs {
+			child, ok := m.spent[outpointKey([]byte(txid), int64(i))]
+			if ok && !result[child] {
+				result[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return result
+}
+
+//交易手续费：inputs引用的output总额-outputs总额，总额溢出时返回ErrValueOverflow
+func txFee(tx *Transaction, prevTXs map[string]*Transaction) (int64, error) {
+	outputsTotal, err := tx.outputsTotal()
+	if err != nil {
+		return 0, err
+	}
+	var inputsTotal int64
+	for _, input := range tx.TXInputs {
+		output, err := prevOutput(input, prevTXs)
+		if err != nil {
+			return 0, err
+		}
+		if inputsTotal, err = addSatoshi(inputsTotal, output.Value); err != nil {
+			return 0, err
+		}
+	}
+	return inputsTotal - outputsTotal, nil
+}
+
+//找到交易inputs引用的所有交易：先在交易池中查找，再遍历账本
+func (m *Mempool) findPrevTXs(tx *Transaction) (map[string]*Transaction, error) {
+	prevTXs := make(map[string]*Transaction)
+	for _, input := range tx.TXInputs {
+		prevTX := m.get(input.TXID)
+		if prevTX == nil {
+			var err error
+			prevTX, err = m.bc.FindTransaction(input.TXID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := checkOutputIndex(input, prevTX); err != nil {
+			return nil, err
+		}
+		prevTXs[string(input.TXID)] = prevTX
+	}
+	return prevTXs, nil
+}
+
+//AuditBlockSelection 自检区块的交易选择：返回交易池中未被打包、但手续费率高于区块中某个已打包交易的交易
+//（不考虑交易间的依赖关系）
+func (bc *BlockChain) AuditBlockSelection(block *Block, m *Mempool) ([]*Transaction, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	//区块中已打包交易的最低手续费率
+	included := make(map[string]bool)
+	minRate := -1.0
+	for _, tx := range block.Transactions {
+		included[string(tx.TXID)] = true
+		if tx.isCoinBaseTX() {
+			continue
+		}
+		prevTXs, err := m.findPrevTXs(tx)
+		if err != nil {
+			return nil, err
+		}
+		fee, err := txFee(tx, prevTXs)
+		if err != nil {
+			return nil, err
+		}
+		entry := mempoolEntry{tx: tx, fee: fee, size: tx.SerializedSize()}
+		if minRate < 0 || entry.feeRate() < minRate {
+			minRate = entry.feeRate()
+		}
+	}
+	//找到手续费率更高却未被打包的交易（区块中没有普通交易时，交易池中所有交易都会被标记）
+	var omitted []*mempoolEntry
+	for txid, entry := range m.entries {
+		if !included[txid] && entry.feeRate() > minRate {
+			omitted = append(omitted, entry)
+		}
+	}
+
+	//按手续费率从高到低排序
+	sort.Slice(omitted, func(i, j int) bool {
+		return omitted[i].feeRate() > omitted[j].feeRate()
+	})
+	var txs []*Transaction
+	for _, entry := range omitted {
+		txs = append(txs, entry.tx)
+	}
+	return txs, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+	m := NewMempool(bc)
+
+	old := newTestSpend(t, w, coinbase, 0, payee, 10000)
+	if err := m.Add(old); err != nil {
+		t.Fatal(err)
+	}
+
+	//手续费更低的交易不能替换
+	lower := newTestSpend(t, w, coinbase, 0, payee, 5000)
+	if err := m.Add(lower); err == nil {
+		t.Fatal("手续费更低的交易不应替换原交易")
+	}
+	if m.Get(old.TXID) == nil || m.Get(lower.TXID) != nil {
+		t.Fatal("替换失败后交易池应保持不变")
+	}
+
+	//手续费更高的交易替换原交易
+	bump := newTestSpend(t, w, coinbase, 0, payee, 50000)
+	if err := m.Add(bump); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get(old.TXID) != nil {
+		t.Fatal("被替换的交易应从交易池移除")
+	}
+	if m.Get(bump.TXID) == nil {
+		t.Fatal("替换交易应加入交易池")
+	}
+}
+
+func TestMempoolReplaceNonSignaling(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+	m := NewMempool(bc)
+
+	//不声明可替换的交易
+	final := newTestSpend(t, w, coinbase, 0, payee, 10000)
+	final.TXInputs[0].Sequence = SequenceFinal
+	final.setHash()
+	signTestTX(t, final, w, map[string]*Transaction{string(coinbase.TXID): coinbase})
+	if err := m.Add(final); err != nil {
+		t.Fatal(err)
+	}
+
+	bump := newTestSpend(t, w, coinbase, 0, payee, 50000)
+	if err := m.Add(bump); err == nil {
+		t.Fatal("不可替换的交易不应被替换")
+	}
+	if m.Get(final.TXID) == nil {
+		t.Fatal("原交易应保留在交易池中")
+	}
+}
+
+func TestAuditBlockSelection(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, SatoshiPerBTC, SatoshiPerBTC})
+	m := NewMempool(bc)
+
+	low := newTestSpend(t, w, fund, 0, payee, 1000)
+	mid := newTestSpend(t, w, fund, 1, payee, 5000)
+	high := newTestSpend(t, w, fund, 2, payee, 20000)
+	for _, tx := range []*Transaction{low, mid, high} {
+		if err := m.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coinbase := bc.NewCoinbaseTX(payee, "audit", 0)
+
+	//只打包了手续费最低的交易
+	block := &Block{Transactions: []*Transaction{coinbase, low}}
+	omitted, err := bc.AuditBlockSelection(block, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(omitted) != 2 || !bytes.Equal(omitted[0].TXID, high.TXID) || !bytes.Equal(omitted[1].TXID, mid.TXID) {
+		t.Fatalf("期望按手续费率标记high和mid，实际为%d个交易", len(omitted))
+	}
+
+	//打包了手续费率最高的交易
+	block = &Block{Transactions: []*Transaction{coinbase, high}}
+	omitted, err = bc.AuditBlockSelection(block, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(omitted) != 0 {
+		t.Fatalf("最优的交易选择不应被标记，实际标记了%d个交易", len(omitted))
+	}
+}
+
+func TestMempoolEvictsLowestFeeRate(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	funding := fundTestOutputs(t, bc, w, []int64{100000, 100000, 100000, 100000, 100000})
+	m := NewMempool(bc)
+
+	var txs []*Transaction
+	for i := 0; i < 5; i++ {
+		txs = append(txs, newTestSpend(t, w, funding, int64(i), payee, int64(i+1)*2000))
+	}
+	//交易池只能容纳3个交易
+	defer func(max int) { MaxMempoolBytes = max }(MaxMempoolBytes)
+	MaxMempoolBytes = 3*txs[0].SerializedSize() + txs[0].SerializedSize()/2
+
+	//先加入手续费率较高的交易，再加入手续费率最低的交易
+	for _, i := range []int{1, 2, 0} {
+		if err := m.Add(txs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.Size() != 3 || m.MinFeeRate() != 0 {
+		t.Fatalf("交易池有%d个交易，最低手续费率%d", m.Size(), m.MinFeeRate())
+	}
+
+	//超过上限：驱逐手续费率最低的交易
+	if err := m.Add(txs[3]); err != nil {
+		t.Fatal(err)
+	}
+	if m.Size() != 3 || m.Get(txs[0].TXID) != nil || m.Get(txs[3].TXID) == nil {
+		t.Fatal("应驱逐手续费率最低的交易")
+	}
+	if m.Bytes() > MaxMempoolBytes {
+		t.Fatalf("交易池大小%d超过上限%d", m.Bytes(), MaxMempoolBytes)
+	}
+	evicted := &mempoolEntry{tx: txs[0], fee: 2000, size: txs[0].SerializedSize()}
+	if float64(m.MinFeeRate()) <= evicted.feeRate() {
+		t.Fatalf("最低手续费率%d应高于被驱逐交易的手续费率", m.MinFeeRate())
+	}
+
+	//低于最低手续费率的交易被拒绝，交易池保持不变
+	if err := m.Add(txs[0]); err == nil {
+		t.Fatal("低于最低手续费率的交易不应加入交易池")
+	}
+	if m.Size() != 3 || m.Get(txs[1].TXID) == nil {
+		t.Fatal("拒绝交易后交易池应保持不变")
+	}
+}
+
+func TestMempoolFullRejectionLeavesPoolUnchanged(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	funding := fundTestOutputs(t, bc, w, []int64{100000, 100000, 100000, 100000})
+	m := NewMempool(bc)
+
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		txs = append(txs, newTestSpend(t, w, funding, int64(i), payeeAddress, int64(i+2)*2000))
+	}
+	//交易池只能容纳3个交易，最低手续费率还未提高
+	defer func(max int) { MaxMempoolBytes = max }(MaxMempoolBytes)
+	MaxMempoolBytes = 3*txs[0].SerializedSize() + txs[0].SerializedSize()/2
+	for _, tx := range txs {
+		if err := m.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, bytes, minFeeRate := m.Size(), m.Bytes(), m.MinFeeRate()
+	unchanged := func(name string) {
+		t.Helper()
+		if m.Size() != size || m.Bytes() != bytes || m.MinFeeRate() != minFeeRate {
+			t.Fatalf("%s: 拒绝交易后交易池为%d个交易、%d字节、最低手续费率%d，期望%d、%d、%d",
+				name, m.Size(), m.Bytes(), m.MinFeeRate(), size, bytes, minFeeRate)
+		}
+		for _, tx := range txs {
+			if m.Get(tx.TXID) == nil {
+				t.Fatalf("%s: 交易%x不应被驱逐", name, tx.TXID)
+			}
+		}
+	}
+
+	//手续费率低于池中所有交易
+	low := newTestSpend(t, w, funding, 3, payeeAddress, 2000)
+	if err := m.Add(low); err == nil {
+		t.Fatal("手续费率最低的交易不应加入已满的交易池")
+	}
+	unchanged("低手续费率")
+
+	//替换交易的手续费高于被替换交易，但output较多，替换后超过上限且手续费率最低
+	replacement := newTestSpend(t, w, funding, 0, payeeAddress, 4000+1)
+	for i := 0; i < 12; i++ {
+		replacement.TXOutputs = append(replacement.TXOutputs, TXOutput{Value: 5000, ScriptPubKeyHash: replacement.TXOutputs[0].ScriptPubKeyHash})
+		replacement.TXOutputs[0].Value -= 5000
+	}
+	if err := replacement.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, replacement, w, map[string]*Transaction{string(funding.TXID): funding})
+	if err := m.Add(replacement); err == nil {
+		t.Fatal("会被驱逐的替换交易不应加入交易池")
+	}
+	unchanged("替换交易")
+
+	//手续费率最低的交易的子交易：父交易被驱逐时子交易也被驱逐
+	child := newTestSpend(t, payee, txs[0], 0, payeeAddress, 3000)
+	if err := m.Add(child); err == nil {
+		t.Fatal("父交易会被驱逐的子交易不应加入交易池")
+	}
+	unchanged("子交易")
+}
+
+func TestMempoolExpireOld(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t)
+	coinbase := genesisCoinbase(t, bc)
+	m := NewMempool(bc)
+
+	parent := newTestSpend(t, w, coinbase, 0, payee.getAddress(activeNetwork), 10000)
+	if err := m.Add(parent); err != nil {
+		t.Fatal(err)
+	}
+	child := newTestSpend(t, payee, parent, 0, w.getAddress(activeNetwork), 10000)
+	if err := m.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	//未超过保留时间
+	now := time.Now()
+	if expired := m.ExpireOld(now.Add(MempoolTTL - time.Minute)); len(expired) != 0 {
+		t.Fatalf("移除了%d个未过期的交易", len(expired))
+	}
+
+	//超过保留时间：移除交易及其后代交易
+	expired := m.ExpireOld(now.Add(MempoolTTL + time.Minute))
+	if len(expired) != 2 || m.Size() != 0 {
+		t.Fatalf("移除了%d个交易，交易池剩余%d个，期望全部移除", len(expired), m.Size())
+	}
+	for _, tx := range expired {
+		if !tx.Equals(parent) && !tx.Equals(child) {
+			t.Fatalf("移除了未知的交易%x", tx.TXID)
+		}
+	}
+
+	//区块上链时清理过期的交易
+	if err := bc.mempool.Add(parent); err != nil {
+		t.Fatal(err)
+	}
+	bc.mempool.entries[string(parent.TXID)].added = now.Add(-MempoolTTL - time.Minute)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, payee.getAddress(activeNetwork), "")}); err != nil {
+		t.Fatal(err)
+	}
+	if bc.mempool.Get(parent.TXID) != nil {
+		t.Fatal("区块上链后过期的交易应被移除")
+	}
+}
+
+func TestMempoolMinRelayFeeRate(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	funding := fundTestOutputs(t, bc, w, []int64{100000, 100000, 100000})
+	defer func(rate int64) { MinRelayFeeRate = rate }(MinRelayFeeRate)
+	MinRelayFeeRate = 10
+
+	//创建手续费为MinRelayFeeRate*交易大小+delta的交易（签名长度可能变化，重新计算直到大小稳定）
+	newSpend := func(index int64, delta int64) *Transaction {
+		fee := int64(1000)
+		for i := 0; i < 10; i++ {
+			tx := newTestSpend(t, w, funding, index, payee, fee)
+			want := MinRelayFeeRate*int64(tx.SerializedSize()) + delta
+			if fee == want {
+				return tx
+			}
+			fee = want
+		}
+		t.Fatal("无法得到指定手续费率的交易")
+		return nil
+	}
+
+	if err := bc.mempool.Add(newSpend(0, -1)); err != ErrBelowRelayFee {
+		t.Fatalf("低于最低转发手续费率时返回%v，期望%v", err, ErrBelowRelayFee)
+	}
+	if bc.mempool.Size() != 0 {
+		t.Fatal("被拒绝的交易加入了交易池")
+	}
+	if err := bc.mempool.Add(newSpend(1, 0)); err != nil {
+		t.Fatalf("等于最低转发手续费率的交易被拒绝: %v", err)
+	}
+	if err := bc.mempool.Add(newSpend(2, 1)); err != nil {
+		t.Fatalf("高于最低转发手续费率的交易被拒绝: %v", err)
+	}
+
+	//为0时不限制
+	MinRelayFeeRate = 0
+	if err := bc.mempool.Add(newTestSpend(t, w, funding, 0, payee, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForgedTXIDRejected(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	coinbase := genesisCoinbase(t, bc)
+	tx := newTestSpend(t, w, coinbase, 0, address, 1000)
+	//BIP143格式的签名数据不包含交易ID，伪造交易ID后签名仍然有效
+	prevTXs := map[string]*Transaction{string(coinbase.TXID): coinbase}
+	if !tx.Sign(w.signingKey(), prevTXs, SigHashAll|SigHashBIP143) {
+		t.Fatal("交易签名失败")
+	}
+	forged := tx.Clone()
+	forged.TXID[0] ^= 0xff
+	if !forged.Verify(prevTXs) {
+		t.Fatal("伪造交易ID的交易签名应仍然有效")
+	}
+
+	if err := bc.mempool.Add(forged); err != ErrTXIDMismatch {
+		t.Fatalf("交易池: 期望ErrTXIDMismatch，实际为%v", err)
+	}
+	block := &Block{Height: 1, Transactions: []*Transaction{newTestCoinbase(t, bc, address, ""), forged}}
+	if err := bc.VerifyBlockTransactions(block); err == nil || !strings.Contains(err.Error(), ErrTXIDMismatch.Error()) {
+		t.Fatalf("区块: 期望交易ID不一致的错误，实际为%v", err)
+	}
+
+	if err := bc.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMempoolRejectsSpentOutput(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	//tx1花费创世块的挖矿奖励并上链
+	tx1 := newTestSpend(t, w, coinbase, 0, address, 1000)
+	if err := bc.mempool.Add(tx1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bc.TxBlockHeight(tx1.TXID); !ok {
+		t.Fatal("tx1未上链")
+	}
+
+	//tx2再次花费同一个output
+	tx2 := newTestSpend(t, w, coinbase, 0, newTestWallet(t).getAddress(activeNetwork), 2000)
+	err := bc.mempool.Add(tx2)
+	if err == nil || !strings.Contains(err.Error(), "不存在或已被消耗") {
+		t.Fatalf("期望拒绝已被消耗的output，实际为%v", err)
+	}
+	if bc.mempool.Get(tx2.TXID) != nil {
+		t.Fatal("tx2不应加入交易池")
+	}
+
+	//花费交易池中交易的output可以加入交易池
+	tx3 := newTestSpend(t, w, tx1, 0, address, 1000)
+	if err := bc.mempool.Add(tx3); err != nil {
+		t.Fatal(err)
+	}
+	tx4 := newTestSpend(t, w, tx3, 0, address, 1000)
+	if err := bc.mempool.Add(tx4); err != nil {
+		t.Fatal(err)
+	}
+}
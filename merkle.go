@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+/*
+	梅克尔树：叶子节点为交易ID，父节点为 sha256(0x01 || 较小的子节点 || 较大的子节点)
+		子节点排序后再计算哈希，校验证明时不需要知道兄弟节点在左边还是右边
+		某一层节点个数为奇数时，最后一个节点直接进入上一层
+*/
+
+//MerkleTree 梅克尔树
+type MerkleTree struct {
+	levels [][][]byte //每一层的节点，第0层为叶子节点，最后一层为根
+}
+
+//NewMerkleTree 根据交易ID创建梅克尔树
+func NewMerkleTree(txids [][]byte) *MerkleTree {
+	level := make([][]byte, len(txids))
+	copy(level, txids)
+	tree := MerkleTree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				break
+			}
+			next = append(next, merkleParent(level[i], level[i+1]))
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return &tree
+}
+
+//计算父节点：两个子节点排序后拼接计算哈希
+func merkleParent(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	data := append([]byte{0x01}, a...)
+	data = append(data, b...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+//Root 梅克尔根（没有交易时为空数据的哈希）
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	}
+	return top[0]
+}
+
+//Proof 获取交易ID的梅克尔证明：从叶子到根路径上的兄弟节点，交易不在树中时返回false
+func (t *MerkleTree) Proof(txid []byte) ([][]byte, bool) {
+	index := -1
+	for i, leaf := range t.levels[0] {
+		if bytes.Equal(leaf, txid) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, false
+	}
+
+	var proof [][]byte
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		index /= 2
+	}
+	return proof, true
+}
+
+//VerifyMerkleProof 校验梅克尔证明：由交易ID和兄弟节点依次计算到根，与可信的梅克尔根比较
+func VerifyMerkleProof(txid []byte, proof [][]byte, root []byte) bool {
+	if len(txid) == 0 || len(root) == 0 {
+		return false
+	}
+	hash := txid
+	for _, sibling := range proof {
+		hash = merkleParent(hash, sibling)
+	}
+	return bytes.Equal(hash, root)
+}
+
+//MerkleProof 获取区块中交易的梅克尔证明
+func (b *Block) MerkleProof(txid []byte) ([][]byte, bool) {
+	return NewMerkleTree(b.txids()).Proof(txid)
+}
+
+//区块中所有交易的ID
+func (b *Block) txids() [][]byte {
+	var txids [][]byte
+	for _, tx := range b.Transactions {
+		txids = append(txids, tx.TXID)
+	}
+	return txids
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+//生成n个不同的交易ID
+func testTXIDs(n int) [][]byte {
+	var txids [][]byte
+	for i := 0; i < n; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprint("tx", i)))
+		txids = append(txids, hash[:])
+	}
+	return txids
+}
+
+func TestMerkleProof(t *testing.T) {
+	missing := testTXIDs(10)[9]
+	//节点个数为奇数和偶数的树
+	for n := 1; n <= 9; n++ {
+		txids := testTXIDs(n)
+		tree := NewMerkleTree(txids)
+		root := tree.Root()
+
+		for i, txid := range txids {
+			proof, ok := tree.Proof(txid)
+			if !ok {
+				t.Fatalf("%d个交易：第%d个交易没有证明", n, i)
+			}
+			if !VerifyMerkleProof(txid, proof, root) {
+				t.Fatalf("%d个交易：第%d个交易的证明校验失败", n, i)
+			}
+			//其他交易使用该证明校验失败
+			if VerifyMerkleProof(missing, proof, root) {
+				t.Fatalf("%d个交易：不在树中的交易通过了校验", n)
+			}
+			//兄弟节点被修改
+			for j := range proof {
+				corrupted := append([][]byte{}, proof...)
+				corrupted[j] = append([]byte{}, proof[j]...)
+				corrupted[j][0] ^= 0xff
+				if VerifyMerkleProof(txid, corrupted, root) {
+					t.Fatalf("%d个交易：第%d个兄弟节点被修改的证明通过了校验", n, j)
+				}
+			}
+		}
+
+		if _, ok := tree.Proof(missing); ok {
+			t.Fatalf("%d个交易：不在树中的交易不应有证明", n)
+		}
+	}
+}
+
+func TestBlockMerkleProof(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, payee, ""), tx}); err != nil {
+		t.Fatal(err)
+	}
+	block := bc.GetBlock(bc.tail)
+	if block == nil {
+		t.Fatal("获取区块失败")
+	}
+
+	//轻节点只需要区块头中的梅克尔根
+	proof, ok := block.MerkleProof(tx.TXID)
+	if !ok || !VerifyMerkleProof(tx.TXID, proof, block.MerkleRoot) {
+		t.Fatal("区块中交易的证明校验失败")
+	}
+	if _, ok := block.MerkleProof(genesisCoinbase(t, bc).TXID); ok {
+		t.Fatal("不在区块中的交易不应有证明")
+	}
+}
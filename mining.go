@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+)
+
+//SelectTransactions 按手续费率从高到低选择交易，总字节数不超过maxSize
+//手续费率按交易及其交易池中未被选中的祖先交易（交易包）整体计算：
+//高手续费的子交易可以带动低手续费的父交易一起被选中(CPFP)，父交易总在子交易之前
+//放不下的交易留在交易池中
+func (m *Mempool) SelectTransactions(maxSize int) []*Transaction {
+	m.bc.mux.RLock()
+	defer m.bc.mux.RUnlock()
+	return m.selectTransactions(maxSize)
+}
+
+func (m *Mempool) selectTransactions(maxSize int) []*Transaction {
+	selected := make(map[string]bool)
+	var txs []*Transaction
+	size := 0
+
+	for {
+		//找到手续费率最高且放得下的交易包
+		var best []*mempoolEntry
+		var bestFee int64
+		bestSize := 0
+		for txid, entry := range m.entries {
+			if selected[txid] {
+				continue
+			}
+			pkg := m.ancestorPackage(entry, selected)
+			var fee int64
+			pkgSize := 0
+			for _, e := range pkg {
+				fee += e.fee
+				pkgSize += e.size
+			}
+			if size+pkgSize > maxSize {
+				continue
+			}
+			//比较 fee/pkgSize > bestFee/bestSize
+			if best == nil || fee*int64(bestSize) > bestFee*int64(pkgSize) {
+				best, bestFee, bestSize = pkg, fee, pkgSize
+			}
+		}
+		if best == nil {
+			break
+		}
+		for _, e := range best {
+			selected[string(e.tx.TXID)] = true
+			txs = append(txs, e.tx)
+		}
+		size += bestSize
+	}
+	return txs
+}
+
+//获取交易及其交易池中未被选中的所有祖先交易，祖先交易在前
+func (m *Mempool) ancestorPackage(entry *mempoolEntry, selected map[string]bool) []*mempoolEntry {
+	var pkg []*mempoolEntry
+	visited := make(map[string]bool)
+	var visit func(e *mempoolEntry)
+	visit = func(e *mempoolEntry) {
+		txid := string(e.tx.TXID)
+		if visited[txid] || selected[txid] {
+			return
+		}
+		visited[txid] = true
+		//先加入父交易
+		for _, input := range e.tx.TXInputs {
+			if parent, ok := m.entries[string(input.TXID)]; ok {
+				visit(parent)
+			}
+		}
+		pkg = append(pkg, e)
+	}
+	visit(entry)
+	return pkg
+}
+
+//MineBlock 打包交易池中的交易并挖出新区块：挖矿交易在最前，区块大小不超过共识参数的MaxBlockSize
+func (bc *BlockChain) MineBlock(miner string, data string) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.mineBlock(miner, data)
+}
+
+func (bc *BlockChain) mineBlock(miner string, data string) error {
+	height, err := bc.height()
+	if err != nil {
+		return err
+	}
+	coinbase := bc.NewCoinbaseTX(miner, data, height+1)
+	if coinbase == nil {
+		return errors.New("创建挖矿交易失败")
+	}
+
+	//区块头和挖矿交易占用的字节数
+	emptyBlock := Block{Hash: make([]byte, 32), PrevHash: bc.tail, MerkleRoot: make([]byte, 32), Transactions: []*Transaction{coinbase}}
+	maxSize := bc.params.MaxBlockSize - len(emptyBlock.Serialize())
+	if maxSize < 0 {
+		return errors.New("区块大小上限过小")
+	}
+
+	txs := append([]*Transaction{coinbase}, bc.mempool.selectTransactions(maxSize)...)
+	return bc.addBlock(txs)
+}
+
+//MineTo 给地址挖出一个只包含挖矿交易的区块（地址获得该高度的挖矿奖励），返回新区块
+//只能在开发测试模式（ModeRegtest）下使用
+func (bc *BlockChain) MineTo(address string) (*Block, error) {
+	if activeMode != ModeRegtest {
+		return nil, errors.New("MineTo只能在开发测试模式下使用")
+	}
+	if _, err := GetPubKeyHashFromAddress(address, activeNetwork); err != nil {
+		return nil, err
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	height, err := bc.height()
+	if err != nil {
+		return nil, err
+	}
+	coinbase := bc.NewCoinbaseTX(address, "", height+1)
+	if coinbase == nil {
+		return nil, errors.New("创建挖矿交易失败")
+	}
+	if err := bc.addBlock([]*Transaction{coinbase}); err != nil {
+		return nil, err
+	}
+	return bc.newIterator().Next(), nil
+}
+
+//GenerateBlocks 连续挖出n个区块（打包交易池中的交易，挖矿奖励给miner），返回新区块
+//只能在开发测试模式（ModeRegtest）下使用
+func (bc *BlockChain) GenerateBlocks(n int, miner string) ([]*Block, error) {
+	if activeMode != ModeRegtest {
+		return nil, errors.New("GenerateBlocks只能在开发测试模式下使用")
+	}
+	if _, err := GetPubKeyHashFromAddress(miner, activeNetwork); err != nil {
+		return nil, err
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	var blocks []*Block
+	for i := 0; i < n; i++ {
+		if err := bc.mineBlock(miner, ""); err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, bc.newIterator().Next())
+	}
+	return blocks, nil
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMineBlockRespectsMaxBlockSize(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	//交易池中有5个交易，手续费依次增加
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, SatoshiPerBTC, SatoshiPerBTC, SatoshiPerBTC, SatoshiPerBTC})
+	var txs []*Transaction
+	for i := 0; i < 5; i++ {
+		tx := newTestSpend(t, w, fund, int64(i), address, int64(i+1)*1000)
+		if err := bc.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	//区块大小只够放下挖矿交易和2个交易
+	defer func(size int) { bc.params.MaxBlockSize = size }(bc.params.MaxBlockSize)
+	txSize := txs[0].SerializedSize()
+	emptyBlock := Block{Hash: make([]byte, 32), PrevHash: bc.tail, MerkleRoot: make([]byte, 32),
+		Transactions: []*Transaction{bc.NewCoinbaseTX(address, "", 2)}}
+	bc.params.MaxBlockSize = len(emptyBlock.Serialize()) + 2*txSize + txSize/2
+
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	block := bc.NewIterator().Next()
+	if len(block.Transactions) != 3 || !block.Transactions[0].isCoinBaseTX() {
+		t.Fatalf("区块有%d个交易，期望挖矿交易在最前加2个交易", len(block.Transactions))
+	}
+	//选中手续费率最高的2个交易
+	for i, want := range []*Transaction{txs[4], txs[3]} {
+		if !bytes.Equal(block.Transactions[i+1].TXID, want.TXID) {
+			t.Fatalf("区块第%d个交易不是手续费率第%d高的交易", i+2, i+1)
+		}
+	}
+	if size := len(block.Serialize()); size > bc.params.MaxBlockSize {
+		t.Fatalf("区块大小为%d，超过上限%d", size, bc.params.MaxBlockSize)
+	}
+
+	//放不下的交易留在交易池中
+	for _, tx := range txs[:3] {
+		if bc.mempool.Get(tx.TXID) == nil {
+			t.Fatalf("交易%x应留在交易池中", tx.TXID)
+		}
+	}
+	for _, tx := range txs[3:] {
+		if bc.mempool.Get(tx.TXID) != nil {
+			t.Fatalf("已打包的交易%x应从交易池移除", tx.TXID)
+		}
+	}
+}
+
+func TestSelectTransactionsKeepsParentFirst(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	//高手续费的子交易花费低手续费的父交易
+	parent := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 1000)
+	child := newTestSpend(t, w, parent, 0, address, 100000)
+	for _, tx := range []*Transaction{parent, child} {
+		if err := bc.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	selected := bc.mempool.SelectTransactions(bc.params.MaxBlockSize)
+	if len(selected) != 2 || !bytes.Equal(selected[0].TXID, parent.TXID) || !bytes.Equal(selected[1].TXID, child.TXID) {
+		t.Fatal("父交易应在子交易之前被选中")
+	}
+	//放不下两个交易时只能选父交易
+	selected = bc.mempool.SelectTransactions(parent.SerializedSize() + child.SerializedSize() - 1)
+	if len(selected) != 1 || !bytes.Equal(selected[0].TXID, parent.TXID) {
+		t.Fatal("父交易未被选中时子交易不能被选中")
+	}
+}
+
+func TestSelectTransactionsByPackageFeeRate(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, SatoshiPerBTC})
+
+	//父交易手续费低于其他交易，子交易手续费很高
+	parent := newTestSpend(t, w, fund, 0, address, 100)
+	child := newTestSpend(t, w, parent, 0, address, 100000)
+	other := newTestSpend(t, w, fund, 1, address, 20000)
+	for _, tx := range []*Transaction{parent, child, other} {
+		if err := bc.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//只放得下2个交易：交易包的手续费率高于other，父交易和子交易一起被选中
+	maxSize := parent.SerializedSize() + child.SerializedSize() + other.SerializedSize()/2
+	selected := bc.mempool.SelectTransactions(maxSize)
+	if len(selected) != 2 || !bytes.Equal(selected[0].TXID, parent.TXID) || !bytes.Equal(selected[1].TXID, child.TXID) {
+		t.Fatalf("期望选中父交易和子交易，实际选中%d个交易", len(selected))
+	}
+}
+
+//挖矿的同时查询金额和提交交易，使用 go test -race 运行
+func TestMineWhileQuerying(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t)
+	payeeAddress := payee.getAddress(activeNetwork)
+	miner := newTestWallet(t).getAddress(activeNetwork)
+
+	values := []int64{100000, 100000, 100000, 100000, 100000, 100000}
+	fund := fundTestOutputs(t, bc, w, values)
+	var txs []*Transaction
+	for i := range values {
+		txs = append(txs, newTestSpend(t, w, fund, int64(i), payeeAddress, 1000))
+	}
+
+	const blocks = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	done := make(chan struct{})
+
+	//挖矿
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < blocks; i++ {
+			if err := bc.MineBlock(miner, fmt.Sprint("block", i)); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	//提交交易
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, tx := range txs {
+			if err := bc.mempool.Add(tx); err != nil {
+				errs <- err
+			}
+		}
+	}()
+
+	//查询金额、区块高度和交易池
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := bc.Balance(address); err != nil {
+					errs <- err
+					return
+				}
+				if _, _, _, err := bc.BalanceByDepth(payeeAddress); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := bc.Height(); err != nil {
+					errs <- err
+					return
+				}
+				bc.mempool.Size()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	//挖矿期间未打包的交易在最后一个区块中打包
+	if bc.mempool.Size() != 0 {
+		if err := bc.MineBlock(miner, "last"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//UTXO集合未被破坏：与重新构建的结果一致
+	utxoSet := NewUTXOSet()
+	if err := utxoSet.Reindex(bc); err != nil {
+		t.Fatal(err)
+	}
+	for _, pubKeyHash := range [][]byte{GetPubKeyHashFromPublicKey(w.PublicKey), GetPubKeyHashFromPublicKey(payee.PublicKey)} {
+		want := sortedUTXOKeys(utxoSet.FindUTXO(pubKeyHash))
+		if got := sortedUTXOKeys(bc.utxoSet.FindUTXO(pubKeyHash)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("UTXO集合为%v，重新构建得到%v", got, want)
+		}
+	}
+	balance, err := bc.Balance(payeeAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(values)) * (100000 - 1000); balance != want {
+		t.Fatalf("收款金额为%d，期望%d", balance, want)
+	}
+}
+
+func TestBumpFeeCPFP(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, SatoshiPerBTC})
+
+	//父交易手续费率很低，output找零给自己；另一个交易付款给其他地址
+	parent := newTestSpend(t, w, fund, 0, address, 100)
+	other := newTestSpend(t, w, fund, 1, payee, 100)
+	for _, tx := range []*Transaction{parent, other} {
+		if err := bc.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const threshold = 20
+	if rate := 100 / parent.SerializedSize(); rate >= threshold {
+		t.Fatalf("父交易手续费率%d应低于%d", rate, threshold)
+	}
+
+	child, err := bc.BumpFeeCPFP(parent.TXID, 0, 30000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(child.TXInputs[0].TXID, parent.TXID) || child.TXOutputs[0].Value != parent.TXOutputs[0].Value-30000 {
+		t.Fatal("子交易应花费父交易的找零并支付手续费")
+	}
+	if err := bc.mempool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+	//交易包的手续费率超过阈值
+	if rate := (100 + 30000) / (parent.SerializedSize() + child.SerializedSize()); rate < threshold {
+		t.Fatalf("交易包手续费率为%d，期望不低于%d", rate, threshold)
+	}
+	selected := bc.mempool.SelectTransactions(parent.SerializedSize() + child.SerializedSize())
+	if len(selected) != 2 || !bytes.Equal(selected[0].TXID, parent.TXID) || !bytes.Equal(selected[1].TXID, child.TXID) {
+		t.Fatal("父交易应与子交易一起被选中")
+	}
+
+	//找零已被使用、父交易不在交易池、output不属于钱包、索引值无效
+	if _, err := bc.BumpFeeCPFP(parent.TXID, 0, 10000); err == nil {
+		t.Error("找零已被使用时应返回错误")
+	}
+	if _, err := bc.BumpFeeCPFP(fund.TXID, 0, 10000); err == nil {
+		t.Error("父交易不在交易池时应返回错误")
+	}
+	if _, err := bc.BumpFeeCPFP(other.TXID, 0, 10000); err == nil {
+		t.Error("output不属于钱包时应返回错误")
+	}
+	if _, err := bc.BumpFeeCPFP(other.TXID, 1, 10000); err == nil {
+		t.Error("索引值无效时应返回错误")
+	}
+}
+
+//切换运行模式，返回的函数恢复原来的运行模式和网络
+func useTestChainMode(mode ChainMode) func() {
+	oldMode, oldNetwork := activeMode, activeNetwork
+	SetChainMode(mode)
+	return func() { activeMode, activeNetwork = oldMode, oldNetwork }
+}
+
+func TestMineTo(t *testing.T) {
+	restore := useTestChainMode(ModeRegtest)
+	defer restore()
+	bc, _, cleanup := newTestChain(t)
+	defer cleanup()
+	address := newTestWallet(t).getAddress(activeNetwork)
+
+	for i := uint64(1); i <= 2; i++ {
+		before, err := bc.Balance(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := bc.MineTo(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Height != i || !bytes.Equal(block.Hash, bc.tail) {
+			t.Fatalf("返回的区块高度为%d，不是最后一个区块", block.Height)
+		}
+		after, err := bc.Balance(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after-before != bc.params.BlockReward(i) {
+			t.Fatalf("地址金额增加了%d，期望%d", after-before, bc.params.BlockReward(i))
+		}
+	}
+
+	if _, err := bc.MineTo("invalid"); err == nil {
+		t.Error("无效地址应返回错误")
+	}
+	activeMode = ModeTestnet
+	if _, err := bc.MineTo(address); err == nil {
+		t.Error("非开发测试模式下MineTo成功")
+	}
+}
+
+func TestGenerateBlocks(t *testing.T) {
+	restore := useTestChainMode(ModeRegtest)
+	defer restore()
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	spend := newTestSpend(t, w, genesisCoinbase(t, bc), 0, miner, 10000)
+	if err := bc.mempool.Add(spend); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	blocks, err := bc.GenerateBlocks(5, miner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("生成5个区块用时%v", elapsed)
+	}
+	if len(blocks) != 5 || !bytes.Equal(blocks[4].Hash, bc.tail) {
+		t.Fatalf("生成了%d个区块", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Height != uint64(i+1) || !block.ValidatePoW() {
+			t.Errorf("第%d个区块高度为%d，工作量证明有效为%v", i, block.Height, block.ValidatePoW())
+		}
+	}
+	if len(blocks[0].Transactions) != 2 || !blocks[0].Transactions[1].Equals(spend) {
+		t.Error("交易池中的交易没有被打包")
+	}
+
+	//挖矿奖励不需要等待成熟
+	balance, err := bc.Balance(miner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, pending, immature, err := bc.BalanceByDepth(miner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if immature != 0 || confirmed+pending != uint64(balance) {
+		t.Errorf("金额为%d，未成熟金额为%d", balance, immature)
+	}
+
+	activeMode = ModeMainnet
+	if _, err := bc.GenerateBlocks(1, miner); err == nil {
+		t.Error("非开发测试模式下GenerateBlocks成功")
+	}
+}
+
+func TestMineBlockIncludesCPFPChild(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	//低手续费的父交易和高手续费的子交易
+	parent := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 100)
+	child := newTestSpend(t, w, parent, 0, address, 100000)
+	for _, tx := range []*Transaction{parent, child} {
+		if err := bc.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := bc.MineBlock(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []*Transaction{parent, child} {
+		if height, ok := bc.TxBlockHeight(tx.TXID); !ok || height != 1 {
+			t.Fatalf("交易%x应打包在高度1，实际为%d, %v", tx.TXID, height, ok)
+		}
+	}
+	if bc.mempool.Size() != 0 {
+		t.Fatalf("交易池中还有%d个交易", bc.mempool.Size())
+	}
+	if err := bc.VerifyChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddBlockSkipsInBlockDoubleSpend(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	first := newTestSpend(t, w, coinbase, 0, address, 1000)
+	second := newTestSpend(t, w, coinbase, 0, address, 2000)
+	if err := bc.AddBlock([]*Transaction{bc.NewCoinbaseTX(address, "", 1), first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bc.TxBlockHeight(first.TXID); !ok {
+		t.Fatal("第一个交易应上链")
+	}
+	if _, ok := bc.TxBlockHeight(second.TXID); ok {
+		t.Fatal("区块内重复使用output的交易不应上链")
+	}
+}
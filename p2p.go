@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+/*
+	P2P网络：节点之间通过TCP传播交易和区块
+		消息格式：命令(12字节，不足补0) + 数据长度(4字节，大端) + 数据
+		inv：通知对方自己拥有的交易或区块的哈希
+		getdata：向对方请求交易或区块
+		tx：交易数据（二进制格式，见EncodeBinary）
+		block：区块数据
+		filterload：轻节点加载布隆过滤器，之后只向其转发与过滤器匹配的交易
+*/
+
+//消息命令
+const (
+	cmdInv        = "inv"
+	cmdGetData    = "getdata"
+	cmdTx         = "tx"
+	cmdBlock      = "block"
+	cmdFilterLoad = "filterload"
+)
+
+//inv/getdata中的数据类型
+const (
+	invTypeTx    = "tx"
+	invTypeBlock = "block"
+)
+
+//命令字段长度
+const commandLength = 12
+
+//消息数据的最大长度
+const maxPayloadSize = 32 << 20
+
+//inv和getdata消息的数据
+type inventory struct {
+	Type   string   //交易或区块
+	Hashes [][]byte //交易ID或区块哈希
+}
+
+//Node P2P节点
+type Node struct {
+	bc    *BlockChain
+	mux   sync.Mutex       //保护区块链、交易池和节点集合
+	peers map[string]*peer //已连接的节点（key为对方地址）
+}
+
+//已连接的节点
+type peer struct {
+	conn     net.Conn
+	writeMux sync.Mutex   //同一时间只能写入一条消息
+	filter   *BloomFilter //对方加载的布隆过滤器（由Node.mux保护），为nil时转发所有交易
+}
+
+//NewNode 创建P2P节点
+func NewNode(bc *BlockChain) *Node {
+	n := Node{
+		bc:    bc,
+		peers: make(map[string]*peer),
+	}
+	return &n
+}
+
+//Listen 监听指定地址，接受其他节点的连接
+func (n *Node) Listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			n.addPeer(conn)
+		}
+	}()
+	return listener, nil
+}
+
+//Connect 连接其他节点
+func (n *Node) Connect(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	n.addPeer(conn)
+	return nil
+}
+
+//BroadcastTx 将交易加入交易池，并通知所有已连接的节点
+func (n *Node) BroadcastTx(tx *Transaction) error {
+	n.mux.Lock()
+	err := n.bc.mempool.Add(tx)
+	n.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	n.relayTx(tx, nil)
+	return nil
+}
+
+//LoadFilter 作为轻节点向所有已连接的节点发送布隆过滤器，对方之后只转发与过滤器匹配的交易
+func (n *Node) LoadFilter(filter *BloomFilter) {
+	n.mux.Lock()
+	var peers []*peer
+	for _, p := range n.peers {
+		peers = append(peers, p)
+	}
+	n.mux.Unlock()
+
+	payload := encodeBloomFilter(filter)
+	for _, p := range peers {
+		err := p.send(cmdFilterLoad, payload)
+		if err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+//BroadcastBlock 通知所有已连接的节点有新区块
+func (n *Node) BroadcastBlock(block *Block) {
+	n.relay(invTypeBlock, block.Hash, nil)
+}
+
+//保存连接并开始处理对方发来的消息
+func (n *Node) addPeer(conn net.Conn) {
+	p := &peer{conn: conn}
+	n.mux.Lock()
+	n.peers[conn.RemoteAddr().String()] = p
+	n.mux.Unlock()
+	go n.handlePeer(p)
+}
+
+//断开连接
+func (n *Node) removePeer(p *peer) {
+	n.mux.Lock()
+	delete(n.peers, p.conn.RemoteAddr().String())
+	n.mux.Unlock()
+	p.conn.Close()
+}
+
+//向除from以外的所有节点发送inv消息
+func (n *Node) relay(invType string, hash []byte, from *peer) {
+	n.mux.Lock()
+	var peers []*peer
+	for _, p := range n.peers {
+		if p != from {
+			peers = append(peers, p)
+		}
+	}
+	n.mux.Unlock()
+	sendInv(peers, invType, hash)
+}
+
+//向除from以外的节点发送交易的inv消息：加载了布隆过滤器的节点只接收与过滤器匹配的交易
+func (n *Node) relayTx(tx *Transaction, from *peer) {
+	n.mux.Lock()
+	var peers []*peer
+	for _, p := range n.peers {
+		if p != from && (p.filter == nil || p.filter.MatchesTransaction(tx)) {
+			peers = append(peers, p)
+		}
+	}
+	n.mux.Unlock()
+	sendInv(peers, invTypeTx, tx.TXID)
+}
+
+//向节点发送inv消息
+func sendInv(peers []*peer, invType string, hash []byte) {
+	for _, p := range peers {
+		err := p.send(cmdInv, encodeInventory(inventory{invType, [][]byte{hash}}))
+		if err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+//循环读取并处理对方发来的消息，出错时断开连接
+func (n *Node) handlePeer(p *peer) {
+	defer n.removePeer(p)
+	for {
+		command, payload, err := readMessage(p.conn)
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn(err)
+			}
+			return
+		}
+		err = n.handleMessage(p, command, payload)
+		if err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+//根据命令处理消息
+func (n *Node) handleMessage(p *peer, command string, payload []byte) error {
+	switch command {
+	case cmdInv:
+		return n.handleInv(p, payload)
+	case cmdGetData:
+		return n.handleGetData(p, payload)
+	case cmdTx:
+		return n.handleTx(p, payload)
+	case cmdBlock:
+		return n.handleBlock(p, payload)
+	case cmdFilterLoad:
+		return n.handleFilterLoad(p, payload)
+	default:
+		return errors.New("未知的消息命令: " + command)
+	}
+}
+
+//收到inv：请求自己没有的交易或区块
+func (n *Node) handleInv(p *peer, payload []byte) error {
+	inv, err := decodeInventory(payload)
+	if err != nil {
+		return err
+	}
+
+	var missing [][]byte
+	n.mux.Lock()
+	for _, hash := range inv.Hashes {
+		switch inv.Type {
+		case invTypeTx:
+			if n.bc.mempool.Get(hash) != nil {
+				continue
+			}
+			if _, ok := n.bc.TxBlockHeight(hash); ok {
+				continue
+			}
+		case invTypeBlock:
+			if n.bc.GetBlock(hash) != nil {
+				continue
+			}
+		}
+		missing = append(missing, hash)
+	}
+	n.mux.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return p.send(cmdGetData, encodeInventory(inventory{inv.Type, missing}))
+}
+
+//收到getdata：发送对方请求的交易或区块
+func (n *Node) handleGetData(p *peer, payload []byte) error {
+	inv, err := decodeInventory(payload)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range inv.Hashes {
+		switch inv.Type {
+		case invTypeTx:
+			n.mux.Lock()
+			tx := n.bc.mempool.Get(hash)
+			n.mux.Unlock()
+			if tx != nil {
+				err = p.send(cmdTx, tx.EncodeBinary())
+			}
+		case invTypeBlock:
+			n.mux.Lock()
+			block := n.bc.GetBlock(hash)
+			prunedHeight := n.bc.prunedHeight()
+			n.mux.Unlock()
+			//已裁剪的区块交易不完整，不能发送
+			if block != nil && block.Height >= prunedHeight {
+				err = p.send(cmdBlock, block.Serialize())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//收到交易：校验后加入交易池，只有新交易才继续传播
+func (n *Node) handleTx(p *peer, payload []byte) error {
+	tx, err := DecodeBinaryTransaction(payload)
+	if err != nil {
+		return err
+	}
+
+	n.mux.Lock()
+	if n.bc.mempool.Get(tx.TXID) != nil {
+		n.mux.Unlock()
+		return nil
+	}
+	err = n.bc.mempool.Add(tx)
+	n.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	n.relayTx(tx, p)
+	return nil
+}
+
+//收到filterload：保存对方的布隆过滤器
+func (n *Node) handleFilterLoad(p *peer, payload []byte) error {
+	filter, err := decodeBloomFilter(payload)
+	if err != nil {
+		return err
+	}
+	n.mux.Lock()
+	p.filter = filter
+	n.mux.Unlock()
+	return nil
+}
+
+//收到区块：校验后添加到区块链，并继续传播
+func (n *Node) handleBlock(p *peer, payload []byte) error {
+	block := DeSerialize(payload)
+	if block == nil {
+		return errors.New("区块格式错误")
+	}
+
+	n.mux.Lock()
+	if n.bc.GetBlock(block.Hash) != nil {
+		n.mux.Unlock()
+		return nil
+	}
+	err := n.bc.AcceptBlock(block)
+	n.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	n.relay(invTypeBlock, block.Hash, p)
+	return nil
+}
+
+//发送消息
+func (p *peer) send(command string, payload []byte) error {
+	p.writeMux.Lock()
+	defer p.writeMux.Unlock()
+	return writeMessage(p.conn, command, payload)
+}
+
+//写入一条消息：命令(12字节) + 数据长度(4字节) + 数据
+func writeMessage(w io.Writer, command string, payload []byte) error {
+	if len(command) > commandLength {
+		return errors.New("消息命令过长")
+	}
+	if len(payload) > maxPayloadSize {
+		return errors.New("消息数据过长")
+	}
+
+	header := make([]byte, commandLength+4)
+	copy(header, command)
+	binary.BigEndian.PutUint32(header[commandLength:], uint32(len(payload)))
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+//读取一条消息
+func readMessage(r io.Reader) (string, []byte, error) {
+	header := make([]byte, commandLength+4)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	command := string(bytes.TrimRight(header[:commandLength], "\x00"))
+	length := binary.BigEndian.Uint32(header[commandLength:])
+	if length > maxPayloadSize {
+		return "", nil, errors.New("消息数据过长")
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return command, payload, nil
+}
+
+//编码inv/getdata数据
+func encodeInventory(inv inventory) []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(inv)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	return buffer.Bytes()
+}
+
+//解码inv/getdata数据
+func decodeInventory(data []byte) (inventory, error) {
+	var inv inventory
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&inv)
+	return inv, err
+}
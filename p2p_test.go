@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+//在另一个临时目录中复制bc的账本，得到使用相同共识参数的第二个节点的区块链
+func copyTestChain(t testing.TB, bc *BlockChain) (*BlockChain, func()) {
+	t.Helper()
+	data, err := ioutil.ReadFile(bc.db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "hibtc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	restore := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	if err := ioutil.WriteFile(blockChainDBFile, data, 0600); err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	copied, err := GetBlockChainInstanceWithParams(bc.Params())
+	if err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	return copied, func() {
+		copied.db.Close()
+		restore()
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	payload := encodeInventory(inventory{invTypeTx, [][]byte{[]byte("txid")}})
+	if err := writeMessage(&buffer, cmdGetData, payload); err != nil {
+		t.Fatal(err)
+	}
+	command, data, err := readMessage(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != cmdGetData || !bytes.Equal(data, payload) {
+		t.Fatalf("读取的消息为%s %x，期望%s %x", command, data, cmdGetData, payload)
+	}
+	inv, err := decodeInventory(data)
+	if err != nil || inv.Type != invTypeTx || string(inv.Hashes[0]) != "txid" {
+		t.Fatalf("inv数据为%+v(%v)", inv, err)
+	}
+
+	if err := writeMessage(&buffer, "commandtoolong", nil); err == nil {
+		t.Fatal("过长的命令应被拒绝")
+	}
+
+	//声明的数据长度超过上限
+	header := make([]byte, commandLength+4)
+	copy(header, cmdBlock)
+	binary.BigEndian.PutUint32(header[commandLength:], maxPayloadSize+1)
+	if _, _, err := readMessage(bytes.NewReader(header)); err == nil {
+		t.Fatal("过长的消息数据应被拒绝")
+	}
+}
+
+func TestGossipTransaction(t *testing.T) {
+	bcA, w, cleanupA := newTestChain(t)
+	defer cleanupA()
+	bcB, cleanupB := copyTestChain(t, bcA)
+	defer cleanupB()
+
+	nodeA, nodeB := NewNode(bcA), NewNode(bcB)
+	listener, err := nodeB.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := nodeA.Connect(listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	tx := newTestSpend(t, w, genesisCoinbase(t, bcA), 0, payee, 10000)
+	if err := nodeA.BroadcastTx(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		nodeB.mux.Lock()
+		received := bcB.mempool.Get(tx.TXID)
+		nodeB.mux.Unlock()
+		if received != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("节点B的交易池中没有收到交易")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//已有的交易不会重复加入
+	if err := nodeA.BroadcastTx(tx); err == nil {
+		t.Fatal("重复的交易应被拒绝")
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
-	"fmt"
 	"math/big"
 )
 
@@ -13,18 +12,12 @@ type ProofOfWork struct {
 	target *big.Int //目标值(大数值类型)：与生成的哈希值比较
 }
 
-//NewProofOfWork 创建一个工作证明(用户提供区块）系统提供目标值
+//NewProofOfWork 创建一个工作证明(用户提供区块）系统根据运行模式提供目标值
 func NewProofOfWork(block *Block) *ProofOfWork {
 	pow := ProofOfWork{
-		block: block,
+		block:  block,
+		target: powTarget(),
 	}
-	//难度值：
-	targetStr := "0001000000000000000000000000000000000000000000000000000000000000"
-	//目标值(64位的16进制数)：
-	tmpBigInt := new(big.Int)          //创建一个BigInt
-	tmpBigInt.SetString(targetStr, 16) //将难度值字符串以16进制赋值给BigInt
-	pow.target = tmpBigInt
-
 	return &pow
 }
 
@@ -35,7 +28,7 @@ func (pow *ProofOfWork) Run() ([]byte, uint64) {
 	//定以哈希值
 	var hash [32]byte
 
-	fmt.Println("开始挖矿...")
+	logger.Debug("开始挖矿...")
 	//挖矿
 	for {
 
@@ -81,6 +74,20 @@ func (pow *ProofOfWork) PrepareData(nonce uint64) []byte {
 	return data
 }
 
+//Work 区块的工作量：2^256/(目标值+1)，目标值越小工作量越大
+func (pow *ProofOfWork) Work() *big.Int {
+	denominator := new(big.Int).Add(pow.target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+	return numerator.Div(numerator, denominator)
+}
+
+//根据区块数据和随机数计算区块哈希
+func (b *Block) computeHash() []byte {
+	pow := NewProofOfWork(b)
+	hash := sha256.Sum256(pow.PrepareData(b.Nonce))
+	return hash[:]
+}
+
 //IsValid 工作量验证：校验挖矿结果(对求出来的哈希和随机数进行验证)
 func (pow *ProofOfWork) IsValid() bool {
 
@@ -94,3 +101,47 @@ func (pow *ProofOfWork) IsValid() bool {
 	//返回比较结果
 	return tmpInt.Cmp(pow.target) == -1
 }
+
+//目标值的紧凑表示（Bits）：最高字节为目标值的字节数，低3字节为目标值最高的3个字节（最高位不能为1）
+func targetToBits(target *big.Int) uint64 {
+	size := uint(len(target.Bytes()))
+	var mantissa uint64
+	if size <= 3 {
+		mantissa = target.Uint64() << (8 * (3 - size))
+	} else {
+		mantissa = new(big.Int).Rsh(target, 8*(size-3)).Uint64()
+	}
+	//最高位为1时右移一个字节，避免被解析为负数
+	if mantissa&0x800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint64(size)<<24 | mantissa
+}
+
+//从紧凑表示还原目标值
+func bitsToTarget(bits uint64) *big.Int {
+	size := uint(bits>>24) & 0xff
+	mantissa := bits & 0x7fffff
+	if size <= 3 {
+		return new(big.Int).SetUint64(mantissa >> (8 * (3 - size)))
+	}
+	return new(big.Int).Lsh(new(big.Int).SetUint64(mantissa), 8*(size-3))
+}
+
+//Mine 以指定目标值挖矿：目标值以紧凑表示保存在Bits中（会舍去低位），递增Nonce直到区块哈希小于目标值
+func (b *Block) Mine(target *big.Int) {
+	b.Bits = targetToBits(target)
+	pow := ProofOfWork{block: b, target: bitsToTarget(b.Bits)}
+	b.Hash, b.Nonce = pow.Run()
+}
+
+//ValidatePoW 校验区块自身的工作量证明：区块哈希与区块数据一致，且小于Bits表示的目标值（Bits为0时使用默认目标值）
+//只校验区块声明的难度，上链时仍要求满足默认目标值
+func (b *Block) ValidatePoW() bool {
+	pow := NewProofOfWork(b)
+	if b.Bits != 0 {
+		pow.target = bitsToTarget(b.Bits)
+	}
+	return bytes.Equal(b.Hash, b.computeHash()) && pow.IsValid()
+}
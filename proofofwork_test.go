@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTargetBits(t *testing.T) {
+	for _, target := range []*big.Int{
+		big.NewInt(0x7f),
+		big.NewInt(0x8000),
+		new(big.Int).Lsh(big.NewInt(0x123456), 200),
+		new(big.Int).Lsh(big.NewInt(0x80), 240),
+	} {
+		if got := bitsToTarget(targetToBits(target)); got.Cmp(target) != 0 {
+			t.Errorf("目标值%x还原为%x", target, got)
+		}
+	}
+	//紧凑表示只保留最高的3个字节
+	target := new(big.Int).Lsh(big.NewInt(0x12345678), 96)
+	if got, want := bitsToTarget(targetToBits(target)), new(big.Int).Lsh(big.NewInt(0x123456), 104); got.Cmp(want) != 0 {
+		t.Errorf("目标值%x还原为%x，期望%x", target, got, want)
+	}
+}
+
+func TestBlockMine(t *testing.T) {
+	w := newTestWallet(t)
+	b := NewBlock([]*Transaction{newCoinbaseTX(w.getAddress(activeNetwork), "pow", 1, initialReward)}, []byte("prev"), 1)
+	if !b.ValidatePoW() {
+		t.Fatal("默认难度挖出的区块校验失败")
+	}
+
+	//低难度：哈希的最高字节为0即可
+	target := new(big.Int).Lsh(big.NewInt(1), 248)
+	b.Mine(target)
+	if !b.ValidatePoW() {
+		t.Fatal("挖出的区块校验失败")
+	}
+	if new(big.Int).SetBytes(b.Hash).Cmp(target) >= 0 {
+		t.Fatalf("区块哈希%x不小于目标值", b.Hash)
+	}
+
+	for name, tamper := range map[string]func(b *Block){
+		"梅克尔根":  func(b *Block) { b.MerkleRoot = append([]byte{}, b.MerkleRoot...); b.MerkleRoot[0] ^= 1 },
+		"前区块哈希": func(b *Block) { b.PrevHash = []byte("other") },
+		"时间戳":   func(b *Block) { b.TimeStamp++ },
+		"随机数":   func(b *Block) { b.Nonce++ },
+		"难度":    func(b *Block) { b.Bits++ },
+	} {
+		tampered := *b
+		tamper(&tampered)
+		if tampered.ValidatePoW() {
+			t.Errorf("修改%s后工作量证明仍然有效", name)
+		}
+	}
+
+	//哈希与数据一致但不满足声明的难度
+	b.Bits = targetToBits(big.NewInt(1))
+	b.Hash = b.computeHash()
+	if b.ValidatePoW() {
+		t.Error("不满足难度的区块校验成功")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	区块链裁剪：
+		较早的区块中，所有output都已被消耗的交易不会再被引用，可以从区块中删除以节省磁盘空间。
+		区块头（包括梅克尔根和区块哈希）保持不变，区块之间的连接关系仍可校验；
+		仍有未消耗output的交易保留在区块中，新交易引用它们时可以正常校验。
+		裁剪后无法再从区块数据重建UTXO集合。
+*/
+
+//数据桶中保存裁剪高度的字段key：高度低于该值的区块可能已被裁剪
+const prunedHeightKey = "prunedHeightKey"
+
+//Prune 裁剪区块链：保留最后keepBlocks个区块，更早的区块中删除所有output都已被消耗的交易
+func (bc *BlockChain) Prune(keepBlocks int) error {
+	if keepBlocks < 0 {
+		return errors.New("保留的区块数不能为负数")
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	height, err := bc.height()
+	if err != nil {
+		return err
+	}
+	if uint64(keepBlocks) > height {
+		return nil
+	}
+	//高度低于limit的区块需要裁剪
+	limit := height + 1 - uint64(keepBlocks)
+
+	//从最后一个区块向前遍历，找到需要裁剪的区块
+	var blocks []*Block
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return errors.New("读取区块失败")
+		}
+		if block.Height < limit {
+			blocks = append(blocks, block)
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	prunedHeight := bc.prunedHeight()
+	var pruned int
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket == nil {
+			return errors.New("No bucket")
+		}
+		indexBucket := tx.Bucket([]byte(txIndexBucket))
+
+		for _, block := range blocks {
+			//保留仍有未消耗output的交易
+			var kept []*Transaction
+			for _, transaction := range block.Transactions {
+				if bc.hasUnspentOutput(transaction) {
+					kept = append(kept, transaction)
+					continue
+				}
+				if indexBucket != nil {
+					err := indexBucket.Delete(transaction.TXID)
+					if err != nil {
+						return err
+					}
+				}
+				pruned++
+			}
+			if len(kept) == len(block.Transactions) {
+				continue
+			}
+			block.Transactions = kept
+			err := bucket.Put(block.Hash, block.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		//记录裁剪高度（只增不减）
+		if limit > prunedHeight {
+			return bucket.Put([]byte(prunedHeightKey), UintToByteSlice(limit))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("裁剪完成，共删除%d个交易", pruned))
+	return nil
+}
+
+//获取裁剪高度，未裁剪时为0
+func (bc *BlockChain) prunedHeight() uint64 {
+	var height uint64
+	bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(prunedHeightKey))
+		if len(value) == 8 {
+			height = ByteSliceToUint(value)
+		}
+		return nil
+	})
+	return height
+}
+
+//判断交易是否还有未消耗的output
+func (bc *BlockChain) hasUnspentOutput(tx *Transaction) bool {
+	for i := range tx.TXOutputs {
+		if _, ok := bc.utxoSet.utxos[outpointKey(tx.TXID, int64(i))]; ok {
+			return true
+		}
+	}
+	return false
+}
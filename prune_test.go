@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+//统计区块链中保存的交易个数
+func countTestTransactions(t *testing.T, bc *BlockChain) int {
+	t.Helper()
+	count := 0
+	it := bc.NewIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			t.Fatal("读取区块失败")
+		}
+		count += len(block.Transactions)
+		if len(block.PrevHash) == 0 {
+			return count
+		}
+	}
+}
+
+func TestPruneKeepsBalances(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	miner := newTestWallet(t)
+	minerAddress := miner.getAddress(activeNetwork)
+
+	//tx1花费创世块奖励，tx2花费tx1：创世块挖矿交易和tx1的output全部被消耗
+	tx1 := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, minerAddress, "1"), tx1}); err != nil {
+		t.Fatal(err)
+	}
+	tx2 := newTestSpend(t, w, tx1, 0, address, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, minerAddress, "2"), tx2}); err != nil {
+		t.Fatal(err)
+	}
+	appendTestBlocks(t, bc, 4, minerAddress, minerAddress)
+
+	balance := func(w *Wallet) int64 {
+		return bc.utxoSet.Balance(GetPubKeyHashFromPublicKey(w.PublicKey))
+	}
+	wantW, wantMiner := balance(w), balance(miner)
+	before := countTestTransactions(t, bc)
+	tail := bc.tail
+
+	if err := bc.Prune(2); err != nil {
+		t.Fatal(err)
+	}
+	if after := countTestTransactions(t, bc); after != before-2 {
+		t.Fatalf("裁剪后有%d个交易，期望%d个", after, before-2)
+	}
+	if _, ok := bc.TxBlockHeight(tx1.TXID); ok {
+		t.Fatal("被裁剪的交易应从交易索引中删除")
+	}
+	if !bytes.Equal(bc.tail, tail) {
+		t.Fatal("裁剪不应改变最后一个区块")
+	}
+	if balance(w) != wantW || balance(miner) != wantMiner {
+		t.Fatalf("裁剪后金额为%d和%d，期望%d和%d", balance(w), balance(miner), wantW, wantMiner)
+	}
+
+	//仍可以花费保留的output
+	tx3 := newTestSpend(t, w, tx2, 0, address, 10000)
+	if !bc.VerifyTransaction(tx3) {
+		t.Fatal("引用保留交易的新交易应通过校验")
+	}
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, minerAddress, "3"), tx3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := balance(w); got != wantW-10000 {
+		t.Fatalf("金额为%d，期望%d", got, wantW-10000)
+	}
+
+	//裁剪后不能重建UTXO集合
+	if err := bc.ReindexAll(); err == nil {
+		t.Fatal("裁剪后重建UTXO集合应返回错误")
+	}
+	//裁剪后无法计算手续费，货币总量返回0
+	if got := bc.TotalSupply(0); got != 0 {
+		t.Fatalf("裁剪后货币总量为%d，期望0", got)
+	}
+}
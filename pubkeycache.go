@@ -0,0 +1,56 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"sync"
+)
+
+//解析后的ECDSA公钥缓存的容量
+const pubKeyCacheSize = 4096
+
+//ECDSA公钥缓存（LRU）：重复校验同一公钥的签名时（如链重组、重新校验区块）不再重复解析公钥
+type pubKeyCache struct {
+	mux      sync.Mutex
+	capacity int
+	order    *list.List               //按使用时间排序，最近使用的在前面
+	items    map[string]*list.Element //key为公钥字节
+}
+
+//缓存项
+type pubKeyCacheEntry struct {
+	key    string
+	pubKey *ecdsa.PublicKey
+}
+
+//全局的ECDSA公钥缓存
+var ecdsaPubKeyCache = newPubKeyCache(pubKeyCacheSize)
+
+func newPubKeyCache(capacity int) *pubKeyCache {
+	return &pubKeyCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+//获取公钥字节对应的公钥，不存在时使用parse解析并加入缓存（缓存已满时淘汰最久未使用的公钥）
+//返回的公钥被多个调用者共享，不能修改
+func (c *pubKeyCache) get(pubKey []byte, parse func([]byte) *ecdsa.PublicKey) *ecdsa.PublicKey {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if element, ok := c.items[string(pubKey)]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*pubKeyCacheEntry).pubKey
+	}
+
+	key := parse(pubKey)
+	c.items[string(pubKey)] = c.order.PushFront(&pubKeyCacheEntry{string(pubKey), key})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*pubKeyCacheEntry).key)
+	}
+	return key
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPubKeyCacheLRU(t *testing.T) {
+	cache := newPubKeyCache(2)
+	parsed := 0
+	parse := func(pubKey []byte) *ecdsa.PublicKey {
+		parsed++
+		return parseECDSAPublicKey(pubKey)
+	}
+	a, b, c := newTestWallet(t).PublicKey, newTestWallet(t).PublicKey, newTestWallet(t).PublicKey
+
+	first := cache.get(a, parse)
+	if cache.get(a, parse) != first || parsed != 1 {
+		t.Fatalf("重复获取同一公钥时解析了%d次", parsed)
+	}
+	//a最近被使用，缓存已满时淘汰b
+	cache.get(b, parse)
+	cache.get(a, parse)
+	cache.get(c, parse)
+	if parsed != 3 || len(cache.items) != 2 || cache.order.Len() != 2 {
+		t.Fatalf("解析了%d次，缓存中有%d个公钥", parsed, len(cache.items))
+	}
+	if _, ok := cache.items[string(b)]; ok {
+		t.Fatal("最久未使用的公钥没有被淘汰")
+	}
+	if cache.get(a, parse) != first || parsed != 3 {
+		t.Fatal("最近使用的公钥被淘汰")
+	}
+	if got := cache.get(b, parse); got.X.Cmp(parseECDSAPublicKey(b).X) != 0 || parsed != 4 {
+		t.Fatal("被淘汰的公钥重新解析错误")
+	}
+}
+
+func TestPubKeyCacheConcurrent(t *testing.T) {
+	cache := newPubKeyCache(8)
+	var keys [][]byte
+	for i := 0; i < 16; i++ {
+		keys = append(keys, newTestWallet(t).PublicKey)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := keys[(g+i)%len(keys)]
+				if got := cache.get(key, parseECDSAPublicKey); got.X.Cmp(parseECDSAPublicKey(key).X) != 0 {
+					errs <- fmt.Errorf("第%d个公钥解析错误", (g+i)%len(keys))
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if len(cache.items) > 8 || cache.order.Len() != len(cache.items) {
+		t.Fatalf("缓存中有%d个公钥，超过容量", len(cache.items))
+	}
+}
+
+//重复校验同一交易：uncached使用容量为0的缓存，每次都解析公钥
+func BenchmarkVerifyCachedPubKey(b *testing.B) {
+	w := newTestWallet(b)
+	tx, prevTXs := newWideTestTX(b, w, 10)
+	if !tx.Sign(w.PrivateKey, prevTXs, SigHashAll) {
+		b.Fatal("交易签名失败")
+	}
+	saved := ecdsaPubKeyCache
+	defer func() { ecdsaPubKeyCache = saved }()
+	for _, bench := range []struct {
+		name     string
+		capacity int
+	}{
+		{"uncached", 0},
+		{"cached", pubKeyCacheSize},
+	} {
+		ecdsaPubKeyCache = newPubKeyCache(bench.capacity)
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !tx.Verify(prevTXs) {
+					b.Fatal("交易校验失败")
+				}
+			}
+		})
+	}
+}
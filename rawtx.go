@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//TxSummary 交易概要
+type TxSummary struct {
+	TXID        []byte //交易ID
+	IsCoinbase  bool   //是否为挖矿交易
+	NumInputs   int    //input个数
+	NumOutputs  int    //output个数
+	TotalOutput int64  //outputs总额（单位：聪）
+	Fee         int64  //手续费（单位：聪），HasFee为false时无效
+	HasFee      bool   //是否已计算手续费（需要inputs引用的交易）
+	Size        int    //序列化后的字节数
+}
+
+//DecodeRawTransaction 解析十六进制编码的序列化交易，并校验交易ID与交易内容一致
+func DecodeRawTransaction(hexStr string) (*Transaction, error) {
+	serialized, err := hex.DecodeString(strings.TrimSpace(hexStr))
+	if err != nil {
+		return nil, errors.New("交易不是有效的十六进制数据")
+	}
+	return decodeTransaction(serialized)
+}
+
+//解析序列化交易，并重新计算交易ID防止伪造
+func decodeTransaction(serialized []byte) (*Transaction, error) {
+	tx, err := DeserializeTransaction(serialized)
+	if err != nil {
+		return nil, errors.New("交易格式错误: " + err.Error())
+	}
+
+	if err := tx.checkTXID(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//Inspect 获取交易概要（不计算手续费），outputs总额溢出时返回错误
+func (tx *Transaction) Inspect() (TxSummary, error) {
+	return tx.InspectWithPrevTXs(nil)
+}
+
+//InspectWithPrevTXs 获取交易概要，提供inputs引用的所有交易时计算手续费，outputs总额溢出时返回错误
+func (tx *Transaction) InspectWithPrevTXs(prevTXs map[string]*Transaction) (TxSummary, error) {
+	totalOutput, err := tx.outputsTotal()
+	if err != nil {
+		return TxSummary{}, err
+	}
+	summary := TxSummary{
+		TXID:        tx.TXID,
+		IsCoinbase:  tx.isCoinBaseTX(),
+		NumInputs:   len(tx.TXInputs),
+		NumOutputs:  len(tx.TXOutputs),
+		TotalOutput: totalOutput,
+		Size:        tx.SerializedSize(),
+	}
+	if summary.IsCoinbase || prevTXs == nil {
+		return summary, nil
+	}
+	fee, err := checkTxBalance(tx, prevTXs)
+	if err != nil {
+		return summary, nil
+	}
+	summary.Fee = fee
+	summary.HasFee = true
+	return summary, nil
+}
+
+//String方法
+func (s TxSummary) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("TXID: %x", s.TXID))
+	lines = append(lines, fmt.Sprintf("Coinbase: %t", s.IsCoinbase))
+	lines = append(lines, fmt.Sprintf("Inputs: %d", s.NumInputs))
+	lines = append(lines, fmt.Sprintf("Outputs: %d", s.NumOutputs))
+	lines = append(lines, fmt.Sprintf("Total output: %d", s.TotalOutput))
+	if s.HasFee {
+		lines = append(lines, fmt.Sprintf("Fee: %d", s.Fee))
+	}
+	lines = append(lines, fmt.Sprintf("Size: %d", s.Size))
+	return strings.Join(lines, "\n")
+}
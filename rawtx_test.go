@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRawTransaction(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	decoded, err := DecodeRawTransaction(hex.EncodeToString(tx.Serialize()) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.TXID, tx.TXID) || !bytes.Equal(decoded.Serialize(), tx.Serialize()) {
+		t.Fatal("解析后的交易与原交易不一致")
+	}
+
+	want := TxSummary{
+		TXID:        tx.TXID,
+		NumInputs:   1,
+		NumOutputs:  2,
+		TotalOutput: 49 * SatoshiPerBTC,
+		Size:        tx.SerializedSize(),
+	}
+	if got, err := decoded.Inspect(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("交易概要为%+v, %v，期望%+v", got, err, want)
+	}
+	want.Fee, want.HasFee = SatoshiPerBTC, true
+	if got, err := decoded.InspectWithPrevTXs(prevTXs); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("交易概要为%+v, %v，期望%+v", got, err, want)
+	}
+
+	coinbase := newCoinbaseTX(newTestWallet(t).getAddress(activeNetwork), "", 1, initialReward)
+	decoded, err = DecodeRawTransaction(hex.EncodeToString(coinbase.Serialize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary, err := decoded.Inspect(); err != nil || !summary.IsCoinbase || summary.TotalOutput != initialReward || summary.HasFee {
+		t.Fatalf("挖矿交易概要为%+v", summary)
+	}
+}
+
+func TestDecodeRawTransactionRejected(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, _ := newFixedTestTX(priKey)
+	//修改output后交易ID与内容不一致
+	tx.TXOutputs[0].Value++
+
+	for name, hexStr := range map[string]string{
+		"非十六进制":   "zz",
+		"交易格式错误":  "0102",
+		"交易ID不一致": hex.EncodeToString(tx.Serialize()),
+	} {
+		if _, err := DecodeRawTransaction(hexStr); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	链重组：
+		两个区块连接在同一个前区块之后时产生分叉，节点选择累计工作量最大的链作为主链。
+		分叉的累计工作量超过主链时，从分叉点断开主链上的区块（撤销其UTXO变化），
+		再依次连接分叉上的区块；被断开区块中的普通交易放回交易池，挖矿交易直接丢弃。
+*/
+
+//保存分叉区块，分叉累计工作量超过主链时进行链重组
+func (bc *BlockChain) acceptForkBlock(block *Block) error {
+	//只保存区块数据，不修改最后一个区块
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket == nil {
+			return errors.New("No bucket")
+		}
+		return bucket.Put(block.Hash, block.Serialize())
+	})
+	if err != nil {
+		return err
+	}
+
+	//比较累计工作量
+	forkWork, err := bc.chainWork(block.Hash)
+	if err != nil {
+		return err
+	}
+	mainWork, err := bc.chainWork(bc.tail)
+	if err != nil {
+		return err
+	}
+	if forkWork.Cmp(mainWork) <= 0 {
+		logger.Info("收到分叉区块，累计工作量不足，暂不切换")
+		return nil
+	}
+
+	logger.Info("分叉累计工作量更大，开始链重组")
+	return bc.reorganize(block)
+}
+
+//计算从创世块到指定区块的累计工作量
+func (bc *BlockChain) chainWork(hash []byte) (*big.Int, error) {
+	work := new(big.Int)
+	for len(hash) != 0 {
+		block := bc.GetBlock(hash)
+		if block == nil {
+			return nil, errors.New("区块不存在")
+		}
+		work.Add(work, NewProofOfWork(block).Work())
+		hash = block.PrevHash
+	}
+	return work, nil
+}
+
+//切换到以newTip结尾的分叉
+func (bc *BlockChain) reorganize(newTip *Block) error {
+	//主链上的所有区块
+	mainChain := make(map[string]bool)
+	for hash := bc.tail; len(hash) != 0; {
+		block := bc.GetBlock(hash)
+		if block == nil {
+			return errors.New("区块不存在")
+		}
+		mainChain[string(hash)] = true
+		hash = block.PrevHash
+	}
+
+	//从分叉向前找到分叉点，得到需要连接的区块（从分叉点之后开始）
+	var attach []*Block
+	forkPoint := newTip
+	for !mainChain[string(forkPoint.Hash)] {
+		attach = append([]*Block{forkPoint}, attach...)
+		forkPoint = bc.GetBlock(forkPoint.PrevHash)
+		if forkPoint == nil {
+			return errors.New("分叉区块不存在")
+		}
+	}
+
+	//从最后一个区块开始断开主链，直到分叉点
+	var detach []*Block
+	for !bytes.Equal(bc.tail, forkPoint.Hash) {
+		block := bc.GetBlock(bc.tail)
+		err := bc.disconnectBlock(block)
+		if err != nil {
+			return err
+		}
+		detach = append(detach, block)
+	}
+
+	//依次连接分叉上的区块
+	for i, block := range attach {
+		err := bc.verifyBlock(block)
+		if err == nil {
+			err = bc.connectBlock(block)
+		}
+		if err != nil {
+			//分叉无效：恢复原来的主链
+			logger.Warn("分叉区块无效，恢复主链:", err)
+			for j := i - 1; j >= 0; j-- {
+				bc.disconnectBlock(attach[j])
+			}
+			for j := len(detach) - 1; j >= 0; j-- {
+				bc.connectBlock(detach[j])
+			}
+			return err
+		}
+	}
+
+	//被断开区块中的普通交易放回交易池（已被新主链打包或与其冲突的交易会被拒绝）
+	for i := len(detach) - 1; i >= 0; i-- {
+		for _, tx := range detach[i].Transactions {
+			if !tx.isCoinBaseTX() {
+				bc.mempool.add(tx)
+			}
+		}
+	}
+	logger.Info("链重组完成")
+	return nil
+}
+
+//断开最后一个区块：撤销UTXO变化，删除交易索引，最后一个区块改为其前区块
+func (bc *BlockChain) disconnectBlock(block *Block) error {
+	if !bytes.Equal(block.Hash, bc.tail) {
+		return errors.New("只能断开最后一个区块")
+	}
+
+	//撤销UTXO变化（需要通过交易索引查找引用的交易，因此先于删除索引）
+	err := bc.utxoSet.Rollback(block, bc)
+	if err != nil {
+		return err
+	}
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket == nil {
+			return errors.New("No bucket")
+		}
+		err := bucket.Put([]byte(lastBlockHashKey), block.PrevHash)
+		if err != nil {
+			return err
+		}
+		//删除交易索引
+		indexBucket := tx.Bucket([]byte(txIndexBucket))
+		if indexBucket != nil {
+			for _, transaction := range block.Transactions {
+				err = indexBucket.Delete(transaction.TXID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		bc.tail = block.PrevHash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bc.utxoSet.Save(utxoSetFile)
+}
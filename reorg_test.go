@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+//后到达的分叉更长时切换到分叉：主链区块的交易回到交易池，其挖矿奖励从UTXO集合移除
+func TestReorganizeToLongerFork(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	mainMiner := newTestWallet(t)
+	forkMiner := newTestWallet(t)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	genesis := bc.tail
+
+	//主链：高度1的区块包含一个普通交易
+	spend := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 10000)
+	err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, mainMiner.getAddress(activeNetwork), "main 1"), spend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainTip := bc.tail
+
+	//分叉的第一个区块：累计工作量与主链相同，不切换
+	fork1 := NewBlock([]*Transaction{bc.NewCoinbaseTX(forkMiner.getAddress(activeNetwork), "fork 1", 1)}, genesis, 1)
+	if err := bc.AcceptBlock(fork1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tail, mainTip) {
+		t.Fatal("累计工作量相同的分叉不应替换主链")
+	}
+
+	//分叉的第二个区块：分叉更长，切换到分叉
+	fork2 := NewBlock([]*Transaction{bc.NewCoinbaseTX(forkMiner.getAddress(activeNetwork), "fork 2", 2)}, fork1.Hash, 2)
+	if err := bc.AcceptBlock(fork2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tail, fork2.Hash) {
+		t.Fatal("更长的分叉应成为主链")
+	}
+	if height, _ := bc.Height(); height != 2 {
+		t.Fatalf("区块链高度为%d，期望2", height)
+	}
+
+	//主链区块的普通交易回到交易池
+	if bc.mempool.Get(spend.TXID) == nil {
+		t.Fatal("被断开区块中的交易应回到交易池")
+	}
+	if _, ok := bc.TxBlockHeight(spend.TXID); ok {
+		t.Fatal("被断开区块中的交易不应有区块高度")
+	}
+
+	//UTXO集合：主链挖矿奖励被移除，分叉挖矿奖励加入，创世块奖励恢复为未花费
+	balance := func(w *Wallet) int64 {
+		return bc.utxoSet.Balance(GetPubKeyHashFromPublicKey(w.PublicKey))
+	}
+	if got := balance(mainMiner); got != 0 {
+		t.Fatalf("被断开区块的挖矿奖励为%d，期望0", got)
+	}
+	if got := balance(forkMiner); got != 2*initialReward {
+		t.Fatalf("分叉的挖矿奖励为%d，期望%d", got, 2*initialReward)
+	}
+	if got := balance(w); got != initialReward {
+		t.Fatalf("创世块奖励为%d，期望%d", got, initialReward)
+	}
+	for _, w := range []*Wallet{w, mainMiner, forkMiner} {
+		pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+		want := sortedUTXOKeys(bc.FindMyUTXO(pubKeyHash))
+		if got := sortedUTXOKeys(bc.utxoSet.FindUTXO(pubKeyHash)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("链重组后UTXO集合为%v，遍历账本得到%v", got, want)
+		}
+	}
+}
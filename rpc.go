@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+//RPCServer 节点的HTTP RPC服务：请求和响应均为JSON
+type RPCServer struct {
+	bc *BlockChain
+}
+
+//发送交易请求：tx为序列化交易的十六进制字符串
+type sendRawTransactionRequest struct {
+	Tx string `json:"tx"`
+}
+
+//发送交易响应
+type sendRawTransactionResponse struct {
+	TXID  string `json:"txid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+//NewRPCServer 创建RPC服务
+func NewRPCServer(bc *BlockChain) *RPCServer {
+	return &RPCServer{bc: bc}
+}
+
+//Handler 获取RPC服务的HTTP路由
+func (s *RPCServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sendrawtransaction", s.handleSendRawTransaction)
+	return mux
+}
+
+//ListenAndServe 在指定地址启动RPC服务
+func (s *RPCServer) ListenAndServe(addr string) error {
+	logger.Info("RPC服务启动:", addr)
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+//SendRawTransaction 反序列化并校验交易，加入交易池，返回交易ID
+func (s *RPCServer) SendRawTransaction(serialized []byte) (txid string, err error) {
+	tx, err := decodeTransaction(serialized)
+	if err != nil {
+		return "", err
+	}
+
+	//校验签名并加入交易池
+	err = s.bc.mempool.Add(tx)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tx.TXID), nil
+}
+
+//处理发送交易请求：POST {"tx": "<hex>"}
+func (s *RPCServer) handleSendRawTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, sendRawTransactionResponse{Error: "只支持POST请求"})
+		return
+	}
+
+	var req sendRawTransactionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, sendRawTransactionResponse{Error: "请求格式错误: " + err.Error()})
+		return
+	}
+	serialized, err := hex.DecodeString(req.Tx)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, sendRawTransactionResponse{Error: "交易不是有效的十六进制字符串"})
+		return
+	}
+
+	txid, err := s.SendRawTransaction(serialized)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, sendRawTransactionResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, sendRawTransactionResponse{TXID: txid})
+}
+
+//以JSON格式写入响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//向RPC服务发送交易，返回状态码和响应
+func postRawTransaction(t *testing.T, url string, body string) (int, sendRawTransactionResponse) {
+	t.Helper()
+	resp, err := http.Post(url+"/sendrawtransaction", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result sendRawTransactionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestRPCSendRawTransaction(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	server := httptest.NewServer(NewRPCServer(bc).Handler())
+	defer server.Close()
+
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 10000)
+	body, _ := json.Marshal(sendRawTransactionRequest{Tx: hex.EncodeToString(tx.Serialize())})
+	status, result := postRawTransaction(t, server.URL, string(body))
+	if status != http.StatusOK {
+		t.Fatalf("状态码为%d: %s", status, result.Error)
+	}
+	if result.TXID != hex.EncodeToString(tx.TXID) {
+		t.Fatalf("返回的交易ID为%s，期望%x", result.TXID, tx.TXID)
+	}
+	if bc.mempool.Get(tx.TXID) == nil {
+		t.Fatal("交易应加入交易池")
+	}
+
+	//篡改签名的交易
+	forged := newTestSpend(t, w, genesisCoinbase(t, bc), 0, payee, 20000)
+	forged.TXInputs[0].ScriptSign[0] ^= 0xff
+	forgedBody, _ := json.Marshal(sendRawTransactionRequest{Tx: hex.EncodeToString(forged.Serialize())})
+
+	for name, body := range map[string]string{
+		"非JSON":  "not json",
+		"非十六进制":  `{"tx": "zz"}`,
+		"交易格式错误": `{"tx": "0102"}`,
+		"签名无效":   string(forgedBody),
+	} {
+		status, result := postRawTransaction(t, server.URL, body)
+		if status != http.StatusBadRequest || result.Error == "" {
+			t.Errorf("%s: 状态码为%d，错误为%q，期望400", name, status, result.Error)
+		}
+	}
+	if bc.mempool.Get(forged.TXID) != nil {
+		t.Fatal("无效交易不应加入交易池")
+	}
+}
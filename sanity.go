@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+)
+
+//锁定脚本和解锁脚本的最大长度
+const maxScriptSize = 10000
+
+//CheckSanity 检查交易结构：不需要区块链即可发现的问题（版本号不能超过MaxTxVersion）
+//input和output不能为空、input不能重复引用同一个output、脚本不能过长、output的锁定脚本必须符合其类型（如P2PKH为20字节）、
+//金额必须为正数（数据output和挖矿交易金额可以为0）
+func (tx *Transaction) CheckSanity() error {
+	//使用了未知规则的交易
+	if tx.Version < 0 || tx.Version > MaxTxVersion {
+		return fmt.Errorf("交易%x的版本号%d不受支持", tx.TXID, tx.Version)
+	}
+	if len(tx.TXInputs) == 0 {
+		return fmt.Errorf("交易%x没有input", tx.TXID)
+	}
+	if len(tx.TXOutputs) == 0 {
+		return fmt.Errorf("交易%x没有output", tx.TXID)
+	}
+
+	//input：只有挖矿交易可以有一个不引用output的input
+	coinbase := tx.isCoinBaseTX()
+	seen := make(map[string]bool)
+	for i, input := range tx.TXInputs {
+		if len(input.ScriptSign) > maxScriptSize || len(input.PubKey) > maxScriptSize {
+			return fmt.Errorf("交易%x的第%d个input脚本过长", tx.TXID, i)
+		}
+		if coinbase {
+			continue
+		}
+		if len(input.TXID) == 0 || input.Index < 0 {
+			return fmt.Errorf("交易%x的第%d个input没有引用output", tx.TXID, i)
+		}
+		key := outpointKey(input.TXID, input.Index)
+		if seen[key] {
+			return fmt.Errorf("交易%x的第%d个input重复引用output %s", tx.TXID, i, key)
+		}
+		seen[key] = true
+	}
+
+	//output：金额为正数且总额不超过货币总量
+	var total int64
+	for i, output := range tx.TXOutputs {
+		if len(output.ScriptPubKeyHash) > maxScriptSize {
+			return fmt.Errorf("交易%x的第%d个output脚本过长", tx.TXID, i)
+		}
+		//锁定脚本数据的长度必须符合类型
+		if _, err := output.Script(); err != nil {
+			return fmt.Errorf("交易%x的第%d个output锁定脚本无效: %v", tx.TXID, i, err)
+		}
+		//Taproot output需要新版本交易
+		if output.ScriptType == ScriptTaproot && tx.Version < taprootTxVersion {
+			return fmt.Errorf("交易%x的版本号%d不能创建Taproot output", tx.TXID, tx.Version)
+		}
+		//数据output和挖矿交易（奖励减半为0后）的金额可以为0
+		if output.Value < 0 || output.Value == 0 && output.ScriptType != ScriptData && !coinbase || output.Value > maxMoney {
+			return fmt.Errorf("交易%x的第%d个output金额无效", tx.TXID, i)
+		}
+		var err error
+		if total, err = addSatoshi(total, output.Value); err != nil {
+			return fmt.Errorf("交易%x的output总额超过货币总量", tx.TXID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckSanity(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	valid, _ := newFixedTestTX(priKey)
+	if err := valid.CheckSanity(); err != nil {
+		t.Fatalf("结构正确的交易检查失败: %v", err)
+	}
+	coinbase := newCoinbaseTX(newTestWallet(t).getAddress(activeNetwork), "", 1, initialReward)
+	if err := coinbase.CheckSanity(); err != nil {
+		t.Fatalf("挖矿交易检查失败: %v", err)
+	}
+
+	cases := map[string]func(tx *Transaction){
+		"没有input":  func(tx *Transaction) { tx.TXInputs = nil },
+		"没有output": func(tx *Transaction) { tx.TXOutputs = nil },
+		"重复input":  func(tx *Transaction) { tx.TXInputs = append(tx.TXInputs, tx.TXInputs[0]) },
+		"input没有引用": func(tx *Transaction) {
+			tx.TXInputs = append(tx.TXInputs, TXInput{Index: 0, Sequence: SequenceFinal})
+		},
+		"负数索引":       func(tx *Transaction) { tx.TXInputs[0].Index = -2 },
+		"解锁脚本过长":     func(tx *Transaction) { tx.TXInputs[0].ScriptSign = make([]byte, maxScriptSize+1) },
+		"锁定脚本过长":     func(tx *Transaction) { tx.TXOutputs[0].ScriptPubKeyHash = make([]byte, maxScriptSize+1) },
+		"金额为0":       func(tx *Transaction) { tx.TXOutputs[0].Value = 0 },
+		"金额为负数":      func(tx *Transaction) { tx.TXOutputs[0].Value = -1 },
+		"金额超过货币总量":   func(tx *Transaction) { tx.TXOutputs[0].Value = maxMoney + 1 },
+		"output总额过大": func(tx *Transaction) { tx.TXOutputs[0].Value, tx.TXOutputs[1].Value = maxMoney, 1 },
+	}
+	for name, mutate := range cases {
+		tx, _ := newFixedTestTX(priKey)
+		mutate(tx)
+		if err := tx.CheckSanity(); err == nil {
+			t.Errorf("%s: 检查应失败", name)
+		}
+	}
+
+	//数据output的金额可以为0
+	tx, _ := newFixedTestTX(priKey)
+	tx.TXOutputs = append(tx.TXOutputs, TXOutput{ScriptType: ScriptData, ScriptPubKeyHash: bytes.Repeat([]byte{0x44}, 8)})
+	if err := tx.CheckSanity(); err != nil {
+		t.Fatalf("金额为0的数据output检查失败: %v", err)
+	}
+}
+
+func TestDuplicateInputRejected(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	coinbase := genesisCoinbase(t, bc)
+
+	//两个input引用同一个output，输出金额为output金额的两倍
+	tx := newTestSpend(t, w, coinbase, 0, w.getAddress(activeNetwork), 0)
+	tx.TXInputs = append(tx.TXInputs, tx.TXInputs[0])
+	tx.TXOutputs[0].Value *= 2
+	for i := range tx.TXInputs {
+		tx.TXInputs[i].ScriptSign = nil
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	prevTXs := map[string]*Transaction{string(coinbase.TXID): coinbase}
+	if tx.Sign(w.signingKey(), prevTXs, SigHashAll) {
+		t.Fatal("重复引用output的交易不应签名")
+	}
+	//Sign拒绝结构无效的交易，直接计算每个input的签名
+	cache := newSigHashCache(tx, prevTXs)
+	for i := range tx.TXInputs {
+		hash, err := cache.sigHash(i, SigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.TXInputs[i].ScriptSign, err = signHash(w.signingKey(), hash, SigHashAll); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tx.CheckSanity(); err == nil {
+		t.Fatal("重复引用output的交易检查应失败")
+	}
+	if tx.Verify(prevTXs) {
+		t.Fatal("重复引用output的交易校验应失败")
+	}
+	if err := bc.mempool.Add(tx); err == nil {
+		t.Fatal("重复引用output的交易不应加入交易池")
+	}
+
+	height, err := bc.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := NewBlock([]*Transaction{newTestCoinbase(t, bc, w.getAddress(activeNetwork), ""), tx}, bc.tail, height+1)
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("包含重复引用output交易的区块校验应失败")
+	}
+}
+
+func TestCheckSanityScriptTypes(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	pubKey := newTestWallet(t).PublicKey
+	//m-of-n多重签名的锁定脚本数据
+	multisig := func(m int, pubKeys ...[]byte) []byte {
+		return (&multisigScript{m: m, pubKeys: pubKeys}).Lock()
+	}
+	var keys [][]byte
+	for i := 0; i <= maxMultisigKeys; i++ {
+		keys = append(keys, pubKey)
+	}
+
+	cases := []struct {
+		name       string
+		scriptType ScriptType
+		lockData   []byte
+		valid      bool
+	}{
+		{"P2PKH", ScriptP2PKH, make([]byte, 20), true},
+		{"P2PKH过短", ScriptP2PKH, make([]byte, 19), false},
+		{"P2PKH过长", ScriptP2PKH, make([]byte, 21), false},
+		{"P2SH", ScriptP2SH, make([]byte, 20), true},
+		{"P2SH过长", ScriptP2SH, make([]byte, 32), false},
+		{"时间锁定", ScriptTimeLock, make([]byte, 28), true},
+		{"时间锁定过短", ScriptTimeLock, make([]byte, 20), false},
+		{"Taproot", ScriptTaproot, make([]byte, 32), true},
+		{"Taproot过短", ScriptTaproot, make([]byte, 20), false},
+		{"数据", ScriptData, make([]byte, maxDataSize), true},
+		{"数据过长", ScriptData, make([]byte, maxDataSize+1), false},
+		{"多重签名", ScriptMultisig, multisig(2, pubKey, pubKey, pubKey), true},
+		{"多重签名m过大", ScriptMultisig, multisig(3, pubKey, pubKey), false},
+		{"多重签名公钥过多", ScriptMultisig, multisig(1, keys...), false},
+		{"多重签名公钥过长", ScriptMultisig, multisig(1, make([]byte, maxPubKeySize+1)), false},
+		{"多重签名为空", ScriptMultisig, nil, false},
+		{"未知类型", ScriptType(250), make([]byte, 20), false},
+	}
+	for _, c := range cases {
+		tx, _ := newFixedTestTX(priKey)
+		tx.Version = CurrentTxVersion
+		tx.TXOutputs[0].ScriptType = c.scriptType
+		tx.TXOutputs[0].ScriptPubKeyHash = c.lockData
+		if err := tx.CheckSanity(); (err == nil) != c.valid {
+			t.Errorf("%s: 检查结果为%v，期望有效为%v", c.name, err, c.valid)
+		}
+	}
+}
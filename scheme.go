@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+/*
+	签名算法：
+		默认使用ECDSA-P256，公钥为X||Y；
+		Ed25519钱包的公钥为算法标识(1字节) + 32字节公钥，地址（公钥哈希）同时锁定了签名算法，
+		校验签名时根据公钥判断使用哪种算法。
+		两种算法的签名都是64字节（||签名类型）。
+*/
+
+//SignatureScheme 签名算法
+type SignatureScheme interface {
+	//Sign 使用私钥对签名数据签名，返回64字节签名
+	Sign(priKey crypto.PrivateKey, hash []byte) ([]byte, error)
+	//Verify 使用公钥（钱包中的公钥字节）校验签名
+	Verify(pubKey []byte, hash []byte, signature []byte) bool
+	//PublicKeyFromBytes 从公钥字节还原公钥
+	PublicKeyFromBytes(pubKey []byte) (crypto.PublicKey, error)
+}
+
+//SchemeID 签名算法标识
+type SchemeID byte
+
+const (
+	//SchemeECDSAP256 ECDSA-P256（默认）
+	SchemeECDSAP256 SchemeID = 0
+	//SchemeEd25519 Ed25519
+	SchemeEd25519 SchemeID = 1
+)
+
+//已支持的签名算法
+var signatureSchemes = map[SchemeID]SignatureScheme{
+	SchemeECDSAP256: ecdsaP256Scheme{},
+	SchemeEd25519:   ed25519Scheme{},
+}
+
+//GetSignatureScheme 根据标识获取签名算法
+func GetSignatureScheme(id SchemeID) (SignatureScheme, error) {
+	scheme, ok := signatureSchemes[id]
+	if !ok {
+		return nil, errors.New("不支持的签名算法")
+	}
+	return scheme, nil
+}
+
+//根据公钥判断签名算法
+func schemeOfPublicKey(pubKey []byte) SchemeID {
+	if len(pubKey) == 1+ed25519.PublicKeySize && pubKey[0] == byte(SchemeEd25519) {
+		return SchemeEd25519
+	}
+	return SchemeECDSAP256
+}
+
+//根据私钥类型判断签名算法
+func schemeOfPrivateKey(priKey crypto.PrivateKey) (SchemeID, error) {
+	switch priKey.(type) {
+	case *ecdsa.PrivateKey:
+		return SchemeECDSAP256, nil
+	case ed25519.PrivateKey:
+		return SchemeEd25519, nil
+	}
+	return 0, errors.New("不支持的私钥类型")
+}
+
+//ECDSA-P256签名：签名为r||s，公钥为X||Y
+type ecdsaP256Scheme struct{}
+
+func (ecdsaP256Scheme) Sign(priKey crypto.PrivateKey, hash []byte) ([]byte, error) {
+	key, ok := priKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("私钥不是ECDSA私钥")
+	}
+	r, s, err := signDeterministic(key, hash)
+	if err != nil {
+		return nil, err
+	}
+	n := key.Curve.Params().N
+	return append(intToOctets(r, n), intToOctets(s, n)...), nil
+}
+
+func (scheme ecdsaP256Scheme) Verify(pubKey []byte, hash []byte, signature []byte) bool {
+	key, err := scheme.PublicKeyFromBytes(pubKey)
+	if err != nil {
+		return false
+	}
+	publicKey := key.(*ecdsa.PublicKey)
+
+	//把r和s从签名中截取出来
+	var r, s big.Int
+	r.SetBytes(signature[:len(signature)/2])
+	s.SetBytes(signature[len(signature)/2:])
+
+	//拒绝high-S签名
+	if !isLowS(&s, publicKey.Curve.Params().N) {
+		logger.Warn("签名不是low-S形式")
+		return false
+	}
+
+	return ecdsa.Verify(publicKey, hash, &r, &s)
+}
+
+//解析后的公钥保存在缓存中，多次校验同一公钥的签名时只解析一次
+func (ecdsaP256Scheme) PublicKeyFromBytes(pubKey []byte) (crypto.PublicKey, error) {
+	if len(pubKey) == 0 {
+		return nil, errors.New("公钥为空")
+	}
+	return ecdsaPubKeyCache.get(pubKey, parseECDSAPublicKey), nil
+}
+
+//ECDSA钱包的公钥字节：X和Y各补齐到曲线字段长度（P-256为32字节）后拼接
+func ecdsaPublicKeyBytes(pubKey *ecdsa.PublicKey) []byte {
+	p := pubKey.Curve.Params().P
+	return append(intToOctets(pubKey.X, p), intToOctets(pubKey.Y, p)...)
+}
+
+//把x和y从pubKey中截取出来，还原公钥本身
+func parseECDSAPublicKey(pubKey []byte) *ecdsa.PublicKey {
+	var x, y big.Int
+	x.SetBytes(pubKey[:len(pubKey)/2])
+	y.SetBytes(pubKey[len(pubKey)/2:])
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+}
+
+//Ed25519签名：公钥为算法标识+32字节公钥
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) Sign(priKey crypto.PrivateKey, hash []byte) ([]byte, error) {
+	key, ok := priKey.(ed25519.PrivateKey)
+	if !ok || len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("私钥不是Ed25519私钥")
+	}
+	return ed25519.Sign(key, hash), nil
+}
+
+func (scheme ed25519Scheme) Verify(pubKey []byte, hash []byte, signature []byte) bool {
+	key, err := scheme.PublicKeyFromBytes(pubKey)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key.(ed25519.PublicKey), hash, signature)
+}
+
+func (ed25519Scheme) PublicKeyFromBytes(pubKey []byte) (crypto.PublicKey, error) {
+	if schemeOfPublicKey(pubKey) != SchemeEd25519 {
+		return nil, errors.New("不是Ed25519公钥")
+	}
+	return ed25519.PublicKey(copyBytes(pubKey[1:])), nil
+}
+
+//Ed25519钱包的公钥字节
+func ed25519PublicKeyBytes(priKey ed25519.PrivateKey) []byte {
+	return append([]byte{byte(SchemeEd25519)}, priKey.Public().(ed25519.PublicKey)...)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+//在两种签名算法的钱包之间转账：ECDSA钱包付款给Ed25519钱包，Ed25519钱包再付款回来
+func TestSignatureSchemesOnChain(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	ed := NewEd25519WalletKeyPair()
+	if ed == nil {
+		t.Fatal("创建Ed25519钱包失败")
+	}
+	if schemeOfPublicKey(ed.PublicKey) != SchemeEd25519 || schemeOfPublicKey(w.PublicKey) != SchemeECDSAP256 {
+		t.Fatal("根据公钥判断签名算法错误")
+	}
+
+	toEd := newTestSpend(t, w, genesisCoinbase(t, bc), 0, ed.getAddress(activeNetwork), 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "1"), toEd}); err != nil {
+		t.Fatal(err)
+	}
+	back := newTestSpend(t, ed, toEd, 0, address, 10000)
+	if len(back.TXInputs[0].ScriptSign) != signatureSize+1 {
+		t.Fatalf("Ed25519签名长度为%d，期望%d", len(back.TXInputs[0].ScriptSign), signatureSize+1)
+	}
+	if err := bc.VerifyTransactionAgainstChain(back); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "2"), back}); err != nil {
+		t.Fatal(err)
+	}
+	if balance, err := bc.Balance(ed.getAddress(activeNetwork)); err != nil || balance != 0 {
+		t.Fatalf("Ed25519钱包金额为%d(%v)，期望0", balance, err)
+	}
+	if block := bc.GetBlock(bc.tail); len(block.Transactions) != 2 || !block.Transactions[1].Equals(back) {
+		t.Fatal("Ed25519钱包的交易应被打包")
+	}
+}
+
+func TestSignatureSchemeSignVerify(t *testing.T) {
+	for _, w := range []*Wallet{newTestWallet(t), NewEd25519WalletKeyPair()} {
+		for _, hashType := range []SigHashType{SigHashAll, SigHashAll | SigHashBIP143} {
+			tx, prevTXs := newWideTestTX(t, w, 2)
+			if !tx.Sign(w.signingKey(), prevTXs, hashType) {
+				t.Fatal("交易签名失败")
+			}
+			if !tx.Verify(prevTXs) {
+				t.Fatalf("签名算法%d的交易校验失败", w.Scheme)
+			}
+			tx.TXOutputs[0].Value--
+			if tx.Verify(prevTXs) {
+				t.Fatalf("签名算法%d：修改output后签名应无效", w.Scheme)
+			}
+		}
+	}
+
+	//使用另一种算法的私钥签名，校验失败
+	ed := NewEd25519WalletKeyPair()
+	tx, prevTXs := newWideTestTX(t, ed, 1)
+	if !tx.Sign(newTestWallet(t).PrivateKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	if tx.Verify(prevTXs) {
+		t.Fatal("其他算法私钥的签名不应通过校验")
+	}
+
+	if _, err := GetSignatureScheme(SchemeID(99)); err == nil {
+		t.Fatal("未知的签名算法应返回错误")
+	}
+	scheme, err := GetSignatureScheme(SchemeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scheme.PublicKeyFromBytes(newTestWallet(t).PublicKey); err == nil {
+		t.Fatal("ECDSA公钥不应被解析为Ed25519公钥")
+	}
+}
+
+func TestEd25519WalletFile(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	ed := NewEd25519WalletKeyPair()
+	w := newTestWallet(t)
+	wm := &WalletManager{Wallets: map[string]*Wallet{
+		ed.getAddress(activeNetwork): ed,
+		w.getAddress(activeNetwork):  w,
+	}}
+	path := filepath.Join(dir, "wallet.dat")
+	if err := wm.SaveWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &WalletManager{}
+	if err := loaded.LoadWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.Wallets[ed.getAddress(activeNetwork)]
+	if got == nil || got.Scheme != SchemeEd25519 || !bytes.Equal(got.PublicKey, ed.PublicKey) {
+		t.Fatal("Ed25519钱包加载后不一致")
+	}
+	if got := loaded.Wallets[w.getAddress(activeNetwork)]; got == nil || got.Scheme != SchemeECDSAP256 {
+		t.Fatal("ECDSA钱包加载后不一致")
+	}
+	if _, err := ed.ExportWIF(); err == nil {
+		t.Fatal("Ed25519钱包不应导出WIF")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+/*
+	Schnorr签名（参照BIP340，曲线为P256）：
+		公钥只保存X坐标(32字节)，对应Y坐标为偶数的点
+		签名为R.x(32字节) || s(32字节)，满足 s*G = R + e*P，e = H(R.x || P.x || 数据)
+*/
+
+//带标签的哈希：sha256(sha256(tag) || sha256(tag) || data)
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	hasher := sha256.New()
+	hasher.Write(tagHash[:])
+	hasher.Write(tagHash[:])
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	return hasher.Sum(nil)
+}
+
+//根据X坐标还原Y坐标为偶数的点（P256的p ≡ 3 mod 4，平方根为c^((p+1)/4)）
+func liftX(curve elliptic.Curve, xBytes []byte) (x, y *big.Int, err error) {
+	params := curve.Params()
+	x = new(big.Int).SetBytes(xBytes)
+	if len(xBytes) != 32 || x.Cmp(params.P) >= 0 {
+		return nil, nil, errors.New("公钥X坐标无效")
+	}
+
+	//c = x^3 - 3x + b mod p
+	c := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	threeX := new(big.Int).Mul(x, big.NewInt(3))
+	c.Sub(c, threeX)
+	c.Add(c, params.B)
+	c.Mod(c, params.P)
+
+	exp := new(big.Int).Add(params.P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y = new(big.Int).Exp(c, exp, params.P)
+	if new(big.Int).Exp(y, big.NewInt(2), params.P).Cmp(c) != 0 {
+		return nil, nil, errors.New("公钥不在曲线上")
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(params.P, y)
+	}
+	return x, y, nil
+}
+
+//私钥对应的Y坐标为偶数的私钥（Y坐标为奇数时取n-d）
+func evenYKey(curve elliptic.Curve, d *big.Int) (key *big.Int, px *big.Int) {
+	n := curve.Params().N
+	x, y := curve.ScalarBaseMult(intToOctets(d, n))
+	if y.Bit(0) == 1 {
+		return new(big.Int).Sub(n, d), x
+	}
+	return new(big.Int).Set(d), x
+}
+
+//Schnorr签名：随机数由私钥、公钥和数据确定性生成
+func schnorrSign(curve elliptic.Curve, d *big.Int, hash []byte) ([]byte, error) {
+	n := curve.Params().N
+	if d.Sign() == 0 || d.Cmp(n) >= 0 {
+		return nil, errors.New("私钥无效")
+	}
+	d, px := evenYKey(curve, d)
+	pxBytes := intToOctets(px, n)
+
+	k := new(big.Int).SetBytes(taggedHash("HIBTC/nonce", intToOctets(d, n), pxBytes, hash))
+	k.Mod(k, n)
+	if k.Sign() == 0 {
+		return nil, errors.New("生成签名失败")
+	}
+	k, rx := evenYKey(curve, k)
+	rxBytes := intToOctets(rx, n)
+
+	//s = k + e*d mod n
+	e := new(big.Int).SetBytes(taggedHash("HIBTC/challenge", rxBytes, pxBytes, hash))
+	e.Mod(e, n)
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, n)
+	return append(rxBytes, intToOctets(s, n)...), nil
+}
+
+//Schnorr签名校验：R = s*G - e*P，R的Y坐标为偶数且X坐标等于签名中的R.x
+func schnorrVerify(curve elliptic.Curve, pubKeyX []byte, hash []byte, signature []byte) bool {
+	params := curve.Params()
+	if len(signature) != signatureSize {
+		return false
+	}
+	px, py, err := liftX(curve, pubKeyX)
+	if err != nil {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if r.Cmp(params.P) >= 0 || s.Cmp(params.N) >= 0 {
+		return false
+	}
+
+	e := new(big.Int).SetBytes(taggedHash("HIBTC/challenge", signature[:32], pubKeyX, hash))
+	e.Mod(e, params.N)
+	//-e*P
+	negE := new(big.Int).Sub(params.N, e)
+	ex, ey := curve.ScalarMult(px, py, intToOctets(negE, params.N))
+	sx, sy := curve.ScalarBaseMult(intToOctets(s, params.N))
+	rx, ry := curve.Add(sx, sy, ex, ey)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
+
+//SchnorrPublicKey 获取私钥对应的Schnorr公钥（32字节X坐标）
+func SchnorrPublicKey(priKey *ecdsa.PrivateKey) []byte {
+	n := priKey.Curve.Params().N
+	_, px := evenYKey(priKey.Curve, priKey.D)
+	return intToOctets(px, n)
+}
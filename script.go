@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+/*
+	锁定脚本：
+		output的ScriptType决定锁定方式，ScriptPubKeyHash保存锁定脚本的数据：
+			P2PKH：收款人的公钥哈希，input提供公钥和签名解锁
+			P2SH：赎回脚本的哈希，input提供赎回脚本（PubKey）和赎回脚本的解锁数据（ScriptSign）
+			Multisig：m和n个公钥，input按公钥顺序提供m个签名（ScriptSign）解锁
+			Data：任意数据，不可花费
+			TimeLock：解锁时间和公钥哈希，花费交易的锁定时间达到解锁时间后，input提供公钥和签名解锁
+		Taproot：32字节的输出公钥，input提供Schnorr签名解锁（密钥路径）
+		添加新的锁定方式：实现Script接口，并通过RegisterScript注册解析函数
+*/
+
+//ScriptType 锁定脚本类型
+type ScriptType uint8
+
+//锁定脚本类型（零值为P2PKH，兼容没有该字段的旧交易）
+const (
+	ScriptP2PKH    ScriptType = iota //支付到公钥哈希
+	ScriptP2SH                       //支付到脚本哈希
+	ScriptMultisig                   //多重签名
+	ScriptData                       //数据（不可花费）
+	ScriptTimeLock                   //时间锁定（解锁时间之后才能花费）
+	ScriptTaproot                    //Taproot（Schnorr签名）
+)
+
+//多重签名最多的公钥个数
+const maxMultisigKeys = 16
+
+//多重签名中单个公钥的最大长度（ECDSA公钥X||Y为64字节，Ed25519公钥为33字节）
+const maxPubKeySize = 65
+
+//数据output最大的数据长度
+const maxDataSize = 80
+
+//Script 锁定脚本
+type Script interface {
+	//Lock 锁定脚本数据（保存在output的ScriptPubKeyHash中）
+	Lock() []byte
+	//CanUnlock 判断input的解锁数据能否解锁output，sigHash根据签名类型计算该input的签名数据
+	CanUnlock(input TXInput, sigHash SigHasher) bool
+}
+
+//锁定脚本解析函数：根据锁定脚本数据创建锁定脚本
+var scriptParsers = make(map[ScriptType]func(lockData []byte) (Script, error))
+
+//RegisterScript 注册锁定脚本类型
+func RegisterScript(scriptType ScriptType, parser func(lockData []byte) (Script, error)) {
+	scriptParsers[scriptType] = parser
+}
+
+func init() {
+	RegisterScript(ScriptP2PKH, parseP2PKHScript)
+	RegisterScript(ScriptP2SH, parseP2SHScript)
+	RegisterScript(ScriptMultisig, parseMultisigScript)
+	RegisterScript(ScriptData, parseDataScript)
+	RegisterScript(ScriptTimeLock, parseTimeLockScript)
+	RegisterScript(ScriptTaproot, parseTaprootScript)
+}
+
+//Script 获取output的锁定脚本
+func (output TXOutput) Script() (Script, error) {
+	return parseScript(output.ScriptType, output.ScriptPubKeyHash)
+}
+
+//根据类型解析锁定脚本
+func parseScript(scriptType ScriptType, lockData []byte) (Script, error) {
+	parser, ok := scriptParsers[scriptType]
+	if !ok {
+		return nil, fmt.Errorf("未知的锁定脚本类型: %d", scriptType)
+	}
+	return parser(lockData)
+}
+
+//判断output是否支付到指定的公钥哈希
+func (output TXOutput) isLockedWith(pubKeyHash []byte) bool {
+	return output.ScriptType == ScriptP2PKH && bytes.Equal(output.ScriptPubKeyHash, pubKeyHash)
+}
+
+//判断output是否可以被花费（数据output不可花费，不计入UTXO）
+func (output TXOutput) isSpendable() bool {
+	return output.ScriptType != ScriptData
+}
+
+//校验单个签名：签名（||签名类型）使用公钥对应的签名算法校验
+func verifySignature(pubKey []byte, signature []byte, sigHash SigHasher) bool {
+	if len(pubKey) == 0 || len(signature) == 0 {
+		return false
+	}
+	//根据签名类型计算签名数据
+	signature, hashType := splitSigHashType(signature)
+	hash := sigHash(hashType)
+	if hash == nil {
+		return false
+	}
+
+	return signatureSchemes[schemeOfPublicKey(pubKey)].Verify(pubKey, hash, signature)
+}
+
+//P2PKH：支付到公钥哈希
+type p2pkhScript struct {
+	pubKeyHash []byte
+}
+
+func parseP2PKHScript(lockData []byte) (Script, error) {
+	if len(lockData) != 20 {
+		return nil, errors.New("公钥哈希长度无效")
+	}
+	return &p2pkhScript{lockData}, nil
+}
+
+func (s *p2pkhScript) Lock() []byte {
+	return s.pubKeyHash
+}
+
+//公钥哈希必须与锁定的公钥哈希相同，且签名有效
+func (s *p2pkhScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	if !bytes.Equal(GetPubKeyHashFromPublicKey(input.PubKey), s.pubKeyHash) {
+		return false
+	}
+	return verifySignature(input.PubKey, input.ScriptSign, sigHash)
+}
+
+//P2SH：支付到脚本哈希
+type p2shScript struct {
+	scriptHash []byte
+}
+
+func parseP2SHScript(lockData []byte) (Script, error) {
+	if len(lockData) != 20 {
+		return nil, errors.New("脚本哈希长度无效")
+	}
+	return &p2shScript{lockData}, nil
+}
+
+func (s *p2shScript) Lock() []byte {
+	return s.scriptHash
+}
+
+//赎回脚本的哈希必须与锁定的哈希相同，且解锁数据能解锁赎回脚本
+func (s *p2shScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	redeemScript := input.PubKey
+	if len(redeemScript) == 0 || !bytes.Equal(GetPubKeyHashFromPublicKey(redeemScript), s.scriptHash) {
+		return false
+	}
+	//不允许嵌套P2SH
+	scriptType := ScriptType(redeemScript[0])
+	if scriptType == ScriptP2SH {
+		return false
+	}
+	script, err := parseScript(scriptType, redeemScript[1:])
+	if err != nil {
+		return false
+	}
+
+	//解锁数据：赎回脚本的签名 + 赎回脚本的公钥
+	reader := bytes.NewReader(input.ScriptSign)
+	scriptSign, err := readBytes(reader)
+	if err != nil {
+		return false
+	}
+	pubKey, err := readBytes(reader)
+	if err != nil || reader.Len() != 0 {
+		return false
+	}
+	inner := TXInput{input.TXID, input.Index, scriptSign, pubKey, input.Sequence}
+	return script.CanUnlock(inner, sigHash)
+}
+
+//RedeemScript 生成赎回脚本：锁定脚本类型(1字节) + 锁定脚本数据
+func RedeemScript(scriptType ScriptType, lockData []byte) []byte {
+	return append([]byte{byte(scriptType)}, lockData...)
+}
+
+//NewP2SHOutput 创建支付到赎回脚本哈希的output
+func NewP2SHOutput(redeemScript []byte, amount int64) (TXOutput, error) {
+	output := TXOutput{Value: amount, ScriptType: ScriptP2SH}
+	if amount < DustThreshold {
+		return output, errors.New("output金额低于粉尘阈值")
+	}
+	output.ScriptPubKeyHash = GetPubKeyHashFromPublicKey(redeemScript)
+	return output, nil
+}
+
+//P2SHScriptSign 生成P2SH input的解锁数据（赎回脚本放在input的PubKey中）
+func P2SHScriptSign(scriptSign []byte, pubKey []byte) []byte {
+	var buffer bytes.Buffer
+	writeBytes(&buffer, scriptSign)
+	writeBytes(&buffer, pubKey)
+	return buffer.Bytes()
+}
+
+//Multisig：m-of-n多重签名
+type multisigScript struct {
+	m       int
+	pubKeys [][]byte
+}
+
+//锁定脚本数据：m(1字节) + n个公钥（长度+内容）
+func parseMultisigScript(lockData []byte) (Script, error) {
+	if len(lockData) == 0 {
+		return nil, errors.New("多重签名脚本为空")
+	}
+	s := multisigScript{m: int(lockData[0])}
+	reader := bytes.NewReader(lockData[1:])
+	for reader.Len() != 0 {
+		pubKey, err := readBytes(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(pubKey) == 0 || len(pubKey) > maxPubKeySize {
+			return nil, errors.New("多重签名公钥长度无效")
+		}
+		s.pubKeys = append(s.pubKeys, pubKey)
+	}
+	if s.m < 1 || s.m > len(s.pubKeys) || len(s.pubKeys) > maxMultisigKeys {
+		return nil, errors.New("多重签名脚本参数无效")
+	}
+	return &s, nil
+}
+
+func (s *multisigScript) Lock() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteByte(byte(s.m))
+	for _, pubKey := range s.pubKeys {
+		writeBytes(&buffer, pubKey)
+	}
+	return buffer.Bytes()
+}
+
+//签名必须按公钥顺序排列，m个签名都有效才能解锁
+func (s *multisigScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	var signatures [][]byte
+	reader := bytes.NewReader(input.ScriptSign)
+	for reader.Len() != 0 {
+		signature, err := readBytes(reader)
+		if err != nil {
+			return false
+		}
+		signatures = append(signatures, signature)
+	}
+	if len(signatures) != s.m {
+		return false
+	}
+
+	//每个签名依次与剩余的公钥匹配
+	k := 0
+	for _, signature := range signatures {
+		for k < len(s.pubKeys) && !verifySignature(s.pubKeys[k], signature, sigHash) {
+			k++
+		}
+		if k == len(s.pubKeys) {
+			return false
+		}
+		k++
+	}
+	return true
+}
+
+//NewMultisigOutput 创建m-of-n多重签名output
+func NewMultisigOutput(m int, pubKeys [][]byte, amount int64) (TXOutput, error) {
+	output := TXOutput{Value: amount, ScriptType: ScriptMultisig}
+	if amount < DustThreshold {
+		return output, errors.New("output金额低于粉尘阈值")
+	}
+	if m < 1 || m > len(pubKeys) || len(pubKeys) > maxMultisigKeys {
+		return output, errors.New("多重签名参数无效")
+	}
+	script := multisigScript{m, pubKeys}
+	output.ScriptPubKeyHash = script.Lock()
+	return output, nil
+}
+
+//MultisigScriptSign 生成多重签名input的解锁数据（签名按公钥顺序排列）
+func MultisigScriptSign(signatures [][]byte) []byte {
+	var buffer bytes.Buffer
+	for _, signature := range signatures {
+		writeBytes(&buffer, signature)
+	}
+	return buffer.Bytes()
+}
+
+//Data：保存任意数据，不可花费
+type dataScript struct {
+	data []byte
+}
+
+func parseDataScript(lockData []byte) (Script, error) {
+	if len(lockData) > maxDataSize {
+		return nil, errors.New("数据过长")
+	}
+	return &dataScript{lockData}, nil
+}
+
+func (s *dataScript) Lock() []byte {
+	return s.data
+}
+
+func (s *dataScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	return false
+}
+
+//NewDataOutput 创建保存数据的output（金额为0）
+func NewDataOutput(data []byte) (TXOutput, error) {
+	if len(data) > maxDataSize {
+		return TXOutput{}, errors.New("数据过长")
+	}
+	return TXOutput{Value: 0, ScriptType: ScriptData, ScriptPubKeyHash: data}, nil
+}
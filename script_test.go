@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+)
+
+//测试用锁定脚本：input的ScriptSign与锁定数据相同即可解锁
+type preimageScript struct {
+	preimage []byte
+}
+
+func (s *preimageScript) Lock() []byte {
+	return s.preimage
+}
+
+func (s *preimageScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	return string(input.ScriptSign) == string(s.preimage)
+}
+
+//创建引用prev所有output的交易，返回交易及每个input的ALL类型签名数据
+func newScriptTestTX(t *testing.T, prev *Transaction, w *Wallet) (*Transaction, [][]byte) {
+	t.Helper()
+	tx := &Transaction{TimeStamp: 1600000600}
+	for i := range prev.TXOutputs {
+		tx.TXInputs = append(tx.TXInputs, TXInput{TXID: prev.TXID, Index: int64(i), Sequence: SequenceFinal})
+	}
+	output, err := NewTXOutput(w.getAddress(activeNetwork), SatoshiPerBTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TXOutputs = []TXOutput{output}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := tx.sigHashes(map[string]*Transaction{string(prev.TXID): prev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx, hashes
+}
+
+func mustSignHash(t *testing.T, w *Wallet, hash []byte) []byte {
+	t.Helper()
+	signature, err := signHash(w.PrivateKey, hash, SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestScriptDispatch(t *testing.T) {
+	w1, w2, w3 := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	p2pkh, err := NewTXOutput(w1.getAddress(activeNetwork), SatoshiPerBTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multisig, err := NewMultisigOutput(2, [][]byte{w1.PublicKey, w2.PublicKey, w3.PublicKey}, SatoshiPerBTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemScript := RedeemScript(ScriptP2PKH, GetPubKeyHashFromPublicKey(w2.PublicKey))
+	p2sh, err := NewP2SHOutput(redeemScript, SatoshiPerBTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := &Transaction{
+		TXInputs:  []TXInput{{Index: -1, PubKey: []byte("scripts"), Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{p2pkh, multisig, p2sh},
+		TimeStamp: 1600000000,
+	}
+	prev.setHash()
+	prevTXs := map[string]*Transaction{string(prev.TXID): prev}
+
+	tx, hashes := newScriptTestTX(t, prev, w1)
+	//P2PKH：公钥+签名
+	tx.TXInputs[0].PubKey = w1.PublicKey
+	tx.TXInputs[0].ScriptSign = mustSignHash(t, w1, hashes[0])
+	//多重签名：按公钥顺序排列的2个签名
+	sig1, sig3 := mustSignHash(t, w1, hashes[1]), mustSignHash(t, w3, hashes[1])
+	tx.TXInputs[1].ScriptSign = MultisigScriptSign([][]byte{sig1, sig3})
+	//P2SH：赎回脚本+赎回脚本的解锁数据
+	tx.TXInputs[2].PubKey = redeemScript
+	tx.TXInputs[2].ScriptSign = P2SHScriptSign(mustSignHash(t, w2, hashes[2]), w2.PublicKey)
+	if !tx.Verify(prevTXs) {
+		t.Fatal("各类型的input都应通过校验")
+	}
+
+	//签名顺序与公钥顺序不一致
+	tx.TXInputs[1].ScriptSign = MultisigScriptSign([][]byte{sig3, sig1})
+	if tx.Verify(prevTXs) {
+		t.Fatal("签名顺序错误的多重签名应被拒绝")
+	}
+	//签名个数不足
+	tx.TXInputs[1].ScriptSign = MultisigScriptSign([][]byte{sig1})
+	if tx.Verify(prevTXs) {
+		t.Fatal("签名个数不足的多重签名应被拒绝")
+	}
+	tx.TXInputs[1].ScriptSign = MultisigScriptSign([][]byte{sig1, sig3})
+
+	//P2SH赎回脚本与锁定的哈希不一致
+	tx.TXInputs[2].PubKey = RedeemScript(ScriptP2PKH, GetPubKeyHashFromPublicKey(w3.PublicKey))
+	if tx.Verify(prevTXs) {
+		t.Fatal("赎回脚本哈希不一致时应被拒绝")
+	}
+	tx.TXInputs[2].PubKey = redeemScript
+
+	//P2PKH公钥与锁定的公钥哈希不一致
+	tx.TXInputs[0].PubKey = w2.PublicKey
+	tx.TXInputs[0].ScriptSign = mustSignHash(t, w2, hashes[0])
+	if tx.Verify(prevTXs) {
+		t.Fatal("公钥哈希不一致的P2PKH input应被拒绝")
+	}
+}
+
+func TestDataOutputUnspendable(t *testing.T) {
+	data, err := NewDataOutput([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.isSpendable() {
+		t.Fatal("数据output不可花费")
+	}
+	if _, err := NewDataOutput(make([]byte, maxDataSize+1)); err == nil {
+		t.Fatal("过长的数据应被拒绝")
+	}
+
+	prev := &Transaction{
+		TXInputs:  []TXInput{{Index: -1, PubKey: []byte("data"), Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{data},
+		TimeStamp: 1600000000,
+	}
+	prev.setHash()
+	tx, _ := newScriptTestTX(t, prev, newTestWallet(t))
+	tx.TXInputs[0].ScriptSign = []byte("hello")
+	if tx.Verify(map[string]*Transaction{string(prev.TXID): prev}) {
+		t.Fatal("花费数据output的交易应被拒绝")
+	}
+}
+
+//注册新的锁定脚本类型后，Verify按类型分派
+func TestRegisterScript(t *testing.T) {
+	const scriptPreimage ScriptType = 200
+	RegisterScript(scriptPreimage, func(lockData []byte) (Script, error) {
+		return &preimageScript{lockData}, nil
+	})
+	defer delete(scriptParsers, scriptPreimage)
+
+	prev := &Transaction{
+		TXInputs:  []TXInput{{Index: -1, PubKey: []byte("preimage"), Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 2 * SatoshiPerBTC, ScriptType: scriptPreimage, ScriptPubKeyHash: []byte("secret")}},
+		TimeStamp: 1600000000,
+	}
+	prev.setHash()
+	prevTXs := map[string]*Transaction{string(prev.TXID): prev}
+
+	tx, _ := newScriptTestTX(t, prev, newTestWallet(t))
+	tx.TXInputs[0].ScriptSign = []byte("secret")
+	if !tx.Verify(prevTXs) {
+		t.Fatal("解锁数据正确时应通过校验")
+	}
+	tx.TXInputs[0].ScriptSign = []byte("wrong")
+	if tx.Verify(prevTXs) {
+		t.Fatal("解锁数据错误时应被拒绝")
+	}
+
+	//未注册的类型
+	prev.TXOutputs[0].ScriptType = scriptPreimage + 1
+	if tx.Verify(prevTXs) {
+		t.Fatal("未知的锁定脚本类型应被拒绝")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+	签名类型（SIGHASH）：签名末尾附加1字节的签名类型，决定签名覆盖交易的哪些部分
+		ALL：覆盖所有input和output（默认，与没有签名类型的旧签名计算方式相同）
+		NONE：不覆盖任何output，其他input的序列号也不覆盖
+		SINGLE：只覆盖与input索引相同的output，其他input的序列号不覆盖
+	NONE和SINGLE允许其他参与者在签名后继续添加input和output（例如CoinJoin）。
+	签名类型带有BIP143标志时按BIP143格式计算签名数据：
+		所有input的引用位置、序列号和所有output各计算一次哈希，每个input的签名数据只需拼接这些哈希和自身数据，
+		避免每个input都序列化整个交易（input个数的平方复杂度）
+*/
+
+//SigHashType 签名类型
+type SigHashType byte
+
+//签名类型
+const (
+	SigHashAll    SigHashType = 0x01 //签名所有output
+	SigHashNone   SigHashType = 0x02 //不签名output
+	SigHashSingle SigHashType = 0x03 //只签名对应的output
+
+	SigHashBIP143 SigHashType = 0x40 //按BIP143格式计算签名数据（与上述类型组合使用）
+)
+
+//去掉BIP143标志后的签名类型
+func (hashType SigHashType) base() SigHashType {
+	return hashType &^ SigHashBIP143
+}
+
+//签名长度：r和s各32字节
+const signatureSize = 64
+
+//SigHasher 根据签名类型计算某个input的签名数据，无法计算时返回nil
+type SigHasher func(hashType SigHashType) []byte
+
+//拆分签名和签名类型：没有签名类型的旧签名按ALL处理
+func splitSigHashType(signature []byte) ([]byte, SigHashType) {
+	if len(signature) == signatureSize+1 {
+		return signature[:signatureSize], SigHashType(signature[signatureSize])
+	}
+	return signature, SigHashAll
+}
+
+//签名数据缓存：同一交易的所有input共用，各部分只在第一次用到时计算
+type sigHashCache struct {
+	tx      *Transaction
+	prevTXs map[string]*Transaction
+
+	legacy    [][]byte //所有input的ALL类型签名数据（旧格式）
+	legacyErr error
+
+	prevouts  []byte //BIP143：所有input引用位置的哈希
+	sequences []byte //BIP143：所有input序列号的哈希
+	outputs   []byte //BIP143：所有output的哈希
+}
+
+func newSigHashCache(tx *Transaction, prevTXs map[string]*Transaction) *sigHashCache {
+	return &sigHashCache{tx: tx, prevTXs: prevTXs}
+}
+
+//获取交易第index个input的签名数据计算函数
+func (c *sigHashCache) sigHasher(index int) SigHasher {
+	return func(hashType SigHashType) []byte {
+		hash, err := c.sigHash(index, hashType)
+		if err != nil {
+			return nil
+		}
+		return hash
+	}
+}
+
+//计算第index个input在指定签名类型下的签名数据
+func (c *sigHashCache) sigHash(index int, hashType SigHashType) ([]byte, error) {
+	if hashType&SigHashBIP143 != 0 {
+		return c.bip143Hash(index, hashType)
+	}
+	if hashType != SigHashAll {
+		return c.tx.partialSigHash(index, hashType, c.prevTXs)
+	}
+	//旧格式的ALL类型签名数据依次计算，只计算一次
+	if c.legacy == nil && c.legacyErr == nil {
+		c.legacy, c.legacyErr = c.tx.sigHashes(c.prevTXs)
+	}
+	if c.legacyErr != nil {
+		return nil, c.legacyErr
+	}
+	return c.legacy[index], nil
+}
+
+//按BIP143格式计算签名数据：
+//所有input引用位置的哈希 + 所有input序列号的哈希 + 当前input的引用位置 + 引用output的锁定脚本和金额 + 当前input的序列号
+//+ output的哈希 + 锁定时间 + 时间戳 + 版本号（不为0时） + 签名类型
+func (c *sigHashCache) bip143Hash(index int, hashType SigHashType) ([]byte, error) {
+	tx := c.tx
+	input := tx.TXInputs[index]
+	output, err := prevOutput(input, c.prevTXs)
+	if err != nil {
+		return nil, err
+	}
+	if c.prevouts == nil {
+		c.prevouts, c.sequences, c.outputs = tx.bip143Hashes()
+	}
+
+	zero := make([]byte, sha256.Size)
+	var buffer bytes.Buffer
+	buffer.Write(c.prevouts)
+	//NONE和SINGLE不覆盖其他input的序列号
+	if hashType.base() == SigHashAll {
+		buffer.Write(c.sequences)
+	} else {
+		buffer.Write(zero)
+	}
+	writeOutpoint(&buffer, input)
+	buffer.WriteByte(byte(output.ScriptType))
+	writeBytes(&buffer, output.ScriptPubKeyHash)
+	binary.Write(&buffer, binary.LittleEndian, output.Value)
+	binary.Write(&buffer, binary.LittleEndian, input.Sequence)
+
+	switch hashType.base() {
+	case SigHashAll:
+		buffer.Write(c.outputs)
+	case SigHashNone:
+		buffer.Write(zero)
+	case SigHashSingle:
+		if index >= len(tx.TXOutputs) {
+			return nil, errors.New("SIGHASH_SINGLE没有对应的output")
+		}
+		var single bytes.Buffer
+		writeOutput(&single, tx.TXOutputs[index])
+		hash := sha256.Sum256(single.Bytes())
+		buffer.Write(hash[:])
+	default:
+		return nil, errors.New("签名类型无效")
+	}
+
+	binary.Write(&buffer, binary.LittleEndian, tx.LockTime)
+	binary.Write(&buffer, binary.LittleEndian, tx.TimeStamp)
+	//版本号为0的交易（引入版本号之前）保持原有的签名数据
+	if tx.Version != 0 {
+		binary.Write(&buffer, binary.LittleEndian, tx.Version)
+	}
+	buffer.WriteByte(byte(hashType))
+	hash := sha256.Sum256(buffer.Bytes())
+	return hash[:], nil
+}
+
+//计算BIP143格式中所有input共用的哈希：引用位置、序列号、output
+func (tx *Transaction) bip143Hashes() (prevouts, sequences, outputs []byte) {
+	var prevoutBuf, sequenceBuf, outputBuf bytes.Buffer
+	for _, input := range tx.TXInputs {
+		writeOutpoint(&prevoutBuf, input)
+		binary.Write(&sequenceBuf, binary.LittleEndian, input.Sequence)
+	}
+	for _, output := range tx.TXOutputs {
+		writeOutput(&outputBuf, output)
+	}
+	prevoutHash := sha256.Sum256(prevoutBuf.Bytes())
+	sequenceHash := sha256.Sum256(sequenceBuf.Bytes())
+	outputHash := sha256.Sum256(outputBuf.Bytes())
+	return prevoutHash[:], sequenceHash[:], outputHash[:]
+}
+
+//写入input引用的output位置：交易ID + 索引值
+func writeOutpoint(buffer *bytes.Buffer, input TXInput) {
+	writeBytes(buffer, input.TXID)
+	binary.Write(buffer, binary.LittleEndian, input.Index)
+}
+
+//写入output：金额 + 锁定脚本类型 + 锁定脚本数据
+func writeOutput(buffer *bytes.Buffer, output TXOutput) {
+	binary.Write(buffer, binary.LittleEndian, output.Value)
+	buffer.WriteByte(byte(output.ScriptType))
+	writeBytes(buffer, output.ScriptPubKeyHash)
+}
+
+//计算NONE和SINGLE类型的签名数据：交易副本只保留签名类型覆盖的output，末尾附加签名类型后计算哈希
+func (tx *Transaction) partialSigHash(index int, hashType SigHashType, prevTXs map[string]*Transaction) ([]byte, error) {
+	txCopy := tx.trimmedCopy()
+	txCopy.TXID = nil
+
+	output, err := prevOutput(txCopy.TXInputs[index], prevTXs)
+	if err != nil {
+		return nil, err
+	}
+	txCopy.TXInputs[index].PubKey = output.ScriptPubKeyHash
+	//其他input的序列号不覆盖
+	for i := range txCopy.TXInputs {
+		if i != index {
+			txCopy.TXInputs[i].Sequence = 0
+		}
+	}
+
+	switch hashType {
+	case SigHashNone:
+		txCopy.TXOutputs = nil
+	case SigHashSingle:
+		if index >= len(tx.TXOutputs) {
+			return nil, errors.New("SIGHASH_SINGLE没有对应的output")
+		}
+		txCopy.TXOutputs = []TXOutput{tx.TXOutputs[index]}
+	default:
+		return nil, errors.New("签名类型无效")
+	}
+
+	data := txCopy.Serialize()
+	if data == nil {
+		return nil, errors.New("交易序列化失败")
+	}
+	hash := sha256.Sum256(append(data, byte(hashType)))
+	return hash[:], nil
+}
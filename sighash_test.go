@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+//签名后追加一个无关的output
+func addTestOutput(tx *Transaction) {
+	tx.TXOutputs = append(tx.TXOutputs, TXOutput{Value: SatoshiPerBTC / 2, ScriptPubKeyHash: bytes.Repeat([]byte{0x33}, 20)})
+}
+
+func TestSigHashSingleAllowsNewOutputs(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashSingle) {
+		t.Fatal("交易签名失败")
+	}
+	if flag := tx.TXInputs[0].ScriptSign[signatureSize]; SigHashType(flag) != SigHashSingle {
+		t.Fatalf("签名类型为%x，期望SIGHASH_SINGLE", flag)
+	}
+
+	addTestOutput(tx)
+	if !tx.Verify(prevTXs) {
+		t.Fatal("追加output后SIGHASH_SINGLE签名应仍然有效")
+	}
+	//修改其他output不影响签名
+	tx.TXOutputs[1].Value--
+	if !tx.Verify(prevTXs) {
+		t.Fatal("修改其他output后SIGHASH_SINGLE签名应仍然有效")
+	}
+	//修改对应的output使签名无效
+	tx.TXOutputs[0].Value--
+	if tx.Verify(prevTXs) {
+		t.Fatal("修改对应的output后签名应无效")
+	}
+}
+
+func TestSigHashAllCoversOutputs(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	addTestOutput(tx)
+	if tx.Verify(prevTXs) {
+		t.Fatal("追加output后SIGHASH_ALL签名应无效")
+	}
+}
+
+func TestSigHashNoneIgnoresOutputs(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashNone) {
+		t.Fatal("交易签名失败")
+	}
+	signature := append([]byte{}, tx.TXInputs[0].ScriptSign...)
+
+	addTestOutput(tx)
+	tx.TXOutputs[0].Value--
+	if !tx.Verify(prevTXs) {
+		t.Fatal("SIGHASH_NONE签名不覆盖output")
+	}
+
+	//篡改签名类型使签名无效
+	tx.TXInputs[0].ScriptSign[signatureSize] = byte(SigHashSingle)
+	if tx.Verify(prevTXs) {
+		t.Fatal("篡改签名类型后签名应无效")
+	}
+	tx.TXInputs[0].ScriptSign = signature
+	if !tx.Verify(prevTXs) {
+		t.Fatal("恢复签名后应通过校验")
+	}
+}
+
+func TestSigHashSingleWithoutOutput(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	tx.TXOutputs = nil
+	if tx.Sign(priKey, prevTXs, SigHashSingle) {
+		t.Fatal("没有对应output时SIGHASH_SINGLE签名应失败")
+	}
+	if _, err := tx.SignatureHash(0, SigHashType(0x7f), prevTXs); err == nil {
+		t.Fatal("无效的签名类型应返回错误")
+	}
+}
+
+//创建花费n个output的交易：前一个交易向钱包w支付n个output
+func newWideTestTX(t testing.TB, w *Wallet, n int) (*Transaction, map[string]*Transaction) {
+	t.Helper()
+	address := w.getAddress(activeNetwork)
+	prev := &Transaction{TimeStamp: 1}
+	for i := 0; i < n; i++ {
+		output, err := NewTXOutput(address, 10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev.TXOutputs = append(prev.TXOutputs, output)
+	}
+	if err := prev.setHash(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &Transaction{TimeStamp: 2}
+	for i := 0; i < n; i++ {
+		tx.TXInputs = append(tx.TXInputs, TXInput{TXID: prev.TXID, Index: int64(i), PubKey: w.PublicKey, Sequence: MaxRBFSequence})
+	}
+	for i := 0; i < 2; i++ {
+		output, err := NewTXOutput(address, int64(n)*10000/2-1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	return tx, map[string]*Transaction{string(prev.TXID): prev}
+}
+
+//不使用缓存，按BIP143格式逐个input序列化整个交易计算签名数据
+func naiveBIP143Hash(tx *Transaction, index int, hashType SigHashType, prevTXs map[string]*Transaction) []byte {
+	var prevouts, sequences, outputs bytes.Buffer
+	for _, input := range tx.TXInputs {
+		writeOutpoint(&prevouts, input)
+		binary.Write(&sequences, binary.LittleEndian, input.Sequence)
+	}
+	for i, output := range tx.TXOutputs {
+		if hashType.base() == SigHashAll || (hashType.base() == SigHashSingle && i == index) {
+			writeOutput(&outputs, output)
+		}
+	}
+
+	input := tx.TXInputs[index]
+	output, _ := prevOutput(input, prevTXs)
+	zero := make([]byte, sha256.Size)
+	prevoutHash := sha256.Sum256(prevouts.Bytes())
+	sequenceHash := sha256.Sum256(sequences.Bytes())
+	outputHash := sha256.Sum256(outputs.Bytes())
+
+	var buffer bytes.Buffer
+	buffer.Write(prevoutHash[:])
+	if hashType.base() == SigHashAll {
+		buffer.Write(sequenceHash[:])
+	} else {
+		buffer.Write(zero)
+	}
+	writeOutpoint(&buffer, input)
+	buffer.WriteByte(byte(output.ScriptType))
+	writeBytes(&buffer, output.ScriptPubKeyHash)
+	binary.Write(&buffer, binary.LittleEndian, output.Value)
+	binary.Write(&buffer, binary.LittleEndian, input.Sequence)
+	if hashType.base() == SigHashNone {
+		buffer.Write(zero)
+	} else {
+		buffer.Write(outputHash[:])
+	}
+	binary.Write(&buffer, binary.LittleEndian, tx.LockTime)
+	binary.Write(&buffer, binary.LittleEndian, tx.TimeStamp)
+	buffer.WriteByte(byte(hashType))
+	hash := sha256.Sum256(buffer.Bytes())
+	return hash[:]
+}
+
+func TestBIP143HashMatchesNaive(t *testing.T) {
+	w := newTestWallet(t)
+	tx, prevTXs := newWideTestTX(t, w, 5)
+
+	//同一个缓存计算所有input和所有签名类型
+	cache := newSigHashCache(tx, prevTXs)
+	for _, base := range []SigHashType{SigHashAll, SigHashNone, SigHashSingle} {
+		hashType := base | SigHashBIP143
+		for i := range tx.TXInputs {
+			got, err := cache.sigHash(i, hashType)
+			if base == SigHashSingle && i >= len(tx.TXOutputs) {
+				if err == nil {
+					t.Fatal("SIGHASH_SINGLE没有对应的output时应返回错误")
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := naiveBIP143Hash(tx, i, hashType, prevTXs); !bytes.Equal(got, want) {
+				t.Fatalf("签名类型%x第%d个input的签名数据为%x，期望%x", hashType, i, got, want)
+			}
+		}
+	}
+
+	//旧格式的签名数据与逐个计算的结果相同
+	legacy, err := tx.sigHashes(prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range tx.TXInputs {
+		got, err := cache.sigHash(i, SigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, legacy[i]) {
+			t.Fatalf("第%d个input的旧格式签名数据不一致", i)
+		}
+	}
+}
+
+func TestBIP143SignVerify(t *testing.T) {
+	w := newTestWallet(t)
+	for _, hashType := range []SigHashType{SigHashAll, SigHashAll | SigHashBIP143} {
+		tx, prevTXs := newWideTestTX(t, w, 3)
+		if !tx.Sign(w.PrivateKey, prevTXs, hashType) {
+			t.Fatal("交易签名失败")
+		}
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("签名类型%x的交易校验失败", hashType)
+		}
+		//修改output使签名无效
+		tx.TXOutputs[1].Value--
+		if tx.Verify(prevTXs) {
+			t.Fatalf("修改output后签名类型%x的签名应无效", hashType)
+		}
+	}
+}
+
+//100个input的交易：旧格式每个input序列化整个交易，BIP143格式共用缓存的哈希
+func BenchmarkVerifyWideTransaction(b *testing.B) {
+	w := newTestWallet(b)
+	for _, bench := range []struct {
+		name     string
+		hashType SigHashType
+	}{
+		{"legacy", SigHashAll},
+		{"bip143", SigHashAll | SigHashBIP143},
+	} {
+		tx, prevTXs := newWideTestTX(b, w, 100)
+		if !tx.Sign(w.PrivateKey, prevTXs, bench.hashType) {
+			b.Fatal("交易签名失败")
+		}
+		b.Run(bench.name+"/sighash", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				cache := newSigHashCache(tx, prevTXs)
+				for j := range tx.TXInputs {
+					if _, err := cache.sigHash(j, bench.hashType); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(bench.name+"/verify", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !tx.Verify(prevTXs) {
+					b.Fatal("交易校验失败")
+				}
+			}
+		})
+	}
+}
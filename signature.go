@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+//使用确定性随机数(RFC 6979)进行ECDSA签名：相同的私钥和数据总是得到相同的签名
+func signDeterministic(priKey *ecdsa.PrivateKey, hash []byte) (r, s *big.Int, err error) {
+	curve := priKey.Curve
+	n := curve.Params().N
+
+	//待签名数据转换为整数
+	e := hashToInt(hash, n)
+
+	//依次生成候选随机数k，直到得到有效的签名
+	nonces := newRFC6979Nonces(priKey.D, hash, n)
+	for i := 0; i < 100; i++ {
+		k := nonces.next()
+
+		//r = (k*G).x mod n
+		x, _ := curve.ScalarBaseMult(k.Bytes())
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		//s = k^-1 * (e + r*d) mod n
+		kInv := new(big.Int).ModInverse(k, n)
+		s = new(big.Int).Mul(r, priKey.D)
+		s.Add(s, e)
+		s.Mul(s, kInv)
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		//s取较小的值，防止签名延展性
+		if !isLowS(s, n) {
+			s.Sub(n, s)
+		}
+		return r, s, nil
+	}
+	return nil, nil, errors.New("生成签名失败")
+}
+
+//判断s是否位于曲线阶的低半部分：(r, s)和(r, n-s)都是有效签名，只接受较小的s
+func isLowS(s *big.Int, n *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(n, 1)
+	return s.Cmp(halfOrder) <= 0
+}
+
+//将哈希值转换为整数：位数超过曲线阶时截取高位（RFC 6979 bits2int）
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+//将整数转换为与曲线阶等长的字节（RFC 6979 int2octets）
+func intToOctets(v *big.Int, n *big.Int) []byte {
+	out := make([]byte, (n.BitLen()+7)/8)
+	b := v.Bytes()
+	copy(out[len(out)-len(b):], b)
+	return out
+}
+
+//RFC 6979 随机数生成器（HMAC-SHA256）
+type rfc6979Nonces struct {
+	n *big.Int //曲线阶
+	k []byte   //HMAC密钥K
+	v []byte   //状态V
+}
+
+//根据私钥和待签名数据初始化随机数生成器
+func newRFC6979Nonces(d *big.Int, hash []byte, n *big.Int) *rfc6979Nonces {
+	x := intToOctets(d, n)
+	h := intToOctets(new(big.Int).Mod(hashToInt(hash, n), n), n)
+
+	g := rfc6979Nonces{
+		n: n,
+		k: make([]byte, sha256.Size),
+		v: make([]byte, sha256.Size),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	//K = HMAC_K(V || 0x00 || x || h), V = HMAC_K(V)
+	g.k = g.mac(g.v, []byte{0x00}, x, h)
+	g.v = g.mac(g.v)
+	//K = HMAC_K(V || 0x01 || x || h), V = HMAC_K(V)
+	g.k = g.mac(g.v, []byte{0x01}, x, h)
+	g.v = g.mac(g.v)
+
+	return &g
+}
+
+//生成下一个位于[1, n-1]的随机数k
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		//T = V || V || ...，直到长度满足曲线阶
+		var t []byte
+		for len(t)*8 < g.n.BitLen() {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+		k := hashToInt(t, g.n)
+
+		//为下一次调用更新状态：K = HMAC_K(V || 0x00), V = HMAC_K(V)
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+//使用密钥K计算拼接数据的HMAC-SHA256
+func (g *rfc6979Nonces) mac(data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, g.k)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
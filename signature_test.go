@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+//RFC 6979 附录A.2.5的P-256私钥
+const rfc6979P256Key = "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721"
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+//通过固定的私钥创建ECDSA P-256私钥
+func testPrivateKey(t testing.TB, d string) *ecdsa.PrivateKey {
+	t.Helper()
+	priKey := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(mustHex(t, d))}
+	priKey.Curve = elliptic.P256()
+	priKey.X, priKey.Y = priKey.Curve.ScalarBaseMult(priKey.D.Bytes())
+	return priKey
+}
+
+//RFC 6979 附录A.2.5的SHA-256测试向量：随机数k和签名(r, s)
+//本节点只接受low-S签名，s位于高半部分时签名结果为n-s
+func TestSignDeterministicRFC6979(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	n := priKey.Curve.Params().N
+
+	tests := []struct {
+		message string
+		k       string
+		r       string
+		s       string
+	}{
+		{
+			message: "sample",
+			k:       "A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+			r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			message: "test",
+			k:       "D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+			r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+	for _, tt := range tests {
+		hash := sha256.Sum256([]byte(tt.message))
+
+		k := newRFC6979Nonces(priKey.D, hash[:], n).next()
+		if want := new(big.Int).SetBytes(mustHex(t, tt.k)); k.Cmp(want) != 0 {
+			t.Fatalf("%s: 随机数k为%X，期望%s", tt.message, k, tt.k)
+		}
+
+		r, s, err := signDeterministic(priKey, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := new(big.Int).SetBytes(mustHex(t, tt.r)); r.Cmp(want) != 0 {
+			t.Fatalf("%s: r为%X，期望%s", tt.message, r, tt.r)
+		}
+		wantS := new(big.Int).SetBytes(mustHex(t, tt.s))
+		if !isLowS(wantS, n) {
+			wantS.Sub(n, wantS)
+		}
+		if s.Cmp(wantS) != 0 {
+			t.Fatalf("%s: s为%X，期望%X", tt.message, s, wantS)
+		}
+		if !ecdsa.Verify(&priKey.PublicKey, hash[:], r, s) {
+			t.Fatalf("%s: 签名校验失败", tt.message)
+		}
+	}
+}
+
+//使用固定私钥、固定交易内容创建未签名的交易及其引用的交易
+func newFixedTestTX(priKey *ecdsa.PrivateKey) (*Transaction, map[string]*Transaction) {
+	pubKey := ecdsaPublicKeyBytes(&priKey.PublicKey)
+	prev := &Transaction{
+		TXInputs:  []TXInput{{Index: -1, PubKey: []byte("signature vectors"), Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 50 * SatoshiPerBTC, ScriptPubKeyHash: GetPubKeyHashFromPublicKey(pubKey)}},
+		TimeStamp: 1600000000,
+	}
+	prev.setHash()
+
+	tx := &Transaction{
+		TXInputs: []TXInput{{TXID: prev.TXID, Index: 0, PubKey: pubKey, Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{
+			{Value: 30 * SatoshiPerBTC, ScriptPubKeyHash: bytes.Repeat([]byte{0x11}, 20)},
+			{Value: 19 * SatoshiPerBTC, ScriptPubKeyHash: bytes.Repeat([]byte{0x22}, 20)},
+		},
+		TimeStamp: 1600000600,
+	}
+	tx.setHash()
+	return tx, map[string]*Transaction{string(prev.TXID): prev}
+}
+
+func TestSignIsDeterministic(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	first := tx.TXInputs[0].ScriptSign
+	tx.TXInputs[0].ScriptSign = nil
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	if !bytes.Equal(first, tx.TXInputs[0].ScriptSign) {
+		t.Fatalf("两次签名结果不同: %x, %x", first, tx.TXInputs[0].ScriptSign)
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	n := priKey.Curve.Params().N
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	signature := tx.TXInputs[0].ScriptSign
+	if len(signature) != signatureSize+1 || SigHashType(signature[signatureSize]) != SigHashAll {
+		t.Fatalf("签名为%x，期望r||s||SIGHASH_ALL", signature)
+	}
+	r := signature[:32]
+	s := new(big.Int).SetBytes(signature[32:signatureSize])
+	if !isLowS(s, n) {
+		t.Fatal("签名应为low-S形式")
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("low-S签名应通过校验")
+	}
+
+	//(r, n-s)同样是有效的ECDSA签名，但不是low-S形式
+	highS := append(append([]byte{}, r...), intToOctets(new(big.Int).Sub(n, s), n)...)
+	highS = append(highS, byte(SigHashAll))
+	tx.TXInputs[0].ScriptSign = highS
+	if tx.Verify(prevTXs) {
+		t.Fatal("high-S签名应被拒绝")
+	}
+	tx.TXInputs[0].ScriptSign = signature
+	if !tx.Verify(prevTXs) {
+		t.Fatal("恢复low-S签名后应通过校验")
+	}
+}
+
+//固定私钥、固定交易的签名测试向量：签名结果必须与预先计算的字节完全一致
+var signVectors = []struct {
+	name      string
+	key       string
+	hashType  SigHashType
+	signature string
+}{
+	{
+		name:      "rfc6979-all",
+		key:       rfc6979P256Key,
+		hashType:  SigHashAll,
+		signature: "d651c784d13827c46077493974f5b8ea26479a93cb2cd5be81ccdf0a7538227b732dbd8862f52bfb7f11570d7c942b9d4b4fe0a25807c687b4aaeeb38e5ac60c01",
+	},
+	{
+		name:      "rfc6979-none",
+		key:       rfc6979P256Key,
+		hashType:  SigHashNone,
+		signature: "06ae17af4e33675a6d8c12303ea20f386692f7cfc2b45860f48baa403608998b7e62a91619a8e495533fee739aacda3fe9f2c5d20eff0cb9168f2bd6c57cc7e502",
+	},
+	{
+		name:      "rfc6979-single",
+		key:       rfc6979P256Key,
+		hashType:  SigHashSingle,
+		signature: "6952b77ee38b97b7f6e094b7b13722a529c590497fe305d0b8963a7c8f50b36258e51fb10558acd450360a7bd0df388b939ecba0764989e8068d8960f2b9a90003",
+	},
+	{
+		name:      "d=1-all",
+		key:       "0000000000000000000000000000000000000000000000000000000000000001",
+		hashType:  SigHashAll,
+		signature: "88a5bae22fc3adaceba1b4f00c6179d2b1e3a445ad8d33ebfcde26183449ecac790afcdc19bb50ff149972333a9eaf23d3933c49407ac238552f606f1d7caab801",
+	},
+	{
+		name:      "d=2-bip143",
+		key:       "0000000000000000000000000000000000000000000000000000000000000002",
+		hashType:  SigHashAll | SigHashBIP143,
+		signature: "ada71b577900dea62ace9bf6abd5d20a196a4ffe67bd810f489912c0cc386df57bcc7ee30d4699eaf8895a121b0e21446501ba8696b29341e0bf6909155dd4fb41",
+	},
+}
+
+func TestSignVectors(t *testing.T) {
+	for _, tt := range signVectors {
+		priKey := testPrivateKey(t, tt.key)
+		tx, prevTXs := newFixedTestTX(priKey)
+		if !tx.Sign(priKey, prevTXs, tt.hashType) {
+			t.Fatalf("%s: 交易签名失败", tt.name)
+		}
+		if got := hex.EncodeToString(tx.TXInputs[0].ScriptSign); got != tt.signature {
+			t.Fatalf("%s: 签名为%s，期望%s", tt.name, got, tt.signature)
+		}
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("%s: 签名校验失败", tt.name)
+		}
+	}
+}
+
+//签名、公钥或被签名的交易内容任意翻转一位，校验都必须失败
+func TestVerifyRejectsBitFlips(t *testing.T) {
+	for _, tt := range signVectors {
+		priKey := testPrivateKey(t, tt.key)
+		tx, prevTXs := newFixedTestTX(priKey)
+		if !tx.Sign(priKey, prevTXs, tt.hashType) {
+			t.Fatalf("%s: 交易签名失败", tt.name)
+		}
+
+		//翻转data的每一位后校验，随后恢复原值
+		flipEach := func(field string, data []byte) {
+			for i := 0; i < len(data)*8; i++ {
+				data[i/8] ^= 1 << uint(i%8)
+				if tx.Verify(prevTXs) {
+					t.Errorf("%s: %s第%d位翻转后仍通过校验", tt.name, field, i)
+				}
+				data[i/8] ^= 1 << uint(i%8)
+			}
+		}
+		flipEach("签名", tx.TXInputs[0].ScriptSign)
+		flipEach("公钥", tx.TXInputs[0].PubKey)
+
+		//SIGHASH_ALL和SIGHASH_SINGLE都签名了第一个output
+		if tt.hashType.base() != SigHashNone {
+			flipEach("output脚本", tx.TXOutputs[0].ScriptPubKeyHash)
+			for i := uint(0); i < 64; i++ {
+				tx.TXOutputs[0].Value ^= 1 << i
+				if tx.Verify(prevTXs) {
+					t.Errorf("%s: output金额第%d位翻转后仍通过校验", tt.name, i)
+				}
+				tx.TXOutputs[0].Value ^= 1 << i
+			}
+		}
+
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("%s: 恢复后签名校验失败", tt.name)
+		}
+	}
+}
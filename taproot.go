@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+/*
+	Taproot：output只保存一个32字节的输出公钥Q = P + t*G，P为内部公钥，t = H(P.x || 脚本树根)
+		密钥路径：input提供Q对应私钥的Schnorr签名（ScriptSign），PubKey为空
+		脚本路径：input在PubKey中提供脚本和证明（暂不支持，不能解锁）
+	目前没有脚本树，t = H(P.x)
+*/
+
+//Taproot：单个输出公钥
+type taprootScript struct {
+	outputKey []byte
+}
+
+func parseTaprootScript(lockData []byte) (Script, error) {
+	if len(lockData) != 32 {
+		return nil, errors.New("Taproot输出公钥长度无效")
+	}
+	return &taprootScript{lockData}, nil
+}
+
+func (s *taprootScript) Lock() []byte {
+	return s.outputKey
+}
+
+//密钥路径：输出公钥的Schnorr签名有效；脚本路径暂不支持
+func (s *taprootScript) CanUnlock(input TXInput, sigHash SigHasher) bool {
+	if len(input.PubKey) != 0 {
+		return false
+	}
+	signature, hashType := splitSigHashType(input.ScriptSign)
+	hash := sigHash(hashType)
+	if hash == nil {
+		return false
+	}
+	return schnorrVerify(elliptic.P256(), s.outputKey, hash, signature)
+}
+
+//内部公钥的调整值：t = H(P.x || 脚本树根)
+func taprootTweak(internalKey []byte, n *big.Int) (*big.Int, error) {
+	t := new(big.Int).SetBytes(taggedHash("HIBTC/TapTweak", internalKey))
+	if t.Cmp(n) >= 0 {
+		return nil, errors.New("Taproot调整值无效")
+	}
+	return t, nil
+}
+
+//根据内部公钥计算输出公钥：Q = P + t*G
+func taprootOutputKey(internalKey []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	px, py, err := liftX(curve, internalKey)
+	if err != nil {
+		return nil, err
+	}
+	t, err := taprootTweak(internalKey, n)
+	if err != nil {
+		return nil, err
+	}
+	tx, ty := curve.ScalarBaseMult(intToOctets(t, n))
+	qx, qy := curve.Add(px, py, tx, ty)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("Taproot输出公钥无效")
+	}
+	return intToOctets(qx, n), nil
+}
+
+//NewTaprootTXOutput 创建Taproot output：internalKey为内部公钥（32字节X坐标，见SchnorrPublicKey）
+func NewTaprootTXOutput(internalKey []byte, amount int64) (TXOutput, error) {
+	output := TXOutput{Value: amount, ScriptType: ScriptTaproot}
+	if amount < DustThreshold {
+		return output, errors.New("output金额低于粉尘阈值")
+	}
+	outputKey, err := taprootOutputKey(internalKey)
+	if err != nil {
+		return output, err
+	}
+	output.ScriptPubKeyHash = outputKey
+	return output, nil
+}
+
+//使用内部私钥对Taproot密钥路径签名：私钥按内部公钥的调整值调整后进行Schnorr签名，签名为R.x||s||签名类型
+func signTaproot(priKey *ecdsa.PrivateKey, hash []byte, hashType SigHashType) ([]byte, error) {
+	curve := priKey.Curve
+	n := curve.Params().N
+	d, _ := evenYKey(curve, priKey.D)
+	t, err := taprootTweak(SchnorrPublicKey(priKey), n)
+	if err != nil {
+		return nil, err
+	}
+	d.Add(d, t)
+	d.Mod(d, n)
+
+	signature, err := schnorrSign(curve, d, hash)
+	if err != nil {
+		return nil, err
+	}
+	return append(signature, byte(hashType)), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"testing"
+)
+
+//创建花费Taproot output的交易：前一个交易向internalKey支付一个Taproot output
+func newTaprootTestTX(t *testing.T, internalKey []byte) (*Transaction, map[string]*Transaction) {
+	t.Helper()
+	output, err := NewTaprootTXOutput(internalKey, 50000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := &Transaction{TXOutputs: []TXOutput{output}, TimeStamp: 1}
+	if err := prev.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: prev.TXID, Index: 0, Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 40000, ScriptPubKeyHash: bytes.Repeat([]byte{0x11}, 20)}},
+		TimeStamp: 2,
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	return tx, map[string]*Transaction{string(prev.TXID): prev}
+}
+
+func TestTaprootKeyPathSpend(t *testing.T) {
+	w := newTestWallet(t)
+	internalKey := SchnorrPublicKey(w.PrivateKey)
+	if len(internalKey) != 32 {
+		t.Fatalf("内部公钥长度为%d，期望32", len(internalKey))
+	}
+
+	for _, hashType := range []SigHashType{SigHashAll, SigHashAll | SigHashBIP143} {
+		tx, prevTXs := newTaprootTestTX(t, internalKey)
+		//输出公钥是调整后的公钥，不等于内部公钥
+		if bytes.Equal(prevTXs[string(tx.TXInputs[0].TXID)].TXOutputs[0].ScriptPubKeyHash, internalKey) {
+			t.Fatal("输出公钥应为调整后的公钥")
+		}
+		if !tx.Sign(w.PrivateKey, prevTXs, hashType) {
+			t.Fatal("交易签名失败")
+		}
+		if len(tx.TXInputs[0].ScriptSign) != signatureSize+1 {
+			t.Fatalf("签名长度为%d，期望%d", len(tx.TXInputs[0].ScriptSign), signatureSize+1)
+		}
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("签名类型%x的密钥路径花费校验失败", hashType)
+		}
+
+		//修改output使签名无效
+		tx.TXOutputs[0].Value--
+		if tx.Verify(prevTXs) {
+			t.Fatal("修改output后签名应无效")
+		}
+		tx.TXOutputs[0].Value++
+
+		//脚本路径暂不支持
+		tx.TXInputs[0].PubKey = []byte{0x01}
+		if tx.Verify(prevTXs) {
+			t.Fatal("脚本路径花费不应通过校验")
+		}
+	}
+}
+
+func TestTaprootWrongKeyFails(t *testing.T) {
+	owner := newTestWallet(t)
+	other := newTestWallet(t)
+	tx, prevTXs := newTaprootTestTX(t, SchnorrPublicKey(owner.PrivateKey))
+
+	if !tx.Sign(other.PrivateKey, prevTXs, SigHashAll|SigHashBIP143) {
+		t.Fatal("交易签名失败")
+	}
+	if tx.Verify(prevTXs) {
+		t.Fatal("其他私钥的签名不应通过校验")
+	}
+}
+
+func TestNewTaprootTXOutputRejected(t *testing.T) {
+	internalKey := SchnorrPublicKey(newTestWallet(t).PrivateKey)
+	if _, err := NewTaprootTXOutput(internalKey[:31], 50000); err == nil {
+		t.Fatal("长度无效的内部公钥应被拒绝")
+	}
+	if _, err := NewTaprootTXOutput(internalKey, DustThreshold-1); err == nil {
+		t.Fatal("低于粉尘阈值的金额应被拒绝")
+	}
+	//不在曲线上的X坐标
+	invalid := append([]byte{}, internalKey...)
+	for {
+		if _, _, err := liftX(elliptic.P256(), invalid); err != nil {
+			break
+		}
+		invalid[31]++
+	}
+	if _, err := NewTaprootTXOutput(invalid, 50000); err == nil {
+		t.Fatal("不在曲线上的内部公钥应被拒绝")
+	}
+}
@@ -31,13 +31,14 @@ package main
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
+	"errors"
 	"fmt"
-	"math/big"
+	"sort"
 	"strings"
 	"time"
 )
@@ -48,55 +49,208 @@ type Transaction struct {
 	TXInputs  []TXInput  //交易输入(N个)
 	TXOutputs []TXOutput //交易输出（N个）
 	TimeStamp uint64     //创建交易的时间
+	LockTime  uint64     //锁定时间：小于LockTimeThreshold为区块高度，否则为Unix时间（秒），0表示不锁定
+	Version   int32      //交易版本号：0为引入版本号之前创建的交易
 }
 
+//MaxTxVersion 节点支持的最大交易版本号，版本号更大的交易使用了未知的规则，不能通过校验
+const MaxTxVersion int32 = 2
+
+//CurrentTxVersion 新创建交易的版本号
+const CurrentTxVersion int32 = 2
+
+//可以创建Taproot output的最低交易版本号
+const taprootTxVersion int32 = 2
+
 //TXInput 交易输入：指明交易发起人可支付资金的来源
 type TXInput struct {
 	TXID       []byte //引用output所在交易的ID
 	Index      int64  //引用output在output集合中的索引值
 	ScriptSign []byte //解锁脚本：付款人对当前新交易的签名
 	PubKey     []byte //解锁脚本：付款人的公钥
+	Sequence   uint32 //序列号：不大于MaxRBFSequence表示交易可被替换（RBF）
 }
 
+//SequenceFinal input序列号最大值：交易为最终版本，不可被替换
+const SequenceFinal = 0xffffffff
+
+//MaxRBFSequence 可替换交易的最大序列号（BIP125）
+const MaxRBFSequence = 0xfffffffd
+
 //TXOutput 交易输出：包含资金接收方的相关信息，作为下一个交易的输入
 type TXOutput struct {
-	Value            float64 //转账金额
-	ScriptPubKeyHash []byte  //锁定脚本：收款人的公钥哈希（地址）
+	Value            int64      //转账金额（单位：聪）
+	ScriptType       ScriptType //锁定脚本类型
+	ScriptPubKeyHash []byte     //锁定脚本数据：P2PKH为收款人的公钥哈希（地址）
 }
 
+//SatoshiPerBTC 1个比特币对应的聪数
+const SatoshiPerBTC = 100000000
+
+//DustThreshold 粉尘阈值：金额低于该值的output花费成本高于其价值，不允许创建
+var DustThreshold int64 = 546
+
 //NewTXOutput 创建一个人output
-func NewTXOutput(address string, amount float64) TXOutput {
+func NewTXOutput(address string, amount int64) (TXOutput, error) {
+	if amount < DustThreshold {
+		return TXOutput{Value: amount}, errors.New("output金额低于粉尘阈值")
+	}
+	//通过地址获取公钥哈希
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		return TXOutput{Value: amount}, err
+	}
+	return NewTXOutputFromHash(pubKeyHash, amount)
+}
+
+//NewTXOutputFromHash 直接通过20字节的公钥哈希创建P2PKH output（不经过地址解码）
+func NewTXOutputFromHash(pubKeyHash []byte, amount int64) (TXOutput, error) {
 	output := TXOutput{
 		Value: amount,
 	}
-	//通过地址获取公钥哈希
-	pubKeyHash := GetPubKeyHashFromAddress(address)
-	output.ScriptPubKeyHash = pubKeyHash
-	return output
+	if amount < DustThreshold {
+		return output, errors.New("output金额低于粉尘阈值")
+	}
+	if len(pubKeyHash) != 20 {
+		return output, errors.New("公钥哈希长度必须为20字节")
+	}
+	output.ScriptPubKeyHash = copyBytes(pubKeyHash)
+	return output, nil
 }
 
-//获取交易ID：计算交易哈希
-func (tx *Transaction) setHash() error {
-	//对tx进行gob编码获得字节流，然后计算sha256，赋值给TXID
+//Serialize 将交易序列化为字节流
+func (tx *Transaction) Serialize() []byte {
 	var buffer bytes.Buffer
 	encoder := gob.NewEncoder(&buffer)
 	err := encoder.Encode(tx)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		logger.Error(err)
+		return nil
+	}
+	return buffer.Bytes()
+}
+
+//DeserializeTransaction 将字节流反序列化为交易
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	var tx Transaction
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&tx)
+	if err != nil {
+		return nil, err
 	}
-	hash := sha256.Sum256(buffer.Bytes())
+	return &tx, nil
+}
+
+//SerializedSize 交易序列化后的字节数
+func (tx *Transaction) SerializedSize() int {
+	return len(tx.Serialize())
+}
+
+//Fee 交易的手续费：inputs引用的output总额-outputs总额（prevTXs为inputs引用的交易），挖矿交易返回0
+func (tx *Transaction) Fee(prevTXs map[string]*Transaction) (int64, error) {
+	if tx.isCoinBaseTX() {
+		return 0, nil
+	}
+	return checkTxBalance(tx, prevTXs)
+}
+
+//FeeRate 交易的手续费率（聪/字节，向下取整）：手续费除以交易序列化后的字节数，挖矿交易返回0
+func (tx *Transaction) FeeRate(prevTXs map[string]*Transaction) (int64, error) {
+	fee, err := tx.Fee(prevTXs)
+	if err != nil {
+		return 0, err
+	}
+	size := tx.SerializedSize()
+	if size == 0 {
+		return 0, errors.New("交易序列化失败")
+	}
+	return fee / int64(size), nil
+}
+
+//EstimateSize 估算指定input和output个数的已签名交易的字节数（用于创建交易前计算手续费）
+func EstimateSize(numInputs, numOutputs int) int {
+	//使用占位数据构造同样结构的交易
+	tx := Transaction{TimeStamp: uint64(time.Now().Unix())}
+	for i := 0; i < numInputs; i++ {
+		input := TXInput{
+			TXID:       make([]byte, sha256.Size),
+			Index:      int64(i),
+			ScriptSign: make([]byte, signatureSize+1), //签名：r和s各32字节，签名类型1字节
+			PubKey:     make([]byte, 64),              //公钥：X和Y各32字节
+			Sequence:   MaxRBFSequence,
+		}
+		tx.TXInputs = append(tx.TXInputs, input)
+	}
+	for i := 0; i < numOutputs; i++ {
+		output := TXOutput{
+			Value:            initialReward,
+			ScriptPubKeyHash: make([]byte, 20), //公钥哈希20字节
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+	tx.TXID = make([]byte, sha256.Size)
+	return tx.SerializedSize()
+}
+
+//计算交易哈希：对tx进行gob编码获得字节流，然后计算sha256
+func (tx *Transaction) hash() []byte {
+	hash := sha256.Sum256(tx.Serialize())
+	return hash[:]
+}
+
+//获取交易ID：对去除见证数据（签名和公钥）的交易计算哈希，交易ID不受签名的影响
+func (tx *Transaction) setHash() error {
+	data := tx.stripped().Serialize()
+	if data == nil {
+		return errors.New("交易序列化失败")
+	}
+	hash := sha256.Sum256(data)
 	tx.TXID = hash[:]
 	return nil
 }
 
-//挖矿奖励
-var reward = 12.5
+//ErrTXIDMismatch 交易ID与交易内容不一致
+var ErrTXIDMismatch = errors.New("交易ID与交易内容不一致")
+
+//重新计算交易ID并与交易中的交易ID比较：签名数据不包含交易ID，收到的交易必须校验交易ID防止伪造
+func (tx *Transaction) checkTXID() error {
+	txCopy := *tx
+	if err := txCopy.setHash(); err != nil {
+		return err
+	}
+	if !bytes.Equal(txCopy.TXID, tx.TXID) {
+		return ErrTXIDMismatch
+	}
+	return nil
+}
 
-//NewCoinbaseTX 创建挖矿交易(没有input因此不需要签名，只有一个output获得挖矿奖励)
-func NewCoinbaseTX(miner /*矿工*/ string, data string) *Transaction {
-	input := TXInput{TXID: nil, Index: -1, ScriptSign: nil, PubKey: []byte(data)} //挖矿不需要签名，由矿工任意填写
-	output := NewTXOutput(miner, reward)
+//挖矿交易input数据中随机数的长度
+const coinbaseNonceSize = 8
+
+//NewCoinbaseTX 创建挖矿交易(没有input因此不需要签名，只有一个output获得该高度的挖矿奖励，由区块链的共识参数决定)
+//input数据以区块高度(8字节)和随机数开头(BIP34)，保证不同区块、同一区块的挖矿交易ID都不相同
+func (bc *BlockChain) NewCoinbaseTX(miner /*矿工*/ string, data string, height uint64) *Transaction {
+	return newCoinbaseTX(miner, data, height, bc.params.BlockReward(height))
+}
+
+//创建金额为value的挖矿交易
+func newCoinbaseTX(miner string, data string, height uint64, value int64) *Transaction {
+	nonce := make([]byte, coinbaseNonceSize)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	coinbaseData := append(UintToByteSlice(height), nonce...)
+	coinbaseData = append(coinbaseData, data...)
+	input := TXInput{TXID: nil, Index: -1, ScriptSign: nil, PubKey: coinbaseData, Sequence: SequenceFinal} //挖矿不需要签名，由矿工任意填写
+	//挖矿奖励减半后会低于粉尘阈值直到为0，挖矿交易的output不受粉尘阈值限制
+	pubKeyHash, err := GetPubKeyHashFromAddress(miner, activeNetwork)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	output := TXOutput{Value: value, ScriptType: ScriptP2PKH, ScriptPubKeyHash: pubKeyHash}
 	timStamp := time.Now().Unix()
 
 	tx := Transaction{
@@ -104,6 +258,7 @@ func NewCoinbaseTX(miner /*矿工*/ string, data string) *Transaction {
 		TXInputs:  []TXInput{input},
 		TXOutputs: []TXOutput{output},
 		TimeStamp: uint64(timStamp),
+		Version:   CurrentTxVersion,
 	}
 	tx.setHash()
 	return &tx
@@ -111,37 +266,227 @@ func NewCoinbaseTX(miner /*矿工*/ string, data string) *Transaction {
 
 //NewTransaction 创建普通交易
 //from - 付款人，to - 收款人， amount - 转账金额
-func NewTransaction(from string, to string, amount float64, bc *BlockChain) *Transaction {
+func NewTransaction(from string, to string, amount int64, bc *BlockChain) *Transaction {
 
 	//钱包在此使用：from -> 钱包 -> 私钥 -> 签名
 	//打开钱包
 	wm := NewWalletManager()
 	if wm == nil {
-		fmt.Println("打开钱包失败")
+		logger.Error("打开钱包失败")
 		return nil
 	}
 	//找到对应的钱包
-	wallet, ok := wm.Wallets[from]
-	if !ok {
-		fmt.Println("未找到付款人地址对应的私钥")
+	wallet, err := wm.SigningWallet(from)
+	if err != nil {
+		logger.Error(err)
 		return nil
 	}
-	priKey := wallet.PrivateKey                      //签名使用
 	pubKey := wallet.PublicKey                       //获得公钥
 	pubKeyHash := GetPubKeyHashFromPublicKey(pubKey) //获得公钥哈希
 
-	//遍历账本，找到满足条件的utxo集合，返回utxo集合的总金额
+	//从UTXO集合中找到满足条件的utxo集合，返回utxo集合的总金额
 	var spentUTXO = make(map[string][]int64) //将要使用的uxto集合
-	var retValue float64                     //utxo的总金额
+	var retValue int64                       //utxo的总金额
 
-	//遍历账本，找到from能使用的utxo集合及包含的所有金额
-	spentUTXO, retValue = bc.findNeedUTXO(pubKeyHash, amount)
+	//找到from能使用的utxo集合及包含的所有金额
+	bc.mux.RLock()
+	spentUTXO, retValue = bc.utxoSet.FindSpendable(pubKeyHash, amount)
+	bc.mux.RUnlock()
 	//金额不足
 	if retValue < amount {
-		fmt.Println("金额不足，创建交易失败")
+		logger.Warn("金额不足，创建交易失败")
 		return nil
 	}
 
+	change, err := changeAddress(wm, from)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	tx, err := buildTransaction(wallet, change, to, amount, 0, spentUTXO, retValue, bc)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	return tx
+}
+
+//NewTransactionFeeRate 按手续费率（聪/字节）创建普通交易：手续费=估算的交易字节数*手续费率
+func NewTransactionFeeRate(from, to string, amount, feeRate int64, bc *BlockChain) (*Transaction, error) {
+	//打开钱包，找到付款人的私钥
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+	wallet, err := wm.SigningWallet(from)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := GetPubKeyHashFromPublicKey(wallet.PublicKey)
+
+	//按金额从大到小选取utxo，使input个数尽量少
+	utxoInfos := bc.FindUTXO(pubKeyHash)
+	sort.Slice(utxoInfos, func(i, j int) bool {
+		return utxoInfos[i].Value > utxoInfos[j].Value
+	})
+
+	//每增加一个input，交易变大，手续费随之增加，因此每次选取后重新估算手续费
+	//utxo个数有限，选完仍不足时失败，不会无限循环
+	var spentUTXO = make(map[string][]int64)
+	var retValue, fee int64
+	enough := false
+	for i, utxoInfo := range utxoInfos {
+		key := string(utxoInfo.TXID)
+		spentUTXO[key] = append(spentUTXO[key], utxoInfo.Index)
+		retValue += utxoInfo.Value
+
+		//有找零：两个output
+		fee = int64(EstimateSize(i+1, 2)) * feeRate
+		if retValue >= amount+fee {
+			enough = true
+			break
+		}
+		//没有找零：一个output，剩余金额全部作为手续费
+		fee = int64(EstimateSize(i+1, 1)) * feeRate
+		if retValue >= amount+fee {
+			fee = retValue - amount
+			enough = true
+			break
+		}
+	}
+	if !enough {
+		return nil, errors.New("金额不足，创建交易失败")
+	}
+
+	change, err := changeAddress(wm, from)
+	if err != nil {
+		return nil, err
+	}
+	return buildTransaction(wallet, change, to, amount, fee, spentUTXO, retValue, bc)
+}
+
+//NewTransactionMultiSource 合并多个付款地址的utxo创建普通交易：按地址顺序选取utxo直到满足转账金额，
+//每个input使用其引用output所属地址的私钥签名，找零给第一个付款地址（开启找零地址轮换时为新地址）
+func NewTransactionMultiSource(froms []string, to string, amount int64, bc *BlockChain) (*Transaction, error) {
+	if len(froms) == 0 {
+		return nil, errors.New("没有付款地址")
+	}
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+
+	//按地址顺序选取utxo
+	seen := make(map[string]bool)
+	var inputs []TXInput
+	var retValue int64
+	for _, from := range froms {
+		wallet, err := wm.SigningWallet(from)
+		if err != nil {
+			return nil, err
+		}
+		pubKeyHash := GetPubKeyHashFromPublicKey(wallet.PublicKey)
+		if seen[string(pubKeyHash)] {
+			return nil, fmt.Errorf("付款地址重复: %s", from)
+		}
+		seen[string(pubKeyHash)] = true
+
+		for _, utxoInfo := range bc.FindUTXO(pubKeyHash) {
+			if retValue >= amount {
+				break
+			}
+			inputs = append(inputs, TXInput{
+				TXID:     utxoInfo.TXID,
+				Index:    utxoInfo.Index,
+				PubKey:   wallet.PublicKey,
+				Sequence: MaxRBFSequence,
+			})
+			retValue += utxoInfo.Value
+		}
+	}
+	if retValue < amount {
+		return nil, errors.New("金额不足，创建交易失败")
+	}
+
+	output, err := NewTXOutput(to, amount)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []TXOutput{output}
+	//找零金额低于粉尘阈值时不创建output，计入手续费
+	if changeValue := retValue - amount; changeValue >= DustThreshold {
+		change, err := changeAddress(wm, froms[0])
+		if err != nil {
+			return nil, err
+		}
+		output, err := NewTXOutput(change, changeValue)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+
+	tx := Transaction{nil, inputs, outputs, uint64(time.Now().Unix()), 0, CurrentTxVersion}
+	if SortBIP69 {
+		tx.BIP69()
+	}
+	tx.setHash()
+
+	prevTXs, err := bc.GetPrevTXs(&tx)
+	if err != nil {
+		return nil, err
+	}
+	//每个input使用钱包中对应地址的私钥签名
+	if err := tx.SignWithKeyStore(wm, prevTXs, SigHashAll|SigHashBIP143); err != nil {
+		return nil, err
+	}
+	if err := checkAbsurdFee(&tx, retValue); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+//RotateChangeAddress 是否为每笔交易生成新的找零地址（避免地址重用），否则找零给付款人
+var RotateChangeAddress = false
+
+//获取找零地址：开启找零地址轮换时在钱包中创建新地址
+func changeAddress(wm *WalletManager, from string) (string, error) {
+	if !RotateChangeAddress {
+		return from, nil
+	}
+	return wm.NewChangeAddress()
+}
+
+//MaxFee 创建交易时允许的最大手续费（聪），0表示不限制
+var MaxFee int64 = 10000000
+
+//MaxFeeRate 创建交易时允许的最大手续费率（聪/字节），0表示不限制
+var MaxFeeRate int64 = 10000
+
+//ErrAbsurdFee 手续费过高：通常是找零计算错误，拒绝创建交易以免损失资金
+var ErrAbsurdFee = errors.New("交易手续费过高")
+
+//检查新创建交易的手续费（inputs总额-outputs总额）是否超过MaxFee或MaxFeeRate
+func checkAbsurdFee(tx *Transaction, inputsValue int64) error {
+	outputsTotal, err := tx.outputsTotal()
+	if err != nil {
+		return err
+	}
+	fee := inputsValue - outputsTotal
+	if MaxFee > 0 && fee > MaxFee {
+		logger.Warn(fmt.Sprintf("手续费%d超过最大手续费%d", fee, MaxFee))
+		return ErrAbsurdFee
+	}
+	if MaxFeeRate > 0 && fee > MaxFeeRate*int64(tx.SerializedSize()) {
+		logger.Warn(fmt.Sprintf("手续费%d超过最大手续费率%d聪/字节", fee, MaxFeeRate))
+		return ErrAbsurdFee
+	}
+	return nil
+}
+
+//使用选定的utxo创建并签名交易：给to转账amount，扣除手续费fee后的剩余金额找零给change
+func buildTransaction(wallet *Wallet, change, to string, amount, fee int64, spentUTXO map[string][]int64, retValue int64, bc *BlockChain) (*Transaction, error) {
 	var inputs []TXInput
 	var outputs []TXOutput
 	//拼接inputs
@@ -153,7 +498,8 @@ func NewTransaction(from string, to string, amount float64, bc *BlockChain) *Tra
 				TXID:       []byte(txid),
 				Index:      i,
 				ScriptSign: nil,
-				PubKey:     pubKey,
+				PubKey:     wallet.PublicKey,
+				Sequence:   MaxRBFSequence, //默认允许通过提高手续费替换
 			}
 			inputs = append(inputs, input)
 		}
@@ -162,26 +508,206 @@ func NewTransaction(from string, to string, amount float64, bc *BlockChain) *Tra
 
 	//拼接outputs
 	//创建一个属于to的output
-	output1 := NewTXOutput(to, amount)
+	output1, err := NewTXOutput(to, amount)
+	if err != nil {
+		return nil, err
+	}
 	outputs = append(outputs, output1)
-	if retValue > amount {
-		//如果总金额大于转账金额，找零：给from创建一个output
-		output2 := NewTXOutput(from, retValue-amount)
+	//如果总金额大于转账金额与手续费之和，找零：给找零地址创建一个output
+	//找零金额低于粉尘阈值时不创建output，计入手续费
+	if changeValue := retValue - amount - fee; changeValue >= DustThreshold {
+		output2, err := NewTXOutput(change, changeValue)
+		if err != nil {
+			return nil, err
+		}
 		outputs = append(outputs, output2)
 	}
 
 	timeStamp := time.Now().Unix()
 	//计算哈希值，返回
-	tx := Transaction{nil, inputs, outputs, uint64(timeStamp)}
+	tx := Transaction{nil, inputs, outputs, uint64(timeStamp), 0, CurrentTxVersion}
+	if SortBIP69 {
+		tx.BIP69()
+	}
 	tx.setHash()
 
 	//交易签名
-	if !bc.SignTransaction(&tx, priKey) {
-		fmt.Println("交易签名失败")
-		return nil
+	if !bc.SignTransaction(&tx, wallet.signingKey()) {
+		return nil, errors.New("交易签名失败")
+	}
+	if err := checkAbsurdFee(&tx, retValue); err != nil {
+		return nil, err
 	}
 
-	return &tx
+	return &tx, nil
+}
+
+//Consolidate 合并零钱：将地址金额最小的最多maxInputs个utxo合并为一个output转给自己（扣除手续费）
+func (bc *BlockChain) Consolidate(address string, maxInputs int, fee int64) (*Transaction, error) {
+	if maxInputs <= 0 {
+		return nil, errors.New("input个数必须大于0")
+	}
+
+	//打开钱包，找到地址对应的私钥
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+	wallet, err := wm.SigningWallet(address)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := GetPubKeyHashFromPublicKey(wallet.PublicKey)
+
+	//按金额从小到大选取utxo
+	utxoInfos := bc.FindUTXO(pubKeyHash)
+	sort.Slice(utxoInfos, func(i, j int) bool {
+		return utxoInfos[i].Value < utxoInfos[j].Value
+	})
+	if len(utxoInfos) > maxInputs {
+		utxoInfos = utxoInfos[:maxInputs]
+	}
+
+	//只有一个转给自己的output
+	return bc.spendAll(wallet, utxoInfos, address, fee)
+}
+
+//SweepAddress 将地址的所有utxo转给另一个地址：没有找零，收款金额为utxo总额减去手续费（按手续费率和交易大小计算）
+func (bc *BlockChain) SweepAddress(from, to string, feeRate int64) (*Transaction, error) {
+	if feeRate < 0 {
+		return nil, errors.New("手续费率不能为负数")
+	}
+	if !IsValidAddress(to) {
+		return nil, errors.New("收款地址无效")
+	}
+
+	//打开钱包，找到地址对应的私钥
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+	wallet, err := wm.SigningWallet(from)
+	if err != nil {
+		return nil, err
+	}
+	utxoInfos := bc.FindUTXO(GetPubKeyHashFromPublicKey(wallet.PublicKey))
+	if len(utxoInfos) == 0 {
+		return nil, errors.New("地址没有可用的utxo")
+	}
+
+	fee := int64(EstimateSize(len(utxoInfos), 1)) * feeRate
+	return bc.spendAll(wallet, utxoInfos, to, fee)
+}
+
+//BumpFeeCPFP 子交易带动父交易(CPFP)：花费交易池中父交易的找零output，支付extraFee手续费，剩余金额转回找零地址
+//找零output必须属于钱包中可签名的地址
+func (bc *BlockChain) BumpFeeCPFP(parentTxid []byte, changeIndex int, extraFee int64) (*Transaction, error) {
+	if extraFee <= 0 {
+		return nil, errors.New("手续费必须大于0")
+	}
+
+	//父交易必须在交易池中，且找零output尚未被交易池中的交易使用
+	bc.mux.RLock()
+	parent := bc.mempool.get(parentTxid)
+	_, spent := bc.mempool.spent[outpointKey(parentTxid, int64(changeIndex))]
+	bc.mux.RUnlock()
+	if parent == nil {
+		return nil, errors.New("交易池中没有找到父交易")
+	}
+	if changeIndex < 0 || changeIndex >= len(parent.TXOutputs) {
+		return nil, fmt.Errorf("output索引值%d超出范围", changeIndex)
+	}
+	if spent {
+		return nil, errors.New("找零output已被交易池中的交易使用")
+	}
+	change := parent.TXOutputs[changeIndex]
+	if change.ScriptType != ScriptP2PKH {
+		return nil, errors.New("只支持花费P2PKH找零output")
+	}
+
+	//找到找零output对应的钱包
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+	var wallet *Wallet
+	var address string
+	for addr, w := range wm.Wallets {
+		if change.isLockedWith(GetPubKeyHashFromPublicKey(w.PublicKey)) {
+			wallet, address = w, addr
+			break
+		}
+	}
+	if wallet == nil {
+		return nil, errors.New("找零output不属于钱包中可签名的地址")
+	}
+
+	//扣除手续费后转回找零地址
+	if change.Value-extraFee < DustThreshold {
+		return nil, errors.New("找零金额不足以支付手续费")
+	}
+	output, err := NewTXOutput(address, change.Value-extraFee)
+	if err != nil {
+		return nil, err
+	}
+	input := TXInput{
+		TXID:       parentTxid,
+		Index:      int64(changeIndex),
+		ScriptSign: nil,
+		PubKey:     wallet.PublicKey,
+		Sequence:   MaxRBFSequence,
+	}
+	tx := Transaction{nil, []TXInput{input}, []TXOutput{output}, uint64(time.Now().Unix()), 0, CurrentTxVersion}
+	tx.setHash()
+
+	//父交易不在账本中，直接使用父交易签名
+	prevTXs := map[string]*Transaction{string(parentTxid): parent}
+	if !tx.Sign(wallet.signingKey(), prevTXs, SigHashAll|SigHashBIP143) {
+		return nil, errors.New("交易签名失败")
+	}
+	if err := checkAbsurdFee(&tx, change.Value); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+//花费所有utxo，扣除手续费后全部转给收款地址（只有一个output）
+func (bc *BlockChain) spendAll(wallet *Wallet, utxoInfos []UTXOInfo, to string, fee int64) (*Transaction, error) {
+	var inputs []TXInput
+	var total int64
+	for _, utxoInfo := range utxoInfos {
+		input := TXInput{
+			TXID:       utxoInfo.TXID,
+			Index:      utxoInfo.Index,
+			ScriptSign: nil,
+			PubKey:     wallet.PublicKey,
+			Sequence:   MaxRBFSequence,
+		}
+		inputs = append(inputs, input)
+		total += utxoInfo.Value
+	}
+
+	//总金额必须足够支付手续费
+	if total <= fee {
+		return nil, errors.New("utxo总金额不足以支付手续费")
+	}
+
+	output, err := NewTXOutput(to, total-fee)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := Transaction{nil, inputs, []TXOutput{output}, uint64(time.Now().Unix()), 0, CurrentTxVersion}
+	tx.setHash()
+
+	//交易签名
+	if !bc.SignTransaction(&tx, wallet.signingKey()) {
+		return nil, errors.New("交易签名失败")
+	}
+	if err := checkAbsurdFee(&tx, total); err != nil {
+		return nil, err
+	}
+	return &tx, nil
 }
 
 //判断交易是否为挖矿交易
@@ -194,49 +720,230 @@ func (tx *Transaction) isCoinBaseTX() bool {
 	return false
 }
 
-//Sign 实际签名动作(私钥，inputs所引用的output所在交易的集合：key:交易ID,value:交易本身)
-func (tx *Transaction) Sign(priKey *ecdsa.PrivateKey, prevTXs map[string]*Transaction) bool {
+//获取挖矿交易input数据中的区块高度
+func (tx *Transaction) coinbaseHeight() (uint64, bool) {
+	if !tx.isCoinBaseTX() || len(tx.TXInputs[0].PubKey) < 8 {
+		return 0, false
+	}
+	return ByteSliceToUint(tx.TXInputs[0].PubKey[:8]), true
+}
+
+//交易所有output的总金额，金额溢出时返回ErrValueOverflow
+func (tx *Transaction) outputsTotal() (int64, error) {
+	var total int64
+	for _, output := range tx.TXOutputs {
+		var err error
+		if total, err = addSatoshi(total, output.Value); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+//Equals 逐字段比较两个交易（包括签名和公钥）
+func (tx *Transaction) Equals(other *Transaction) bool {
+	if tx == nil || other == nil {
+		return tx == other
+	}
+	if !bytes.Equal(tx.TXID, other.TXID) || tx.TimeStamp != other.TimeStamp || tx.LockTime != other.LockTime || tx.Version != other.Version {
+		return false
+	}
+	if len(tx.TXInputs) != len(other.TXInputs) || len(tx.TXOutputs) != len(other.TXOutputs) {
+		return false
+	}
+	for i, input := range tx.TXInputs {
+		o := other.TXInputs[i]
+		if !bytes.Equal(input.TXID, o.TXID) || input.Index != o.Index || input.Sequence != o.Sequence ||
+			!bytes.Equal(input.ScriptSign, o.ScriptSign) || !bytes.Equal(input.PubKey, o.PubKey) {
+			return false
+		}
+	}
+	for i, output := range tx.TXOutputs {
+		o := other.TXOutputs[i]
+		if output.Value != o.Value || output.ScriptType != o.ScriptType || !bytes.Equal(output.ScriptPubKeyHash, o.ScriptPubKeyHash) {
+			return false
+		}
+	}
+	return true
+}
+
+//判断交易是否可被替换：任一input的序列号不大于MaxRBFSequence
+func (tx *Transaction) isReplaceable() bool {
+	for _, input := range tx.TXInputs {
+		if input.Sequence <= MaxRBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+//KeyStore 私钥存储：签名时根据input引用的output的公钥哈希找到对应的私钥
+type KeyStore interface {
+	//PrivateKeyFor 返回公钥哈希对应的私钥（*ecdsa.PrivateKey或ed25519.PrivateKey），没有时返回错误
+	PrivateKeyFor(pubKeyHash []byte) (crypto.PrivateKey, error)
+}
+
+//只包含一个私钥的存储：所有input都使用该私钥
+type singleKeyStore struct {
+	priKey crypto.PrivateKey
+}
+
+func (s singleKeyStore) PrivateKeyFor([]byte) (crypto.PrivateKey, error) {
+	return s.priKey, nil
+}
+
+//Sign 实际签名动作(私钥，inputs所引用的output所在交易的集合：key:交易ID,value:交易本身，签名类型)
+//使用同一个私钥对所有input进行P2PKH签名
+func (tx *Transaction) Sign(priKey crypto.PrivateKey, prevTXs map[string]*Transaction, hashType SigHashType) bool {
+	err := tx.SignWithKeyStore(singleKeyStore{priKey}, prevTXs, hashType)
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	return true
+}
+
+//SignWithKeyStore 根据每个input引用的output的公钥哈希，从私钥存储中找到私钥签名（inputs可以属于不同的私钥）
+//任何一个input找不到私钥时返回错误
+func (tx *Transaction) SignWithKeyStore(keyStore KeyStore, prevTXs map[string]*Transaction, hashType SigHashType) error {
+
+	//结构无效（如没有input或output）的交易不签名
+	if err := tx.CheckSanity(); err != nil {
+		return err
+	}
 
 	//挖矿交易不需要签名
 	if tx.isCoinBaseTX() {
-		return true
+		return nil
 	}
 
+	//计算每个input的签名数据
+	cache := newSigHashCache(tx, prevTXs)
+	for i := range tx.TXInputs {
+		hashData, err := cache.sigHash(i, hashType)
+		if err != nil {
+			return fmt.Errorf("计算第%d个input的签名数据失败: %v", i, err)
+		}
+		//根据引用的output找到私钥
+		output, err := prevOutput(tx.TXInputs[i], prevTXs)
+		if err != nil {
+			return err
+		}
+		priKey, err := keyStore.PrivateKeyFor(output.ScriptPubKeyHash)
+		if err != nil {
+			return fmt.Errorf("第%d个input: %v", i, err)
+		}
+		//Taproot output使用Schnorr签名，其他使用私钥对应的签名算法
+		var signature []byte
+		if output.ScriptType == ScriptTaproot {
+			key, ok := priKey.(*ecdsa.PrivateKey)
+			if !ok {
+				return errors.New("Taproot output只支持ECDSA-P256私钥")
+			}
+			signature, err = signTaproot(key, hashData, hashType)
+		} else {
+			signature, err = signHash(priKey, hashData, hashType)
+		}
+		if err != nil {
+			return fmt.Errorf("第%d个input签名失败: %v", i, err)
+		}
+		//将数字签名赋值给原始交易
+		tx.TXInputs[i].ScriptSign = signature
+	}
+
+	logger.Debug("交易签名成功")
+	return nil
+}
+
+//使用私钥对应的签名算法对数据签名，签名为64字节签名||签名类型
+//ECDSA使用RFC 6979确定性随机数，签名为r||s（各32字节）
+func signHash(priKey crypto.PrivateKey, hash []byte, hashType SigHashType) ([]byte, error) {
+	id, err := schemeOfPrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signatureSchemes[id].Sign(priKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	return append(signature, byte(hashType)), nil
+}
+
+//SignatureHash 获取指定input在指定签名类型下的签名数据（用于多重签名等需要单独签名的input）
+func (tx *Transaction) SignatureHash(index int, hashType SigHashType, prevTXs map[string]*Transaction) ([]byte, error) {
+	if index < 0 || index >= len(tx.TXInputs) {
+		return nil, errors.New("input索引无效")
+	}
+	return newSigHashCache(tx, prevTXs).sigHash(index, hashType)
+}
+
+//计算每个input的ALL类型签名数据：交易副本中当前input的PubKey替换为引用output的锁定脚本数据后计算哈希
+func (tx *Transaction) sigHashes(prevTXs map[string]*Transaction) ([][]byte, error) {
 	//获取交易副本，置空pubKey和Sign
 	txCopy := tx.trimmedCopy()
-	//遍历inputs
+	var hashes [][]byte
 	for i, input := range txCopy.TXInputs {
-		prevTX := prevTXs[string(input.TXID)]
-		if prevTX == nil {
-			return false
+		output, err := prevOutput(input, prevTXs)
+		if err != nil {
+			return nil, err
 		}
-		//input引用的output
-		output := prevTX.TXOutputs[input.Index]
-		//获取引用的output公钥哈希
 		txCopy.TXInputs[i].PubKey = output.ScriptPubKeyHash
-		//对交易副本进行签名
-		txCopy.setHash() //计算交易哈希
-
+		txCopy.TXID = txCopy.hash() //计算交易哈希
 		//将input的pubKey字段置空
 		txCopy.TXInputs[i].PubKey = nil //还原数据，防止干扰后面的input签名
+		hashes = append(hashes, txCopy.TXID)
+	}
+	return hashes, nil
+}
 
-		hashData := txCopy.TXID //要签名的数据
-		//签名
-		r, s, err := ecdsa.Sign(rand.Reader, priKey, hashData)
-		if err != nil {
-			fmt.Println("签名失败")
-			return false
-		}
-		signature := append(r.Bytes(), s.Bytes()...)
-		//将数字签名赋值给原始交易
-		tx.TXInputs[i].ScriptSign = signature
+//获取input引用的output
+func prevOutput(input TXInput, prevTXs map[string]*Transaction) (TXOutput, error) {
+	prevTX := prevTXs[string(input.TXID)]
+	if prevTX == nil {
+		return TXOutput{}, errors.New("引用的交易不存在")
 	}
+	if err := checkOutputIndex(input, prevTX); err != nil {
+		return TXOutput{}, err
+	}
+	return prevTX.TXOutputs[input.Index], nil
+}
 
-	fmt.Println("交易签名成功")
-	return true
+//检查input的索引值：不能为负数（-1只用于挖矿交易），也不能超出引用交易的output个数
+func checkOutputIndex(input TXInput, prevTX *Transaction) error {
+	if input.Index < 0 {
+		return fmt.Errorf("input索引值%d为负数", input.Index)
+	}
+	if input.Index >= int64(len(prevTX.TXOutputs)) {
+		return fmt.Errorf("input索引值%d超出引用交易的output个数%d", input.Index, len(prevTX.TXOutputs))
+	}
+	return nil
+}
+
+//Clone 深拷贝交易：复制所有切片和字节数据，需要修改交易时应先调用Clone获得可修改的副本
+func (tx *Transaction) Clone() *Transaction {
+	txCopy := *tx
+	txCopy.TXID = copyBytes(tx.TXID)
+	if tx.TXInputs != nil {
+		txCopy.TXInputs = make([]TXInput, len(tx.TXInputs))
+		for i, input := range tx.TXInputs {
+			input.TXID = copyBytes(input.TXID)
+			input.ScriptSign = copyBytes(input.ScriptSign)
+			input.PubKey = copyBytes(input.PubKey)
+			txCopy.TXInputs[i] = input
+		}
+	}
+	if tx.TXOutputs != nil {
+		txCopy.TXOutputs = make([]TXOutput, len(tx.TXOutputs))
+		for i, output := range tx.TXOutputs {
+			output.ScriptPubKeyHash = copyBytes(output.ScriptPubKeyHash)
+			txCopy.TXOutputs[i] = output
+		}
+	}
+	return &txCopy
 }
 
 //创建一个交易副本：每个input的pubKey和Sign都置空
+//副本不与原交易共享任何切片，修改副本不会影响原交易
 func (tx *Transaction) trimmedCopy() *Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
@@ -244,78 +951,71 @@ func (tx *Transaction) trimmedCopy() *Transaction {
 	//每个input的pubKey和Sign都置空
 	for _, input := range tx.TXInputs {
 		input := TXInput{
-			TXID:       input.TXID,
+			TXID:       copyBytes(input.TXID),
 			Index:      input.Index,
 			ScriptSign: nil,
 			PubKey:     nil,
+			Sequence:   input.Sequence, //序列号参与签名
 		}
 		inputs = append(inputs, input)
 	}
 
-	outputs = tx.TXOutputs
+	for _, output := range tx.TXOutputs {
+		output.ScriptPubKeyHash = copyBytes(output.ScriptPubKeyHash)
+		outputs = append(outputs, output)
+	}
 
 	txCopy := Transaction{
-		tx.TXID,
+		copyBytes(tx.TXID),
 		inputs,
 		outputs,
 		tx.TimeStamp,
+		tx.LockTime,
+		tx.Version,
 	}
 
 	return &txCopy
 }
 
-//Verify 校验交易签名实际动作
+//Verify 校验交易签名实际动作：由每个input引用的output的锁定脚本判断能否解锁
 func (tx *Transaction) Verify(prevTXs map[string]*Transaction) bool {
 
+	//结构无效（如没有input或output）的交易校验失败，不能因为没有input需要校验而通过
+	if err := tx.CheckSanity(); err != nil {
+		logger.Warn(err)
+		return false
+	}
+
 	//挖矿交易不需要签名
 	if tx.isCoinBaseTX() {
 		return true
 	}
 
-	//获取交易副本，置空pubKey和Sign
-	txCopy := tx.trimmedCopy()
-	//遍历inputs
+	//签名数据按需计算，所有input共用缓存
+	cache := newSigHashCache(tx, prevTXs)
 	for i, input := range tx.TXInputs {
-		prevTX := prevTXs[string(input.TXID)]
-		if prevTX == nil {
+		output, err := prevOutput(input, prevTXs)
+		if err != nil {
+			logger.Warn(err)
 			return false
 		}
-		//还原数据：得到引用  获取交易哈希值
-		output := prevTX.TXOutputs[input.Index]
-		txCopy.TXInputs[i].PubKey = output.ScriptPubKeyHash
-		txCopy.setHash() //计算交易哈希
-
-		//将input的pubKey字段置空
-		txCopy.TXInputs[i].PubKey = nil
-
-		hashData := txCopy.TXID       //要还原的签名的数据
-		signature := input.ScriptSign //签名
-		pubKey := input.PubKey        //公钥字节流
-
-		//开始校验
-		var r, s, x, y big.Int
-
-		//把r和s从签名中截取出来
-		r.SetBytes(signature[:len(signature)/2])
-		s.SetBytes(signature[len(signature)/2:])
-
-		//把x和y从pubKey中截取出来，还原公钥本身
-		x.SetBytes(pubKey[:len(pubKey)/2])
-		y.SetBytes(pubKey[len(pubKey)/2:])
-
-		curve := elliptic.P256()
-		publicKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-
-		//校验
-		res := ecdsa.Verify(&publicKey, hashData, &r, &s)
-		if !res {
-			fmt.Println("签名校验失败")
+		script, err := output.Script()
+		if err != nil {
+			logger.Warn(err)
+			return false
+		}
+		if !script.CanUnlock(input, cache.sigHasher(i)) {
+			logger.Warn("签名校验失败")
+			return false
+		}
+		//时间锁定的output：花费交易的锁定时间必须达到解锁时间
+		if lockTimeScript, ok := script.(LockTimeScript); ok && !tx.lockTimeReached(input, lockTimeScript.UnlockTime()) {
+			logger.Warn("output未到解锁时间")
 			return false
 		}
-
 	}
 
-	fmt.Println("签名校验成功")
+	logger.Debug("签名校验成功")
 	return true
 }
 
@@ -324,7 +1024,16 @@ func (tx *Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("Transaction %x:", tx.TXID))
+	if tx.Version != 0 {
+		lines = append(lines, fmt.Sprintf("Version: %d", tx.Version))
+	}
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("LockTime: %d", tx.LockTime))
+	}
 
+	if len(tx.TXInputs) == 0 {
+		lines = append(lines, "Inputs: none")
+	}
 	for i, input := range tx.TXInputs {
 
 		lines = append(lines, fmt.Sprintf("Input %d:", i))
@@ -332,11 +1041,16 @@ func (tx *Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("Out: %d", input.Index))
 		lines = append(lines, fmt.Sprintf("Signature: %x", input.ScriptSign))
 		lines = append(lines, fmt.Sprintf("PubKey: %x", input.PubKey))
+		lines = append(lines, fmt.Sprintf("Sequence: %x", input.Sequence))
 	}
 
+	if len(tx.TXOutputs) == 0 {
+		lines = append(lines, "Outputs: none")
+	}
 	for i, output := range tx.TXOutputs {
 		lines = append(lines, fmt.Sprintf("Output %d:", i))
-		lines = append(lines, fmt.Sprintf("Value: %f", output.Value))
+		lines = append(lines, fmt.Sprintf("Value: %d", output.Value))
+		lines = append(lines, fmt.Sprintf("ScriptType: %d", output.ScriptType))
 		lines = append(lines, fmt.Sprintf("Script: %x", output.ScriptPubKeyHash))
 	}
 
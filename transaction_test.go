@@ -0,0 +1,938 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsolidateDust(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	saveTestWallet(t, w)
+
+	//钱包持有10个零钱utxo
+	var values []int64
+	for i := 0; i < 10; i++ {
+		values = append(values, 1000+int64(i)*100)
+	}
+	fundTestOutputs(t, bc, w, values)
+
+	tx, err := bc.Consolidate(address, 8, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXInputs) != 8 {
+		t.Fatalf("交易有%d个input，期望8个", len(tx.TXInputs))
+	}
+	if len(tx.TXOutputs) != 1 {
+		t.Fatalf("交易有%d个output，期望1个", len(tx.TXOutputs))
+	}
+	//选取金额最小的8个utxo
+	var want int64
+	for _, value := range values[:8] {
+		want += value
+	}
+	want -= 500
+	if tx.TXOutputs[0].Value != want {
+		t.Fatalf("output金额为%d，期望%d", tx.TXOutputs[0].Value, want)
+	}
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	if string(tx.TXOutputs[0].ScriptPubKeyHash) != string(pubKeyHash) {
+		t.Fatal("合并后的output应属于原地址")
+	}
+
+	//金额不足以支付手续费
+	if _, err := bc.Consolidate(address, 1, 1000); err == nil {
+		t.Fatal("utxo金额不足以支付手续费时应返回错误")
+	}
+}
+
+func TestSweepAddress(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t)
+	saveTestWallet(t, w)
+
+	values := []int64{5000, 20000, 70000}
+	fundTestOutputs(t, bc, w, values)
+
+	tx, err := bc.SweepAddress(address, payee.getAddress(activeNetwork), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXInputs) != len(values) || len(tx.TXOutputs) != 1 {
+		t.Fatalf("交易有%d个input和%d个output，期望%d个input和1个output", len(tx.TXInputs), len(tx.TXOutputs), len(values))
+	}
+	want := int64(5000+20000+70000) - int64(EstimateSize(len(values), 1))*10
+	if tx.TXOutputs[0].Value != want {
+		t.Fatalf("output金额为%d，期望%d", tx.TXOutputs[0].Value, want)
+	}
+	if !bytes.Equal(tx.TXOutputs[0].ScriptPubKeyHash, GetPubKeyHashFromPublicKey(payee.PublicKey)) {
+		t.Fatal("output应属于收款地址")
+	}
+	if !bc.VerifyTransaction(tx) {
+		t.Fatal("交易校验失败")
+	}
+
+	//utxo总额不足以支付手续费
+	if _, err := bc.SweepAddress(address, payee.getAddress(activeNetwork), 1000); err == nil {
+		t.Fatal("utxo总额不足以支付手续费时应返回错误")
+	}
+	if _, err := bc.SweepAddress(address, "invalid", 10); err == nil {
+		t.Fatal("收款地址无效时应返回错误")
+	}
+}
+
+//相邻两个估算值的差：交易大小随input或output个数线性增长
+func sizeSteps(size func(n int) int) []int {
+	var steps []int
+	for n := 1; n < 6; n++ {
+		steps = append(steps, size(n+1)-size(n))
+	}
+	return steps
+}
+
+func TestEstimateSizeLinear(t *testing.T) {
+	for name, size := range map[string]func(n int) int{
+		"input":  func(n int) int { return EstimateSize(n, 1) },
+		"output": func(n int) int { return EstimateSize(1, n) },
+	} {
+		steps := sizeSteps(size)
+		for _, step := range steps {
+			//整数变长编码可能造成1-2字节的差异
+			if step <= 0 || step < steps[0]-2 || step > steps[0]+2 {
+				t.Fatalf("每增加一个%s，交易大小的增量为%v，应近似为常数", name, steps)
+			}
+		}
+	}
+}
+
+func TestEstimateSizeMatchesActual(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, 2 * SatoshiPerBTC})
+
+	//2个input，2个output的已签名交易
+	tx := &Transaction{TimeStamp: uint64(time.Now().Unix())}
+	prevTXs := map[string]*Transaction{string(fund.TXID): fund}
+	for i := int64(0); i < 2; i++ {
+		tx.TXInputs = append(tx.TXInputs, TXInput{TXID: fund.TXID, Index: i, PubKey: w.PublicKey, Sequence: MaxRBFSequence})
+	}
+	for _, value := range []int64{SatoshiPerBTC, 2*SatoshiPerBTC - 10000} {
+		output, err := NewTXOutput(payee, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, prevTXs)
+
+	actual := tx.SerializedSize()
+	estimate := EstimateSize(2, 2)
+	if diff := actual - estimate; diff < -10 || diff > 10 {
+		t.Fatalf("估算大小为%d，实际大小为%d", estimate, actual)
+	}
+}
+
+func TestNewTransactionFeeRateCrossesUTXOBoundary(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+	fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, SatoshiPerBTC / 2})
+
+	//第一个utxo刚好等于转账金额，手续费需要再选取一个utxo
+	const feeRate = 10
+	tx, err := NewTransactionFeeRate(address, payee, SatoshiPerBTC, feeRate, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXInputs) != 2 {
+		t.Fatalf("交易有%d个input，期望2个", len(tx.TXInputs))
+	}
+	fee := int64(EstimateSize(2, 2)) * feeRate
+	if len(tx.TXOutputs) != 2 || tx.TXOutputs[0].Value != SatoshiPerBTC || tx.TXOutputs[1].Value != SatoshiPerBTC/2-fee {
+		t.Fatalf("交易outputs为%+v，期望手续费为%d", tx.TXOutputs, fee)
+	}
+
+	//所有utxo都不足以支付转账金额和手续费
+	if _, err := NewTransactionFeeRate(address, payee, SatoshiPerBTC*3/2, feeRate, bc); err == nil {
+		t.Fatal("金额不足时应返回错误")
+	}
+}
+
+func TestDustChangeFoldedIntoFee(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	fund := fundTestOutputs(t, bc, w, []int64{100000})
+	spentUTXO := map[string][]int64{string(fund.TXID): {0}}
+	const fee = 1000
+
+	//找零金额恰好等于粉尘阈值：保留找零output
+	amount := 100000 - fee - DustThreshold
+	tx, err := buildTransaction(w, address, payee, amount, fee, spentUTXO, 100000, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXOutputs) != 2 || tx.TXOutputs[1].Value != DustThreshold {
+		t.Fatalf("交易output为%+v，期望包含金额为%d的找零", tx.TXOutputs, DustThreshold)
+	}
+
+	//找零金额低于粉尘阈值：不创建找零output，计入手续费
+	tx, err = buildTransaction(w, address, payee, amount+1, fee, spentUTXO, 100000, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXOutputs) != 1 {
+		t.Fatalf("交易有%d个output，期望1个", len(tx.TXOutputs))
+	}
+	if got, _ := txFee(tx, map[string]*Transaction{string(fund.TXID): fund}); got != fee+DustThreshold-1 {
+		t.Fatalf("手续费为%d，期望%d", got, fee+DustThreshold-1)
+	}
+
+	if _, err := NewTXOutput(payee, DustThreshold-1); err == nil {
+		t.Fatal("低于粉尘阈值的output应被拒绝")
+	}
+}
+
+func TestCoinbaseTXIDUnique(t *testing.T) {
+	miner := newTestWallet(t).getAddress(activeNetwork)
+	first := newCoinbaseTX(miner, "same data", 7, initialReward)
+	second := newCoinbaseTX(miner, "same data", 7, initialReward)
+	if string(first.TXID) == string(second.TXID) {
+		t.Fatalf("连续创建的挖矿交易ID相同: %x", first.TXID)
+	}
+	if height, ok := first.coinbaseHeight(); !ok || height != 7 {
+		t.Fatalf("挖矿交易的区块高度为%d(%v)，期望7", height, ok)
+	}
+	if string(newCoinbaseTX(miner, "same data", 8, initialReward).TXID) == string(first.TXID) {
+		t.Fatal("不同高度的挖矿交易ID应不同")
+	}
+}
+
+func TestBlockRejectsWrongCoinbaseHeight(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+
+	block := &Block{Height: 1, Transactions: []*Transaction{bc.NewCoinbaseTX(address, "", 1)}}
+	if err := bc.VerifyBlockTransactions(block); err != nil {
+		t.Fatalf("挖矿交易高度正确的区块应通过校验: %v", err)
+	}
+	block.Transactions[0] = bc.NewCoinbaseTX(address, "", 2)
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("挖矿交易高度错误的区块应被拒绝")
+	}
+}
+
+func TestRotateChangeAddress(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	from := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+
+	//找零给付款人
+	tx, err := NewTransactionFeeRate(from, payee, SatoshiPerBTC, 10, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.TXOutputs[1].isLockedWith(GetPubKeyHashFromPublicKey(w.PublicKey)) {
+		t.Fatal("未开启找零地址轮换时应找零给付款人")
+	}
+
+	defer func(rotate bool) { RotateChangeAddress = rotate }(RotateChangeAddress)
+	RotateChangeAddress = true
+	var changes [][]byte
+	for i := 0; i < 2; i++ {
+		tx, err := NewTransactionFeeRate(from, payee, SatoshiPerBTC, 10, bc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, tx.TXOutputs[1].ScriptPubKeyHash)
+	}
+	if string(changes[0]) == string(changes[1]) {
+		t.Fatal("两次交易的找零地址应不同")
+	}
+
+	//找零地址属于钱包
+	wm := NewWalletManager()
+	for _, change := range changes {
+		if string(change) == string(GetPubKeyHashFromPublicKey(w.PublicKey)) {
+			t.Fatal("找零地址不应为付款人地址")
+		}
+		owned := false
+		for _, wallet := range wm.Wallets {
+			owned = owned || string(GetPubKeyHashFromPublicKey(wallet.PublicKey)) == string(change)
+		}
+		if !owned {
+			t.Fatalf("找零地址%x不属于钱包", change)
+		}
+	}
+}
+
+func TestTransactionEquals(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	same, err := DeserializeTransaction(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Equals(same) {
+		t.Fatal("内容相同的交易应相等")
+	}
+
+	//只有一个签名字节不同：交易ID相同，但交易不相等
+	same.TXInputs[0].ScriptSign[10] ^= 0x01
+	if !bytes.Equal(same.TXID, tx.TXID) {
+		t.Fatal("签名不影响交易ID")
+	}
+	if tx.Equals(same) {
+		t.Fatal("签名不同的交易不应相等")
+	}
+	if tx.Equals(nil) {
+		t.Fatal("交易不等于nil")
+	}
+}
+
+func TestMempoolDeduplicates(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	coinbase := genesisCoinbase(t, bc)
+	tx := newTestSpend(t, w, coinbase, 0, w.getAddress(activeNetwork), 10000)
+	if err := bc.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate, err := DeserializeTransaction(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.mempool.Add(duplicate); err != ErrTxInMempool {
+		t.Fatalf("重复的交易应返回ErrTxInMempool，实际为%v", err)
+	}
+
+	duplicate.TXInputs[0].ScriptSign[10] ^= 0x01
+	if err := bc.mempool.Add(duplicate); err == nil || err == ErrTxInMempool {
+		t.Fatalf("签名不同的同ID交易应被拒绝，实际为%v", err)
+	}
+	if !bc.mempool.Get(tx.TXID).Equals(tx) {
+		t.Fatal("交易池中应保留原交易")
+	}
+}
+
+func TestTrimmedCopyIndependent(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	original := tx.Serialize()
+
+	txCopy := tx.trimmedCopy()
+	txCopy.TXID[0]++
+	txCopy.TXInputs[0].TXID[0]++
+	txCopy.TXInputs[0].Index++
+	txCopy.TXOutputs[0].Value++
+	txCopy.TXOutputs[1].ScriptPubKeyHash[0]++
+	txCopy.TXOutputs = txCopy.TXOutputs[:1]
+
+	if !bytes.Equal(tx.Serialize(), original) {
+		t.Fatal("修改副本后原交易被改变")
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("修改副本后原交易的签名应仍然有效")
+	}
+}
+
+func TestCloneIndependent(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	original := tx.Serialize()
+
+	clone := tx.Clone()
+	if !reflect.DeepEqual(clone, tx) {
+		t.Fatal("副本与原交易不同")
+	}
+	clone.TXID[0]++
+	clone.TimeStamp++
+	clone.LockTime++
+	clone.Version++
+	for i := range clone.TXInputs {
+		input := &clone.TXInputs[i]
+		input.TXID[0]++
+		input.Index++
+		input.ScriptSign[0]++
+		input.PubKey[0]++
+		input.Sequence--
+	}
+	for i := range clone.TXOutputs {
+		output := &clone.TXOutputs[i]
+		output.Value++
+		output.ScriptType++
+		output.ScriptPubKeyHash[0]++
+	}
+	clone.TXInputs = append(clone.TXInputs, TXInput{})
+	clone.TXOutputs = clone.TXOutputs[:1]
+
+	if !bytes.Equal(tx.Serialize(), original) {
+		t.Fatal("修改副本后原交易被改变")
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("修改副本后原交易的签名应仍然有效")
+	}
+
+	//nil切片保持为nil
+	empty := (&Transaction{}).Clone()
+	if empty.TXID != nil || empty.TXInputs != nil || empty.TXOutputs != nil {
+		t.Fatalf("空交易的副本为%+v", empty)
+	}
+}
+
+func TestInputIndexOutOfRange(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	for _, index := range []int64{1, 1 << 40, -2} {
+		tx, prevTXs := newFixedTestTX(priKey)
+		if !tx.Sign(priKey, prevTXs, SigHashAll) {
+			t.Fatal("交易签名失败")
+		}
+		tx.TXInputs[0].Index = index
+
+		if tx.Verify(prevTXs) {
+			t.Fatalf("索引值%d的交易校验应失败", index)
+		}
+		if _, err := tx.SignatureHash(0, SigHashAll, prevTXs); err == nil {
+			t.Fatalf("索引值%d应返回错误", index)
+		}
+		if _, err := txFee(tx, prevTXs); err == nil {
+			t.Fatalf("索引值%d计算手续费应返回错误", index)
+		}
+		tx.TXInputs[0].ScriptSign = nil
+		if tx.Sign(priKey, prevTXs, SigHashAll) {
+			t.Fatalf("索引值%d的交易签名应失败", index)
+		}
+	}
+
+	//引用链上交易时同样返回错误
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, w.getAddress(activeNetwork), 10000)
+	tx.TXInputs[0].Index = 7
+	if _, err := bc.GetPrevTXs(tx); err == nil {
+		t.Fatal("引用的output不存在时应返回错误")
+	}
+	if err := bc.mempool.Add(tx); err == nil {
+		t.Fatal("引用的output不存在的交易不应加入交易池")
+	}
+}
+
+func TestNewTXOutputFromHash(t *testing.T) {
+	w := newTestWallet(t)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+
+	output, err := NewTXOutputFromHash(pubKeyHash, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromAddress, err := NewTXOutput(w.getAddress(activeNetwork), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Value != 10000 || output.ScriptType != fromAddress.ScriptType || !bytes.Equal(output.ScriptPubKeyHash, fromAddress.ScriptPubKeyHash) {
+		t.Fatalf("output为%+v，期望与地址创建的output%+v相同", output, fromAddress)
+	}
+	//output不与调用者共享公钥哈希
+	pubKeyHash[0]++
+	if bytes.Equal(output.ScriptPubKeyHash, pubKeyHash) {
+		t.Fatal("修改传入的公钥哈希不应影响output")
+	}
+
+	for _, size := range []int{0, 19, 21, 32} {
+		if _, err := NewTXOutputFromHash(make([]byte, size), 10000); err == nil {
+			t.Errorf("%d字节的公钥哈希应被拒绝", size)
+		}
+	}
+	if _, err := NewTXOutputFromHash(make([]byte, 20), DustThreshold-1); err == nil {
+		t.Error("低于粉尘阈值的金额应被拒绝")
+	}
+}
+
+func TestBlockReward(t *testing.T) {
+	params := DefaultChainParams()
+	interval := params.HalvingInterval
+	cases := []struct {
+		height uint64
+		reward int64
+	}{
+		{0, initialReward},
+		{interval - 1, initialReward},
+		{interval, initialReward / 2},
+		{2 * interval, initialReward / 4},
+		//初始奖励小于2^31聪，第31次减半后为0
+		{30 * interval, initialReward >> 30},
+		{31 * interval, 0},
+		{64 * interval, 0},
+		{^uint64(0), 0},
+	}
+	address := newTestWallet(t).getAddress(activeNetwork)
+	for _, c := range cases {
+		if got := params.BlockReward(c.height); got != c.reward {
+			t.Errorf("高度%d的挖矿奖励为%d，期望%d", c.height, got, c.reward)
+		}
+		//挖矿交易获得该高度的奖励，奖励低于粉尘阈值或为0时也能创建
+		coinbase := newCoinbaseTX(address, "", c.height, c.reward)
+		if coinbase == nil || coinbase.TXOutputs[0].Value != c.reward {
+			t.Fatalf("高度%d的挖矿交易金额错误", c.height)
+		}
+		if err := coinbase.CheckSanity(); err != nil {
+			t.Fatalf("高度%d的挖矿交易检查失败: %v", c.height, err)
+		}
+	}
+
+	params.HalvingInterval = 0
+	if got := params.BlockReward(100 * 210000); got != initialReward {
+		t.Fatalf("不减半时挖矿奖励为%d，期望%d", got, initialReward)
+	}
+}
+
+func TestBlockRejectsExcessCoinbase(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	bc.params.HalvingInterval = 1
+
+	//高度1的奖励已减半
+	block := &Block{Height: 1, Transactions: []*Transaction{bc.NewCoinbaseTX(address, "", 1)}}
+	if block.Transactions[0].TXOutputs[0].Value != initialReward/2 {
+		t.Fatal("高度1的挖矿交易应获得减半后的奖励")
+	}
+	if err := bc.VerifyBlockTransactions(block); err != nil {
+		t.Fatalf("挖矿奖励正确的区块应通过校验: %v", err)
+	}
+
+	//领取减半前的奖励
+	coinbase := bc.NewCoinbaseTX(address, "", 1)
+	coinbase.TXOutputs[0].Value = initialReward
+	if err := coinbase.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions[0] = coinbase
+	if err := bc.VerifyBlockTransactions(block); err == nil {
+		t.Fatal("挖矿交易金额超过该高度的奖励时区块应被拒绝")
+	}
+}
+
+func TestValidateCoinbase(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	const fees = 10000
+
+	//领取挖矿奖励和手续费，金额为value
+	newCoinbase := func(height uint64, value int64) *Transaction {
+		coinbase := bc.NewCoinbaseTX(address, "", height)
+		coinbase.TXOutputs[0].Value = value
+		if err := coinbase.setHash(); err != nil {
+			t.Fatal(err)
+		}
+		return coinbase
+	}
+	if err := bc.ValidateCoinbase(newCoinbase(1, bc.params.BlockReward(1)+fees), 1, fees); err != nil {
+		t.Fatalf("金额正确的挖矿交易应通过校验: %v", err)
+	}
+	if err := bc.ValidateCoinbase(newCoinbase(1, bc.params.BlockReward(1)+fees+1), 1, fees); err == nil {
+		t.Fatal("多领取1聪的挖矿交易应被拒绝")
+	}
+	if err := bc.ValidateCoinbase(newCoinbase(1, bc.params.BlockReward(1)), 2, 0); err == nil {
+		t.Fatal("区块高度错误的挖矿交易应被拒绝")
+	}
+	spend := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, fees)
+	if err := bc.ValidateCoinbase(spend, 1, 0); err == nil {
+		t.Fatal("普通交易不是挖矿交易")
+	}
+
+	//区块中的挖矿交易可以领取区块内交易的手续费，多1聪时区块被拒绝
+	for _, c := range []struct {
+		value int64
+		valid bool
+	}{{bc.params.BlockReward(1) + fees, true}, {bc.params.BlockReward(1) + fees + 1, false}} {
+		block := &Block{Height: 1, Transactions: []*Transaction{newCoinbase(1, c.value), spend}}
+		if err := bc.VerifyBlockTransactions(block); (err == nil) != c.valid {
+			t.Fatalf("挖矿交易金额为%d时区块校验结果为%v", c.value, err)
+		}
+	}
+}
+
+func TestTransactionVersion(t *testing.T) {
+	w := newTestWallet(t)
+	address := w.getAddress(activeNetwork)
+	coinbase := newCoinbaseTX(address, "version", 1, initialReward)
+	if coinbase.Version != CurrentTxVersion {
+		t.Fatalf("新交易的版本号为%d，期望%d", coinbase.Version, CurrentTxVersion)
+	}
+	prevTXs := map[string]*Transaction{string(coinbase.TXID): coinbase}
+
+	//版本号参与交易ID和签名
+	tx := newTestSpend(t, w, coinbase, 0, address, 1000)
+	id := tx.TXID
+	tx.Version = CurrentTxVersion
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tx.TXID, id) {
+		t.Fatal("修改版本号后交易ID不变")
+	}
+	signTestTX(t, tx, w, prevTXs)
+	if err := tx.CheckSanity(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Version = 1
+	if tx.Verify(prevTXs) {
+		t.Fatal("修改版本号后签名仍然有效")
+	}
+
+	for _, version := range []int32{-1, MaxTxVersion + 1} {
+		tx.Version = version
+		if err := tx.CheckSanity(); err == nil {
+			t.Errorf("版本号%d的交易通过了检查", version)
+		}
+	}
+
+	//Taproot output需要新版本交易
+	tx.Version = taprootTxVersion - 1
+	tx.TXOutputs[0].ScriptType = ScriptTaproot
+	tx.TXOutputs[0].ScriptPubKeyHash = make([]byte, 32)
+	if err := tx.CheckSanity(); err == nil {
+		t.Error("旧版本交易可以创建Taproot output")
+	}
+	tx.Version = taprootTxVersion
+	if err := tx.CheckSanity(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEmptyTransactionRejected(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	signed, prevTXs := newFixedTestTX(priKey)
+	if !signed.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	cases := map[string]*Transaction{
+		"没有input和output": {TimeStamp: 1},
+		"没有input":        {TXOutputs: signed.TXOutputs, TimeStamp: 1},
+		"没有output":       {TXInputs: signed.TXInputs, TimeStamp: 1},
+	}
+	for name, tx := range cases {
+		if err := tx.setHash(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.CheckSanity(); err == nil {
+			t.Errorf("%s: 通过了结构检查", name)
+		}
+		if tx.Verify(prevTXs) {
+			t.Errorf("%s: 校验成功", name)
+		}
+		if tx.Sign(priKey, prevTXs, SigHashAll) {
+			t.Errorf("%s: 签名成功", name)
+		}
+	}
+
+	text := cases["没有input和output"].String()
+	if !strings.Contains(text, "Inputs: none") || !strings.Contains(text, "Outputs: none") {
+		t.Errorf("空交易的字符串表示为%q", text)
+	}
+}
+
+//多个goroutine同时校验同一交易，并对其副本重新签名
+func TestConcurrentSignVerify(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if !tx.Verify(prevTXs) {
+					errs <- "校验共享交易失败"
+					return
+				}
+			}
+		}()
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				clone := tx.Clone()
+				clone.TimeStamp += uint64(g*100 + i + 1)
+				if err := clone.setHash(); err != nil {
+					errs <- err.Error()
+					return
+				}
+				if !clone.Sign(priKey, prevTXs, SigHashAll|SigHashBIP143) || !clone.Verify(prevTXs) {
+					errs <- "重新签名的副本校验失败"
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("原交易签名被修改")
+	}
+}
+
+func TestValueOverflowRejected(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	coinbase := genesisCoinbase(t, bc)
+
+	//两个output的金额相加超过int64上限（各自不超过比特币总量上限时相加后超过总量上限）
+	for _, value := range []int64{1<<62 + 1, maxMoney} {
+		tx := newTestSpend(t, w, coinbase, 0, address, 1000)
+		tx.TXOutputs[0].Value = value
+		tx.TXOutputs = append(tx.TXOutputs, tx.TXOutputs[0])
+		if err := tx.setHash(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.CheckSanity(); err == nil {
+			t.Errorf("output金额为%d的交易通过了检查", value)
+		}
+		if _, err := txFee(tx, map[string]*Transaction{string(coinbase.TXID): coinbase}); err != ErrValueOverflow {
+			t.Errorf("计算手续费返回%v，期望%v", err, ErrValueOverflow)
+		}
+		if err := bc.mempool.Add(tx); err == nil {
+			t.Error("金额溢出的交易加入了交易池")
+		}
+	}
+
+	//引用的output总额溢出
+	prev := &Transaction{TXOutputs: []TXOutput{{Value: maxMoney}, {Value: maxMoney}}}
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: prev.TXID, Index: 0}, {TXID: prev.TXID, Index: 1}},
+		TXOutputs: []TXOutput{{Value: 1}},
+	}
+	if _, err := txFee(tx, map[string]*Transaction{string(prev.TXID): prev}); err != ErrValueOverflow {
+		t.Errorf("inputs总额溢出时返回%v，期望%v", err, ErrValueOverflow)
+	}
+
+	//手续费加挖矿奖励溢出
+	if err := bc.ValidateCoinbase(bc.NewCoinbaseTX(address, "", 1), 1, 1<<63-1); err != ErrValueOverflow {
+		t.Errorf("挖矿交易校验返回%v，期望%v", err, ErrValueOverflow)
+	}
+}
+
+func TestNewTransactionMultiSource(t *testing.T) {
+	bc, w1, cleanup := newTestChain(t)
+	defer cleanup()
+	w2 := newTestWallet(t)
+	from1 := w1.getAddress(activeNetwork)
+	from2 := w2.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w1)
+	saveTestWallet(t, w2)
+
+	//w1持有创世块的挖矿奖励，w2持有下一个区块的挖矿奖励
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, from2, "w2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	//转账金额超过任意一个地址的余额，必须合并两个地址的utxo
+	amount := initialReward + initialReward/2
+	tx, err := NewTransactionMultiSource([]string{from1, from2}, payee, amount, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TXInputs) != 2 {
+		t.Fatalf("input数量为%d，期望2", len(tx.TXInputs))
+	}
+
+	//每个input使用各自地址的公钥签名
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := map[string]bool{}
+	for _, input := range tx.TXInputs {
+		output, err := prevOutput(input, prevTXs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(GetPubKeyHashFromPublicKey(input.PubKey), output.ScriptPubKeyHash) {
+			t.Fatal("input的公钥与引用的output不匹配")
+		}
+		owners[string(output.ScriptPubKeyHash)] = true
+	}
+	if len(owners) != 2 {
+		t.Fatal("两个input应分别花费两个地址的output")
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("多地址交易签名校验失败")
+	}
+
+	//找零给第一个付款地址
+	var change bool
+	for _, output := range tx.TXOutputs {
+		change = change || output.isLockedWith(GetPubKeyHashFromPublicKey(w1.PublicKey))
+	}
+	if !change {
+		t.Fatal("找零应给第一个付款地址")
+	}
+
+	if _, err := NewTransactionMultiSource([]string{from1, from1}, payee, SatoshiPerBTC, bc); err == nil {
+		t.Fatal("重复的付款地址应被拒绝")
+	}
+	if _, err := NewTransactionMultiSource([]string{from1, from2}, payee, 3*initialReward, bc); err == nil {
+		t.Fatal("金额不足时应创建失败")
+	}
+}
+
+//按公钥哈希保存私钥的测试用私钥存储
+type testKeyStore map[string]crypto.PrivateKey
+
+func (s testKeyStore) PrivateKeyFor(pubKeyHash []byte) (crypto.PrivateKey, error) {
+	if priKey, ok := s[string(pubKeyHash)]; ok {
+		return priKey, nil
+	}
+	return nil, fmt.Errorf("没有公钥哈希%x对应的私钥", pubKeyHash)
+}
+
+func TestSignWithKeyStore(t *testing.T) {
+	keys := []*ecdsa.PrivateKey{
+		testPrivateKey(t, rfc6979P256Key),
+		testPrivateKey(t, "0000000000000000000000000000000000000000000000000000000000000001"),
+	}
+
+	//两个input分别花费属于两个私钥的output
+	store := testKeyStore{}
+	prevTXs := map[string]*Transaction{}
+	tx := &Transaction{
+		TXOutputs: []TXOutput{{Value: 60 * SatoshiPerBTC, ScriptPubKeyHash: bytes.Repeat([]byte{0x33}, 20)}},
+		TimeStamp: 1600000600,
+		Version:   CurrentTxVersion,
+	}
+	for i, priKey := range keys {
+		pubKey := ecdsaPublicKeyBytes(&priKey.PublicKey)
+		pubKeyHash := GetPubKeyHashFromPublicKey(pubKey)
+		store[string(pubKeyHash)] = priKey
+
+		prev := &Transaction{
+			TXInputs:  []TXInput{{Index: -1, PubKey: []byte(fmt.Sprintf("key %d", i)), Sequence: SequenceFinal}},
+			TXOutputs: []TXOutput{{Value: 50 * SatoshiPerBTC, ScriptPubKeyHash: pubKeyHash}},
+			TimeStamp: 1600000000,
+		}
+		prev.setHash()
+		prevTXs[string(prev.TXID)] = prev
+		tx.TXInputs = append(tx.TXInputs, TXInput{TXID: prev.TXID, Index: 0, PubKey: pubKey, Sequence: SequenceFinal})
+	}
+	tx.setHash()
+
+	if err := tx.SignWithKeyStore(store, prevTXs, SigHashAll); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify(prevTXs) {
+		t.Fatal("多私钥签名校验失败")
+	}
+
+	//单个私钥只能签名属于自己的input
+	single := tx.Clone()
+	if single.Sign(keys[0], prevTXs, SigHashAll) && single.Verify(prevTXs) {
+		t.Fatal("单个私钥签名的多地址交易不应通过校验")
+	}
+
+	//缺少任一私钥时签名失败，并指明input
+	missing := testKeyStore{}
+	for k, v := range store {
+		if !bytes.Equal([]byte(k), GetPubKeyHashFromPublicKey(tx.TXInputs[1].PubKey)) {
+			missing[k] = v
+		}
+	}
+	err := tx.Clone().SignWithKeyStore(missing, prevTXs, SigHashAll)
+	if err == nil || !strings.Contains(err.Error(), "第1个input") {
+		t.Fatalf("缺少私钥时应返回错误，得到%v", err)
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	//inputs 50 BTC，outputs 30+19 BTC
+	fee, err := tx.Fee(prevTXs)
+	if err != nil || fee != SatoshiPerBTC {
+		t.Fatalf("Fee = %d, %v，期望%d", fee, err, SatoshiPerBTC)
+	}
+	rate, err := tx.FeeRate(prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := SatoshiPerBTC / int64(tx.SerializedSize()); rate != want {
+		t.Fatalf("FeeRate = %d，期望%d", rate, want)
+	}
+	if _, err := tx.FeeRate(nil); err == nil {
+		t.Fatal("缺少引用的交易时应返回错误")
+	}
+
+	coinbase := newCoinbaseTX(newTestWallet(t).getAddress(activeNetwork), "", 1, initialReward)
+	if rate, err := coinbase.FeeRate(nil); err != nil || rate != 0 {
+		t.Fatalf("挖矿交易的FeeRate = %d, %v，期望0", rate, err)
+	}
+}
+
+func TestOutputsTotalOverflow(t *testing.T) {
+	tx := &Transaction{TXOutputs: []TXOutput{{Value: maxMoney}, {Value: 1}}}
+	if _, err := tx.outputsTotal(); err != ErrValueOverflow {
+		t.Fatalf("outputsTotal: 期望ErrValueOverflow，实际为%v", err)
+	}
+	if err := checkAbsurdFee(tx, maxMoney); err != ErrValueOverflow {
+		t.Fatalf("checkAbsurdFee: 期望ErrValueOverflow，实际为%v", err)
+	}
+	if _, err := tx.Inspect(); err != ErrValueOverflow {
+		t.Fatalf("Inspect: 期望ErrValueOverflow，实际为%v", err)
+	}
+
+	tx.TXOutputs[0].Value = maxMoney - 1
+	total, err := tx.outputsTotal()
+	if err != nil || total != maxMoney {
+		t.Fatalf("outputsTotal = %d, %v", total, err)
+	}
+	summary, err := tx.Inspect()
+	if err != nil || summary.TotalOutput != maxMoney {
+		t.Fatalf("Inspect = %+v, %v", summary, err)
+	}
+}
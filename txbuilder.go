@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//TxBuilder 交易构造器：链式设置付款人、收款人、手续费和锁定时间，Build时选择utxo、找零、签名并检查交易
+//设置时发生的错误在Build时返回
+type TxBuilder struct {
+	from     string
+	outputs  []TXOutput
+	fee      int64
+	lockTime uint64
+	selected map[string][]int64 //手动选择的utxo（key为交易ID，value为output索引的集合），为空时自动选择
+	err      error
+}
+
+//NewTxBuilder 创建交易构造器
+func NewTxBuilder() *TxBuilder {
+	return &TxBuilder{}
+}
+
+//From 设置付款人（钱包中有私钥的地址）
+func (b *TxBuilder) From(address string) *TxBuilder {
+	if b.err == nil && !IsValidAddress(address) {
+		b.err = fmt.Errorf("付款地址无效: %s", address)
+	}
+	b.from = address
+	return b
+}
+
+//To 添加收款人和转账金额，可多次调用
+func (b *TxBuilder) To(address string, amount int64) *TxBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !IsValidAddress(address) {
+		b.err = fmt.Errorf("收款地址无效: %s", address)
+		return b
+	}
+	output, err := NewTXOutput(address, amount)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.outputs = append(b.outputs, output)
+	return b
+}
+
+//Fee 设置手续费（聪）
+func (b *TxBuilder) Fee(fee int64) *TxBuilder {
+	if b.err == nil && fee < 0 {
+		b.err = errors.New("手续费不能为负数")
+	}
+	b.fee = fee
+	return b
+}
+
+//LockTime 设置锁定时间：小于LockTimeThreshold为区块高度，否则为Unix时间
+func (b *TxBuilder) LockTime(lockTime uint64) *TxBuilder {
+	b.lockTime = lockTime
+	return b
+}
+
+//Spend 手动选择要花费的utxo（coin control），可多次调用
+//选择了utxo时Build只使用这些utxo，它们必须属于付款人且总额足够支付转账金额和手续费
+func (b *TxBuilder) Spend(txid []byte, index int64) *TxBuilder {
+	if b.selected == nil {
+		b.selected = make(map[string][]int64)
+	}
+	key := string(txid)
+	b.selected[key] = append(b.selected[key], index)
+	return b
+}
+
+//Build 选择付款人的utxo，找零给付款人（或新的找零地址），签名后检查交易结构
+func (b *TxBuilder) Build(bc *BlockChain) (*Transaction, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.from == "" {
+		return nil, errors.New("没有设置付款人")
+	}
+	if len(b.outputs) == 0 {
+		return nil, errors.New("没有设置收款人")
+	}
+
+	//打开钱包，找到付款人的私钥
+	wm := NewWalletManager()
+	if wm == nil {
+		return nil, errors.New("打开钱包失败")
+	}
+	wallet, err := wm.SigningWallet(b.from)
+	if err != nil {
+		return nil, err
+	}
+
+	//选择足够支付转账金额和手续费的utxo
+	total := b.fee
+	for _, output := range b.outputs {
+		if total, err = addSatoshi(total, output.Value); err != nil {
+			return nil, err
+		}
+	}
+	pubKeyHash := GetPubKeyHashFromPublicKey(wallet.PublicKey)
+	bc.mux.RLock()
+	spentUTXO, retValue := bc.utxoSet.FindSpendable(pubKeyHash, total)
+	if b.selected != nil {
+		spentUTXO, retValue, err = bc.utxoSet.selectedValue(b.selected, pubKeyHash)
+	}
+	bc.mux.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if retValue < total {
+		return nil, errors.New("金额不足")
+	}
+
+	var inputs []TXInput
+	for txid, indexArray := range spentUTXO {
+		for _, i := range indexArray {
+			inputs = append(inputs, TXInput{TXID: []byte(txid), Index: i, PubKey: wallet.PublicKey, Sequence: MaxRBFSequence})
+		}
+	}
+
+	//找零金额低于粉尘阈值时不创建output，计入手续费
+	outputs := append([]TXOutput{}, b.outputs...)
+	if changeValue := retValue - total; changeValue >= DustThreshold {
+		change, err := changeAddress(wm, b.from)
+		if err != nil {
+			return nil, err
+		}
+		output, err := NewTXOutput(change, changeValue)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+
+	tx := Transaction{nil, inputs, outputs, uint64(time.Now().Unix()), b.lockTime, CurrentTxVersion}
+	if SortBIP69 {
+		tx.BIP69()
+	}
+	tx.setHash()
+	if !bc.SignTransaction(&tx, wallet.signingKey()) {
+		return nil, errors.New("交易签名失败")
+	}
+	if err := tx.CheckSanity(); err != nil {
+		return nil, err
+	}
+	if err := checkAbsurdFee(&tx, retValue); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTxBuilder(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	saveTestWallet(t, w)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	const fee, lockTime = 5000, 100
+
+	tx, err := NewTxBuilder().
+		From(address).
+		To(alice.getAddress(activeNetwork), 30000).
+		To(bob.getAddress(activeNetwork), 70000).
+		Fee(fee).
+		LockTime(lockTime).
+		Build(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.LockTime != lockTime {
+		t.Fatalf("锁定时间为%d，期望%d", tx.LockTime, lockTime)
+	}
+	if len(tx.TXOutputs) != 3 {
+		t.Fatalf("交易有%d个output，期望2个收款和1个找零", len(tx.TXOutputs))
+	}
+	for i, want := range []struct {
+		wallet *Wallet
+		value  int64
+	}{{alice, 30000}, {bob, 70000}} {
+		output := tx.TXOutputs[i]
+		if output.Value != want.value || !bytes.Equal(output.ScriptPubKeyHash, GetPubKeyHashFromPublicKey(want.wallet.PublicKey)) {
+			t.Fatalf("第%d个output为%+v，期望金额%d", i, output, want.value)
+		}
+	}
+	if change := tx.TXOutputs[2].Value; change != initialReward-30000-70000-fee {
+		t.Fatalf("找零金额为%d，期望%d", change, initialReward-30000-70000-fee)
+	}
+
+	prevTXs, err := bc.GetPrevTXs(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := txFee(tx, prevTXs); got != fee {
+		t.Fatalf("手续费为%d，期望%d", got, fee)
+	}
+	if err := bc.VerifyTransactionAgainstChain(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxBuilderRejected(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+
+	cases := map[string]*TxBuilder{
+		"没有付款人":   NewTxBuilder().To(payee, 10000),
+		"没有收款人":   NewTxBuilder().From(address),
+		"收款地址无效":  NewTxBuilder().From(address).To("invalid", 10000),
+		"付款地址无效":  NewTxBuilder().From("invalid").To(payee, 10000),
+		"粉尘金额":    NewTxBuilder().From(address).To(payee, DustThreshold-1),
+		"手续费为负数":  NewTxBuilder().From(address).To(payee, 10000).Fee(-1),
+		"金额不足":    NewTxBuilder().From(address).To(payee, initialReward+1),
+		"付款人没有私钥": NewTxBuilder().From(payee).To(address, 10000),
+	}
+	for name, builder := range cases {
+		if _, err := builder.Build(bc); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+}
+
+func TestAbsurdFeeRejected(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+	oldMaxFee, oldMaxFeeRate := MaxFee, MaxFeeRate
+	defer func() { MaxFee, MaxFeeRate = oldMaxFee, oldMaxFeeRate }()
+
+	//找零计算错误：几乎全部剩余金额成为手续费
+	if _, err := NewTxBuilder().From(address).To(payee, 10000).Fee(initialReward - 20000).Build(bc); err != ErrAbsurdFee {
+		t.Fatalf("手续费过高时返回%v，期望%v", err, ErrAbsurdFee)
+	}
+
+	//手续费不超过MaxFee，但超过MaxFeeRate
+	tx, err := NewTxBuilder().From(address).To(payee, 10000).Fee(5000).Build(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	MaxFeeRate = 5000/int64(tx.SerializedSize()) - 1
+	if _, err := NewTxBuilder().From(address).To(payee, 10000).Fee(5000).Build(bc); err != ErrAbsurdFee {
+		t.Fatalf("手续费率过高时返回%v，期望%v", err, ErrAbsurdFee)
+	}
+
+	//限制为0时不检查
+	MaxFee, MaxFeeRate = 0, 0
+	if _, err := NewTxBuilder().From(address).To(payee, 10000).Fee(initialReward - 20000).Build(bc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxBuilderCoinControl(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	saveTestWallet(t, w)
+	fund := fundTestOutputs(t, bc, w, []int64{40000, 30000, 10000, 20000})
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+
+	utxoInfos := bc.FindUTXOInRange(pubKeyHash, 15000, 35000)
+	if len(utxoInfos) != 2 || utxoInfos[0].Value != 20000 || utxoInfos[1].Value != 30000 {
+		t.Fatalf("范围内的utxo为%+v，期望20000和30000", utxoInfos)
+	}
+
+	//只使用手动选择的两个utxo，剩余金额找零
+	builder := NewTxBuilder().From(address).To(payee, 40000).Fee(1000)
+	for _, utxoInfo := range utxoInfos {
+		builder.Spend(utxoInfo.TXID, utxoInfo.Index)
+	}
+	tx, err := builder.Build(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := make(map[int64]bool)
+	for _, input := range tx.TXInputs {
+		if !bytes.Equal(input.TXID, fund.TXID) {
+			t.Fatalf("使用了其他交易的utxo %x", input.TXID)
+		}
+		used[input.Index] = true
+	}
+	if len(tx.TXInputs) != 2 || !used[1] || !used[3] {
+		t.Fatalf("使用的utxo为%v，期望索引1和3", used)
+	}
+	if len(tx.TXOutputs) != 2 || tx.TXOutputs[1].Value != 50000-40000-1000 {
+		t.Fatalf("交易的output为%+v，期望找零%d", tx.TXOutputs, 50000-40000-1000)
+	}
+	if err := bc.VerifyTransactionAgainstChain(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]*TxBuilder{
+		"金额不足":    NewTxBuilder().From(address).To(payee, 15000).Fee(1000).Spend(fund.TXID, 2),
+		"不属于付款人":  NewTxBuilder().From(address).To(payee, 10000).Spend(fund.TXID, 4),
+		"utxo不存在": NewTxBuilder().From(address).To(payee, 10000).Spend(fund.TXID, 5),
+		"已被花费":    NewTxBuilder().From(address).To(payee, 10000).Spend(genesisCoinbase(t, bc).TXID, 0),
+	}
+	for name, builder := range cases {
+		if _, err := builder.Build(bc); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+}
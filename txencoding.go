@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+	交易的二进制格式（用于网络传输和存储）：
+		与内存中的Transaction结构解耦，结构增加或调整字段不会改变已有数据的含义。
+		格式：格式版本号 | 交易ID | input个数 | 每个input的(交易ID, 索引值, 签名, 公钥, 序列号) |
+			output个数 | 每个output的(金额, 锁定脚本类型, 锁定脚本数据) | 时间戳 | 锁定时间 | [版本2：交易版本号]
+		整数使用变长编码，字节切片为长度+内容。
+		交易增加新字段时增加格式版本号，旧版本的数据仍可解码（新字段取零值）。
+*/
+
+const (
+	//交易格式版本1：没有交易版本号
+	txEncodingV1 uint64 = 1
+	//交易格式版本2：增加交易版本号
+	txEncodingV2 uint64 = 2
+)
+
+//当前的交易格式版本
+const txEncodingVersion = txEncodingV2
+
+//EncodeBinary 将交易编码为当前版本的二进制格式
+func (tx *Transaction) EncodeBinary() []byte {
+	return tx.encodeBinaryVersion(txEncodingVersion)
+}
+
+//将交易编码为指定版本的二进制格式
+func (tx *Transaction) encodeBinaryVersion(version uint64) []byte {
+	var buffer bytes.Buffer
+
+	writeUvarint(&buffer, version)
+	writeBytes(&buffer, tx.TXID)
+	writeUvarint(&buffer, uint64(len(tx.TXInputs)))
+	for _, input := range tx.TXInputs {
+		writeBytes(&buffer, input.TXID)
+		writeVarint(&buffer, input.Index)
+		writeBytes(&buffer, input.ScriptSign)
+		writeBytes(&buffer, input.PubKey)
+		writeUvarint(&buffer, uint64(input.Sequence))
+	}
+	writeUvarint(&buffer, uint64(len(tx.TXOutputs)))
+	for _, output := range tx.TXOutputs {
+		writeVarint(&buffer, output.Value)
+		buffer.WriteByte(byte(output.ScriptType))
+		writeBytes(&buffer, output.ScriptPubKeyHash)
+	}
+	writeUvarint(&buffer, tx.TimeStamp)
+	writeUvarint(&buffer, tx.LockTime)
+	if version >= txEncodingV2 {
+		writeVarint(&buffer, int64(tx.Version))
+	}
+	return buffer.Bytes()
+}
+
+//DecodeBinaryTransaction 解码二进制格式的交易，支持所有已知的格式版本
+func DecodeBinaryTransaction(data []byte) (*Transaction, error) {
+	reader := bytes.NewReader(data)
+
+	version, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version < txEncodingV1 || version > txEncodingVersion {
+		return nil, fmt.Errorf("交易格式版本%d不支持", version)
+	}
+
+	var tx Transaction
+	if tx.TXID, err = readBytes(reader); err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var input TXInput
+		if input.TXID, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		if input.Index, err = binary.ReadVarint(reader); err != nil {
+			return nil, err
+		}
+		if input.ScriptSign, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		if input.PubKey, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		sequence, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		if sequence > SequenceFinal {
+			return nil, errors.New("input序列号无效")
+		}
+		input.Sequence = uint32(sequence)
+		tx.TXInputs = append(tx.TXInputs, input)
+	}
+
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var output TXOutput
+		if output.Value, err = binary.ReadVarint(reader); err != nil {
+			return nil, err
+		}
+		scriptType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		output.ScriptType = ScriptType(scriptType)
+		if output.ScriptPubKeyHash, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+
+	if tx.TimeStamp, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	if tx.LockTime, err = binary.ReadUvarint(reader); err != nil {
+		return nil, err
+	}
+	//版本1的交易没有版本号（即引入版本号之前的交易，版本号为0）
+	if version >= txEncodingV2 {
+		txVersion, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		if txVersion < -1<<31 || txVersion > 1<<31-1 {
+			return nil, errors.New("交易版本号无效")
+		}
+		tx.Version = int32(txVersion)
+	}
+
+	if reader.Len() != 0 {
+		return nil, errors.New("交易数据末尾有多余的字节")
+	}
+	return &tx, nil
+}
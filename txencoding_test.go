@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestBinaryEncodingRoundTrip(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	tx.Version = CurrentTxVersion
+	tx.LockTime = 100
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	decoded, err := DecodeBinaryTransaction(tx.EncodeBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, tx) {
+		t.Fatalf("解码后的交易为%+v，期望%+v", decoded, tx)
+	}
+	if !decoded.Verify(prevTXs) {
+		t.Fatal("解码后的交易签名无效")
+	}
+}
+
+func TestBinaryEncodingDecodeV1(t *testing.T) {
+	//版本1格式的交易（没有交易版本号）
+	data, _ := hex.DecodeString("0102aabb010201020201300104ffffffff0f01a08d060002112280a0f8fa0564")
+	want := &Transaction{
+		TXID:      []byte{0xaa, 0xbb},
+		TXInputs:  []TXInput{{TXID: []byte{0x01, 0x02}, Index: 1, ScriptSign: []byte{0x30}, PubKey: []byte{0x04}, Sequence: SequenceFinal}},
+		TXOutputs: []TXOutput{{Value: 50000, ScriptType: ScriptP2PKH, ScriptPubKeyHash: []byte{0x11, 0x22}}},
+		TimeStamp: 1600000000,
+		LockTime:  100,
+	}
+	tx, err := DecodeBinaryTransaction(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tx, want) {
+		t.Fatalf("解码后的交易为%+v，期望%+v", tx, want)
+	}
+	if !bytes.Equal(want.encodeBinaryVersion(txEncodingV1), data) {
+		t.Fatal("版本1编码结果改变")
+	}
+
+	//重新编码为当前版本，交易版本号为0
+	tx, err = DecodeBinaryTransaction(tx.EncodeBinary())
+	if err != nil || !reflect.DeepEqual(tx, want) {
+		t.Fatalf("重新编码后解码为%+v(%v)", tx, err)
+	}
+}
+
+func TestBinaryEncodingRejected(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, _ := newFixedTestTX(priKey)
+	data := tx.EncodeBinary()
+
+	cases := map[string][]byte{
+		"空数据":    nil,
+		"未知格式版本": append([]byte{byte(txEncodingVersion + 1)}, data[1:]...),
+		"格式版本为0": append([]byte{0}, data[1:]...),
+		"数据截断":   data[:len(data)-1],
+		"多余数据":   append(append([]byte{}, data...), 0),
+	}
+	for name, data := range cases {
+		if _, err := DecodeBinaryTransaction(data); err == nil {
+			t.Errorf("%s: 解码成功", name)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 //UintToByteSlice Uint64转换为[]byte
@@ -14,13 +18,18 @@ func UintToByteSlice(num uint64) []byte {
 	//使用二进制编码(以小端对齐方式将数值以二进制编码方式写入到字节缓冲区)
 	err := binary.Write(&buffer, binary.LittleEndian, &num)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil
 	}
 	//返回字节切片
 	return buffer.Bytes()
 }
 
+//ByteSliceToUint []byte转换为Uint64（小端对齐）
+func ByteSliceToUint(data []byte) uint64 {
+	return binary.LittleEndian.Uint64(data)
+}
+
 //IsFileExist 判断文件是否存在
 func IsFileExist(filename string) bool {
 	//获取文件状态
@@ -31,3 +40,134 @@ func IsFileExist(filename string) bool {
 	}
 	return true
 }
+
+//比特币总量上限（单位：聪）
+const maxMoney = 21000000 * SatoshiPerBTC
+
+//ErrValueOverflow 金额溢出：金额为负数或相加后超过比特币总量上限
+var ErrValueOverflow = errors.New("金额溢出")
+
+//金额相加：a和b必须在0到maxMoney之间，和不能超过maxMoney（因此不会发生int64溢出）
+func addSatoshi(a, b int64) (int64, error) {
+	if a < 0 || b < 0 || a > maxMoney || b > maxMoney-a {
+		return 0, ErrValueOverflow
+	}
+	return a + b, nil
+}
+
+//ParseAmount 解析用户输入的金额，返回聪
+//支持比特币小数（如"0.001"）和以sat结尾的聪数（如"100000 sat"），直接解析数字避免浮点误差
+func ParseAmount(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+
+	//聪
+	if strings.HasSuffix(s, "sat") {
+		value, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(s, "sat")), 10, 64)
+		if err != nil {
+			return 0, errors.New("金额格式错误")
+		}
+		if value > maxMoney {
+			return 0, errors.New("金额超过比特币总量上限")
+		}
+		return value, nil
+	}
+
+	//比特币：拆分整数部分和小数部分
+	parts := strings.SplitN(s, ".", 2)
+	intPart, fracPart := parts[0], ""
+	if len(parts) == 2 {
+		fracPart = parts[1]
+		if fracPart == "" {
+			return 0, errors.New("金额格式错误")
+		}
+	}
+	if len(fracPart) > 8 {
+		return 0, errors.New("金额最多8位小数")
+	}
+
+	//整数部分
+	var btc uint64
+	if intPart != "" || fracPart == "" {
+		value, err := strconv.ParseUint(intPart, 10, 64)
+		if err != nil {
+			return 0, errors.New("金额格式错误")
+		}
+		if value > maxMoney/SatoshiPerBTC {
+			return 0, errors.New("金额超过比特币总量上限")
+		}
+		btc = value
+	}
+
+	//小数部分：补足8位后即为聪数
+	var sat uint64
+	if fracPart != "" {
+		value, err := strconv.ParseUint(fracPart+strings.Repeat("0", 8-len(fracPart)), 10, 64)
+		if err != nil {
+			return 0, errors.New("金额格式错误")
+		}
+		sat = value
+	}
+
+	amount := btc*SatoshiPerBTC + sat
+	if amount > maxMoney {
+		return 0, errors.New("金额超过比特币总量上限")
+	}
+	return amount, nil
+}
+
+//writeFileAtomic 原子写入文件：先写入同目录下的临时文件并同步到磁盘，再重命名为目标文件
+//写入过程中崩溃时，目标文件保持原来的内容
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	//出错时删除临时文件
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	err = os.Rename(tmpName, path)
+	return err
+}
+
+//在数据末尾附加4字节校验码
+func appendChecksum(data []byte) []byte {
+	return append(data, CheckSum(data)...)
+}
+
+//校验并去除末尾的4字节校验码（检测不完整或损坏的文件）
+func stripChecksum(content []byte) ([]byte, error) {
+	if len(content) < 4 {
+		return nil, errors.New("文件不完整")
+	}
+	data := content[:len(content)-4]
+	if !bytes.Equal(CheckSum(data), content[len(content)-4:]) {
+		return nil, errors.New("文件校验码错误，文件可能不完整或已损坏")
+	}
+	return data, nil
+}
+
+//复制字节切片（nil仍为nil）
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	return append([]byte{}, data...)
+}
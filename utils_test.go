@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+		ok    bool
+	}{
+		{"0.00000001", 1, true},
+		{"21000000", maxMoney, true},
+		{"0.001", 100000, true},
+		{"100000 sat", 100000, true},
+		{"1.5", 150000000, true},
+		{".5", 50000000, true},
+		{"21000000.00000001", 0, false},
+		{"21000001", 0, false},
+		{"2100000000000001 sat", 0, false},
+		{"1.234567891", 0, false},
+		{"1.", 0, false},
+		{"-1", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("ParseAmount(%q) = %d, %v，期望%d", tt.input, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("ParseAmount(%q) = %d，期望返回错误", tt.input, got)
+		}
+	}
+}
+
+func TestAddSatoshi(t *testing.T) {
+	const maxInt64 = 1<<63 - 1
+	for _, c := range []struct {
+		a, b int64
+		sum  int64
+		ok   bool
+	}{
+		{0, 0, 0, true},
+		{1, 2, 3, true},
+		{maxMoney - 1, 1, maxMoney, true},
+		{maxMoney, 1, 0, false},
+		{maxMoney, maxMoney, 0, false},
+		{maxInt64, maxInt64, 0, false},
+		{1, maxInt64, 0, false},
+		{-1, 1, 0, false},
+		{1, -1, 0, false},
+	} {
+		sum, err := addSatoshi(c.a, c.b)
+		if c.ok && (err != nil || sum != c.sum) {
+			t.Errorf("addSatoshi(%d, %d) = %d, %v，期望%d", c.a, c.b, sum, err, c.sum)
+		}
+		if !c.ok && err != ErrValueOverflow {
+			t.Errorf("addSatoshi(%d, %d)返回%v，期望%v", c.a, c.b, err, ErrValueOverflow)
+		}
+	}
+}
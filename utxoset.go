@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//UTXOSet UTXO集合：在内存中缓存所有未消费的output，避免每次查询都遍历账本
+type UTXOSet struct {
+	utxos map[string]UTXOInfo //未消费的output（key为交易ID+索引值）
+	tip   []byte              //UTXO集合对应的最后一个区块的哈希值
+}
+
+//UTXO集合文件
+const utxoSetFile = "utxoset.dat"
+
+//UTXO集合文件格式版本（版本不同时重建UTXO集合）
+const utxoSetVersion = 3
+
+//NewUTXOSet 创建一个空的UTXO集合
+func NewUTXOSet() *UTXOSet {
+	u := UTXOSet{
+		utxos: make(map[string]UTXOInfo),
+	}
+	return &u
+}
+
+//Reindex 清空UTXO集合并遍历账本重新构建，读取区块失败时返回错误，UTXO集合保持不变
+func (u *UTXOSet) Reindex(bc *BlockChain) error {
+	utxos := make(map[string]UTXOInfo)
+	//空区块链
+	if len(bc.tail) == 0 {
+		u.utxos, u.tip = utxos, bc.tail
+		return nil
+	}
+
+	spent := make(map[string]bool) //已消耗的output
+
+	//从最后一个区块向前遍历：output被消耗时，消耗它的交易一定已被遍历过
+	it := bc.newIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return errors.New("读取区块失败")
+		}
+		//先记录区块内所有交易消耗的output（区块内的交易可能使用同区块的output）
+		for _, tx := range block.Transactions {
+			if tx.isCoinBaseTX() {
+				continue
+			}
+			for _, input := range tx.TXInputs {
+				spent[outpointKey(input.TXID, input.Index)] = true
+			}
+		}
+		//再记录未被消耗的output
+		for _, tx := range block.Transactions {
+			for i, output := range tx.TXOutputs {
+				key := outpointKey(tx.TXID, int64(i))
+				if !spent[key] && output.isSpendable() {
+					utxos[key] = UTXOInfo{tx.TXID, int64(i), output}
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	u.utxos, u.tip = utxos, bc.tail
+	return nil
+}
+
+//Update 新区块上链后增量更新UTXO集合
+func (u *UTXOSet) Update(block *Block) {
+	for _, tx := range block.Transactions {
+		//移除被消耗的output
+		if !tx.isCoinBaseTX() {
+			for _, input := range tx.TXInputs {
+				delete(u.utxos, outpointKey(input.TXID, input.Index))
+			}
+		}
+		//添加新产生的output
+		for i, output := range tx.TXOutputs {
+			if output.isSpendable() {
+				u.utxos[outpointKey(tx.TXID, int64(i))] = UTXOInfo{tx.TXID, int64(i), output}
+			}
+		}
+	}
+	u.tip = block.Hash
+}
+
+//Rollback 撤销区块对UTXO集合的修改（链重组时断开区块使用）
+func (u *UTXOSet) Rollback(block *Block, bc *BlockChain) error {
+	//倒序处理交易：区块内后面的交易可能使用了前面交易的output
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		//移除交易产生的output（包括挖矿奖励）
+		for j := range tx.TXOutputs {
+			delete(u.utxos, outpointKey(tx.TXID, int64(j)))
+		}
+		if tx.isCoinBaseTX() {
+			continue
+		}
+		//恢复交易消耗的output
+		for _, input := range tx.TXInputs {
+			prevTX, err := bc.FindTransaction(input.TXID)
+			if err != nil {
+				return err
+			}
+			if err := checkOutputIndex(input, prevTX); err != nil {
+				return err
+			}
+			u.utxos[outpointKey(input.TXID, input.Index)] = UTXOInfo{input.TXID, input.Index, prevTX.TXOutputs[input.Index]}
+		}
+	}
+	u.tip = block.PrevHash
+	return nil
+}
+
+//FindUTXO 获取公钥哈希对应的所有utxo
+func (u *UTXOSet) FindUTXO(pubKeyHash []byte) []UTXOInfo {
+	var utxoInfos []UTXOInfo
+	for _, utxoInfo := range u.utxos {
+		if utxoInfo.isLockedWith(pubKeyHash) {
+			utxoInfos = append(utxoInfos, utxoInfo)
+		}
+	}
+	return utxoInfos
+}
+
+//Balance 获取公钥哈希对应的金额
+func (u *UTXOSet) Balance(pubKeyHash []byte) int64 {
+	var total int64
+	for _, utxoInfo := range u.FindUTXO(pubKeyHash) {
+		total += utxoInfo.Value
+	}
+	return total
+}
+
+//BalanceDetail 获取公钥哈希对应的已确认金额，以及计入交易池中交易后的待确认金额
+//pending = confirmed - 被交易池交易消耗的utxo + 交易池交易新产生且未被消耗的output
+func (u *UTXOSet) BalanceDetail(pubKeyHash []byte, mempool *Mempool) (confirmed, pending int64) {
+	confirmed = u.Balance(pubKeyHash)
+	pending = confirmed
+	if mempool == nil {
+		return confirmed, pending
+	}
+
+	for _, entry := range mempool.entries {
+		//被交易池交易消耗的已确认utxo
+		for _, input := range entry.tx.TXInputs {
+			utxoInfo, ok := u.utxos[outpointKey(input.TXID, input.Index)]
+			if ok && utxoInfo.isLockedWith(pubKeyHash) {
+				pending -= utxoInfo.Value
+			}
+		}
+		//交易池交易新产生的output（可能又被交易池中其他交易消耗）
+		for i, output := range entry.tx.TXOutputs {
+			if !output.isLockedWith(pubKeyHash) {
+				continue
+			}
+			if _, spent := mempool.spent[outpointKey(entry.tx.TXID, int64(i))]; !spent {
+				pending += output.Value
+			}
+		}
+	}
+	return confirmed, pending
+}
+
+//FindSpendable 找到满足转账金额的utxo集合(key为交易ID，value为output索引的集合)及其总金额
+func (u *UTXOSet) FindSpendable(pubKeyHash []byte, amount int64) (map[string][]int64, int64) {
+	var retMap = make(map[string][]int64)
+	var retValue int64
+
+	for _, utxoInfo := range u.FindUTXO(pubKeyHash) {
+		retValue += utxoInfo.Value
+		key := string(utxoInfo.TXID)
+		retMap[key] = append(retMap[key], utxoInfo.Index)
+		//总金额满足转账金额，直接返回
+		if retValue >= amount {
+			break
+		}
+	}
+	return retMap, retValue
+}
+
+//手动选择的utxo的总金额：每个utxo都必须存在于UTXO集合中且属于公钥哈希
+func (u *UTXOSet) selectedValue(selected map[string][]int64, pubKeyHash []byte) (map[string][]int64, int64, error) {
+	var retValue int64
+	for txid, indexArray := range selected {
+		for _, i := range indexArray {
+			utxoInfo, ok := u.utxos[outpointKey([]byte(txid), i)]
+			if !ok {
+				return nil, 0, fmt.Errorf("utxo %x:%d不存在或已被花费", txid, i)
+			}
+			if !utxoInfo.isLockedWith(pubKeyHash) {
+				return nil, 0, fmt.Errorf("utxo %x:%d不属于付款人", txid, i)
+			}
+			retValue += utxoInfo.Value
+		}
+	}
+	return selected, retValue, nil
+}
+
+//Save 将UTXO集合保存到磁盘
+//格式：版本号 | 最后一个区块哈希 | utxo个数 | 每个utxo的(交易ID, 索引值, 金额, 锁定脚本类型, 锁定脚本数据) | 校验码(4字节)
+//整数使用变长编码，文件通过临时文件+重命名原子写入
+func (u *UTXOSet) Save(path string) error {
+	var buffer bytes.Buffer
+
+	writeUvarint(&buffer, utxoSetVersion)
+	writeBytes(&buffer, u.tip)
+	writeUvarint(&buffer, uint64(len(u.utxos)))
+	for _, utxoInfo := range u.utxos {
+		writeBytes(&buffer, utxoInfo.TXID)
+		writeVarint(&buffer, utxoInfo.Index)
+		writeVarint(&buffer, utxoInfo.Value)
+		buffer.WriteByte(byte(utxoInfo.ScriptType))
+		writeBytes(&buffer, utxoInfo.ScriptPubKeyHash)
+	}
+
+	return writeFileAtomic(path, appendChecksum(buffer.Bytes()), 0600)
+}
+
+//LoadUTXOSet 从磁盘加载UTXO集合
+func LoadUTXOSet(path string) (*UTXOSet, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	//校验码错误：文件不完整或已损坏
+	content, err = stripChecksum(content)
+	if err != nil {
+		return nil, err
+	}
+	reader := bytes.NewReader(content)
+
+	version, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version != utxoSetVersion {
+		return nil, errors.New("UTXO集合文件版本不支持")
+	}
+
+	u := NewUTXOSet()
+	u.tip, err = readBytes(reader)
+	if err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var utxoInfo UTXOInfo
+		if utxoInfo.TXID, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		if utxoInfo.Index, err = binary.ReadVarint(reader); err != nil {
+			return nil, err
+		}
+		if utxoInfo.Value, err = binary.ReadVarint(reader); err != nil {
+			return nil, err
+		}
+		scriptType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		utxoInfo.ScriptType = ScriptType(scriptType)
+		if utxoInfo.ScriptPubKeyHash, err = readBytes(reader); err != nil {
+			return nil, err
+		}
+		u.utxos[outpointKey(utxoInfo.TXID, utxoInfo.Index)] = utxoInfo
+	}
+	return u, nil
+}
+
+//写入无符号变长整数
+func writeUvarint(buffer *bytes.Buffer, x uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, x)
+	buffer.Write(tmp[:n])
+}
+
+//写入有符号变长整数
+func writeVarint(buffer *bytes.Buffer, x int64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(tmp, x)
+	buffer.Write(tmp[:n])
+}
+
+//写入字节切片：长度+内容
+func writeBytes(buffer *bytes.Buffer, data []byte) {
+	writeUvarint(buffer, uint64(len(data)))
+	buffer.Write(data)
+}
+
+//读取字节切片：长度+内容
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(reader.Len()) {
+		return nil, errors.New("数据长度无效")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
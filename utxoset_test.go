@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+//不经过挖矿直接向账本追加n个区块（同时更新交易索引），每个区块只有一个挖矿交易，奇数区块的奖励属于address
+func appendTestBlocks(t testing.TB, bc *BlockChain, n int, address, other string) {
+	t.Helper()
+	height := bc.NewIterator().Next().Height
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		for i := 0; i < n; i++ {
+			height++
+			miner := other
+			if i%2 == 1 {
+				miner = address
+			}
+			block := &Block{
+				PrevHash:     bc.tail,
+				TimeStamp:    uint64(time.Now().Unix()),
+				Height:       height,
+				Transactions: []*Transaction{bc.NewCoinbaseTX(miner, fmt.Sprintf("block %d", i), height)},
+			}
+			hash := sha256.Sum256(block.Serialize())
+			block.Hash = hash[:]
+			if err := bucket.Put(block.Hash, block.Serialize()); err != nil {
+				return err
+			}
+			if err := putTxIndex(tx, block, height); err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(lastBlockHashKey), block.Hash); err != nil {
+				return err
+			}
+			bc.tail = block.Hash
+			bc.utxoSet.Update(block)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+//按output位置排序，便于比较
+func sortedUTXOKeys(utxoInfos []UTXOInfo) []string {
+	var keys []string
+	for _, utxoInfo := range utxoInfos {
+		keys = append(keys, outpointKey(utxoInfo.TXID, utxoInfo.Index))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUTXOSetMatchesChainScan(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+
+	//花费创世块的奖励，找零给自己
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, address, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, address, "1"), tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := sortedUTXOKeys(bc.FindMyUTXO(pubKeyHash))
+	if got := sortedUTXOKeys(bc.utxoSet.FindUTXO(pubKeyHash)); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("增量更新的UTXO集合为%v，遍历账本得到%v", got, want)
+	}
+	if len(want) != 2 {
+		t.Fatalf("期望2个utxo，实际为%d个", len(want))
+	}
+
+	//重新构建的UTXO集合与遍历账本的结果一致
+	utxoSet := NewUTXOSet()
+	if err := utxoSet.Reindex(bc); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedUTXOKeys(utxoSet.FindUTXO(pubKeyHash)); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("重新构建的UTXO集合为%v，遍历账本得到%v", got, want)
+	}
+	if got := utxoSet.Balance(pubKeyHash); got != 2*initialReward-10000 {
+		t.Fatalf("金额为%d，期望%d", got, 2*initialReward-10000)
+	}
+
+	//找到满足金额的utxo
+	spendable, total := utxoSet.FindSpendable(pubKeyHash, initialReward+1)
+	if total < initialReward+1 || len(spendable) != 2 {
+		t.Fatalf("找到%d个交易的utxo，总金额%d", len(spendable), total)
+	}
+}
+
+//在1000个区块的账本上比较UTXO集合与遍历账本的选币速度
+func BenchmarkFindSpendable(b *testing.B) {
+	bc, w, cleanup := newTestChain(b)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	appendTestBlocks(b, bc, 1000, address, newTestWallet(b).getAddress(activeNetwork))
+	amount := 100 * initialReward
+
+	b.Run("UTXOSet", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, total := bc.utxoSet.FindSpendable(pubKeyHash, amount); total < amount {
+				b.Fatal("金额不足")
+			}
+		}
+	})
+	b.Run("ChainScan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var total int64
+			for _, utxoInfo := range bc.FindMyUTXO(pubKeyHash) {
+				total += utxoInfo.Value
+				if total >= amount {
+					break
+				}
+			}
+			if total < amount {
+				b.Fatal("金额不足")
+			}
+		}
+	})
+}
+
+func TestUTXOSetSaveLoad(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	appendTestBlocks(t, bc, 4, address, newTestWallet(t).getAddress(activeNetwork))
+
+	if err := bc.utxoSet.Save(utxoSetFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadUTXOSet(utxoSetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.tip, bc.tail) {
+		t.Fatalf("加载的最后区块哈希为%x，期望%x", loaded.tip, bc.tail)
+	}
+	if len(loaded.utxos) != len(bc.utxoSet.utxos) {
+		t.Fatalf("加载了%d个utxo，期望%d个", len(loaded.utxos), len(bc.utxoSet.utxos))
+	}
+	for key, utxoInfo := range bc.utxoSet.utxos {
+		got, ok := loaded.utxos[key]
+		if !ok || got.Value != utxoInfo.Value || !bytes.Equal(got.ScriptPubKeyHash, utxoInfo.ScriptPubKeyHash) {
+			t.Fatalf("utxo %s加载后为%+v，期望%+v", key, got, utxoInfo)
+		}
+	}
+	if got, want := loaded.Balance(pubKeyHash), bc.utxoSet.Balance(pubKeyHash); got != want {
+		t.Fatalf("加载后金额为%d，期望%d", got, want)
+	}
+}
+
+//模拟写入过程中崩溃：截断的UTXO集合文件加载失败，区块链重新构建UTXO集合
+func TestUTXOSetTruncatedFile(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	appendTestBlocks(t, bc, 2, w.getAddress(activeNetwork), newTestWallet(t).getAddress(activeNetwork))
+
+	if err := bc.utxoSet.Save(utxoSetFile); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(utxoSetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(utxoSetFile, content[:len(content)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUTXOSet(utxoSetFile); err == nil {
+		t.Fatal("截断的UTXO集合文件加载成功")
+	}
+	bc.db.Close()
+
+	bc, err = GetBlockChainInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.db.Close()
+	if got := bc.utxoSet.Balance(pubKeyHash); got != 2*initialReward {
+		t.Fatalf("金额为%d，期望%d", got, 2*initialReward)
+	}
+}
+
+func TestUTXOSetReindexWhenStale(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+
+	//保存的UTXO集合只包含创世块
+	staleTip := bc.utxoSet.tip
+	if err := bc.utxoSet.Save(utxoSetFile); err != nil {
+		t.Fatal(err)
+	}
+	//追加区块但不保存UTXO集合
+	appendTestBlocks(t, bc, 4, address, newTestWallet(t).getAddress(activeNetwork))
+	bc.db.Close()
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.db.Close()
+	if bytes.Equal(bc.utxoSet.tip, staleTip) || !bytes.Equal(bc.utxoSet.tip, bc.tail) {
+		t.Fatal("过期的UTXO集合应被重新构建")
+	}
+	//创世块和2个奇数区块的奖励
+	if got := bc.utxoSet.Balance(pubKeyHash); got != 3*initialReward {
+		t.Fatalf("金额为%d，期望%d", got, 3*initialReward)
+	}
+	//重新构建的UTXO集合已保存
+	loaded, err := LoadUTXOSet(utxoSetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.tip, bc.tail) {
+		t.Fatal("重新构建的UTXO集合应保存到磁盘")
+	}
+}
+
+func TestReindexAllRepairsUTXOSet(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	appendTestBlocks(t, bc, 4, address, newTestWallet(t).getAddress(activeNetwork))
+	want := sortedUTXOKeys(bc.utxoSet.FindUTXO(pubKeyHash))
+
+	//破坏UTXO集合：删除一个utxo，加入一个不存在的utxo
+	for key := range bc.utxoSet.utxos {
+		delete(bc.utxoSet.utxos, key)
+		break
+	}
+	bogus := UTXOInfo{[]byte("bogus"), 0, TXOutput{Value: initialReward, ScriptPubKeyHash: pubKeyHash}}
+	bc.utxoSet.utxos[outpointKey(bogus.TXID, bogus.Index)] = bogus
+
+	if err := bc.ReindexAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedUTXOKeys(bc.utxoSet.FindUTXO(pubKeyHash)); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("重建后的utxo为%v，期望%v", got, want)
+	}
+	if got := bc.utxoSet.Balance(pubKeyHash); got != 3*initialReward {
+		t.Fatalf("重建后金额为%d，期望%d", got, 3*initialReward)
+	}
+	if len(bc.utxoSet.utxos) != 5 {
+		t.Fatalf("重建后共%d个utxo，期望5个", len(bc.utxoSet.utxos))
+	}
+	//重建结果已保存
+	loaded, err := LoadUTXOSet(utxoSetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.utxos) != 5 {
+		t.Fatalf("保存的UTXO集合有%d个utxo，期望5个", len(loaded.utxos))
+	}
+}
+
+func TestBalanceDetailWithMempool(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	fund := fundTestOutputs(t, bc, w, []int64{SatoshiPerBTC, 2 * SatoshiPerBTC})
+	m := NewMempool(bc)
+
+	//花费1 BTC的utxo：0.3 BTC给收款人，扣除手续费后找零
+	const fee = 10000
+	tx := &Transaction{
+		TXInputs:  []TXInput{{TXID: fund.TXID, Index: 0, PubKey: w.PublicKey, Sequence: MaxRBFSequence}},
+		TimeStamp: uint64(time.Now().Unix()),
+	}
+	for _, o := range []struct {
+		address string
+		value   int64
+	}{
+		{newTestWallet(t).getAddress(activeNetwork), SatoshiPerBTC * 3 / 10},
+		{address, SatoshiPerBTC*7/10 - fee},
+	} {
+		output, err := NewTXOutput(o.address, o.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	signTestTX(t, tx, w, map[string]*Transaction{string(fund.TXID): fund})
+	if err := m.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	confirmed, pending := bc.utxoSet.BalanceDetail(pubKeyHash, m)
+	if confirmed != 3*SatoshiPerBTC {
+		t.Errorf("已确认金额为%d，期望%d", confirmed, 3*SatoshiPerBTC)
+	}
+	if want := int64(3*SatoshiPerBTC - SatoshiPerBTC*3/10 - fee); pending != want {
+		t.Errorf("待确认金额为%d，期望%d", pending, want)
+	}
+}
+
+func TestUTXOSetReindexMissingBlock(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	address := w.getAddress(activeNetwork)
+	appendTestBlocks(t, bc, 3, address, address)
+	if err := bc.utxoSet.Save(utxoSetFile); err != nil {
+		t.Fatal(err)
+	}
+	count := len(bc.utxoSet.utxos)
+
+	//删除中间的区块，遍历账本时读不到该区块
+	hash := blockAtHeight(t, bc, 1).Hash
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(blockBucket)).Delete(hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//重建失败时UTXO集合保持不变
+	if err := bc.utxoSet.Reindex(bc); err == nil || err.Error() != "读取区块失败" {
+		t.Fatalf("Reindex返回%v，期望读取区块失败", err)
+	}
+	if len(bc.utxoSet.utxos) != count || !bytes.Equal(bc.utxoSet.tip, bc.tail) {
+		t.Fatal("重建失败后UTXO集合不应改变")
+	}
+	if err := bc.ReindexAll(); err == nil {
+		t.Fatal("区块缺失时ReindexAll应返回错误")
+	}
+
+	//打开区块链时需要重建过期的UTXO集合，重建失败时返回错误
+	stale := NewUTXOSet()
+	if err := stale.Save(utxoSetFile); err != nil {
+		t.Fatal(err)
+	}
+	bc.db.Close()
+	if reopened, err := GetBlockChainInstanceWithParams(bc.Params()); err == nil {
+		reopened.db.Close()
+		t.Fatal("UTXO集合无法重建时打开区块链应返回错误")
+	}
+}
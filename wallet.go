@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"fmt"
+	"errors"
+	"math/big"
+	"strings"
 
 	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ripemd160"
 )
 
@@ -18,37 +22,186 @@ type Wallet struct {
 	//X,Y类型一致，将X和Y拼接成字节流赋值给publicKey字段用于传输
 	//验证时将X和Y截取出来再创建一条曲线，还原公钥以进行校验
 	PublicKey []byte //公钥
+
+	Scheme       SchemeID           //签名算法
+	EdPrivateKey ed25519.PrivateKey //Ed25519私钥（签名算法为Ed25519时使用）
 }
 
+//Network 网络类型：以地址的版本号区分主网和测试网
+type Network byte
+
+const (
+	//Mainnet 主网地址版本号
+	Mainnet Network = 0x00
+	//Testnet 测试网地址版本号
+	Testnet Network = 0x6f
+)
+
+//当前使用的网络
+var activeNetwork = Mainnet
+
 //NewWalletKeyPair 创建钱包：密钥对
 func NewWalletKeyPair() *Wallet {
 	//创建私钥
 	curve := elliptic.P256()                                 //创建曲线
 	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader) //生成私钥
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return nil
 	}
 
+	return newWallet(privateKey)
+}
+
+//通过私钥创建钱包
+func newWallet(privateKey *ecdsa.PrivateKey) *Wallet {
 	//通过私钥获得公钥
 	publicKey := privateKey.PublicKey
 
-	//将公钥的X,Y进行拼接
-	pubKey := append(publicKey.X.Bytes(), publicKey.Y.Bytes()...)
+	//将公钥的X,Y补齐后进行拼接
+	pubKey := ecdsaPublicKeyBytes(&publicKey)
 
 	//返回
-	wallet := Wallet{privateKey, pubKey}
+	wallet := Wallet{PrivateKey: privateKey, PublicKey: pubKey, Scheme: SchemeECDSAP256}
 	return &wallet
 }
 
-//根据私钥生成地址
-func (w *Wallet) getAddress() string {
+//NewEd25519WalletKeyPair 创建使用Ed25519签名的钱包
+func NewEd25519WalletKeyPair() *Wallet {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	return newEd25519Wallet(privateKey)
+}
+
+//通过Ed25519私钥创建钱包
+func newEd25519Wallet(privateKey ed25519.PrivateKey) *Wallet {
+	return &Wallet{PublicKey: ed25519PublicKeyBytes(privateKey), Scheme: SchemeEd25519, EdPrivateKey: privateKey}
+}
+
+//签名使用的私钥
+func (w *Wallet) signingKey() crypto.PrivateKey {
+	if w.Scheme == SchemeEd25519 {
+		return w.EdPrivateKey
+	}
+	return w.PrivateKey
+}
+
+//WIF格式私钥的版本号
+func wifVersion(network Network) byte {
+	if network == Testnet {
+		return 0xef
+	}
+	return 0x80
+}
+
+//ExportWIF 将私钥导出为WIF（Wallet Import Format）格式
+//格式：版本号(1字节) + 私钥(32字节) + 压缩标志0x01(1字节) + 校验码(4字节)，再进行base58编码
+func (w *Wallet) ExportWIF() (string, error) {
+	if w.Scheme == SchemeEd25519 {
+		return "", errors.New("Ed25519钱包不支持导出WIF格式私钥")
+	}
+	if w.PrivateKey == nil {
+		return "", errors.New("钱包没有私钥")
+	}
+
+	key, err := w.privateKeyBytes()
+	if err != nil {
+		return "", err
+	}
+
+	payload := append([]byte{wifVersion(activeNetwork)}, key...)
+	payload = append(payload, 0x01)
+	payload = append(payload, CheckSum(payload)...)
+	return base58.Encode(payload), nil
+}
+
+//ImportWIF 从WIF格式私钥还原钱包
+func ImportWIF(wif string) (*Wallet, error) {
+	deInfo := base58.Decode(wif)
+	//未压缩：1+32+4字节，压缩：1+32+1+4字节
+	if len(deInfo) != 37 && len(deInfo) != 38 {
+		return nil, errors.New("WIF长度无效")
+	}
+
+	//校验码
+	payload := deInfo[:len(deInfo)-4]
+	if !bytes.Equal(CheckSum(payload), deInfo[len(deInfo)-4:]) {
+		return nil, errors.New("WIF校验码错误")
+	}
+	//版本号
+	if payload[0] != wifVersion(activeNetwork) {
+		return nil, errors.New("WIF不属于当前网络")
+	}
+	//压缩标志
+	if len(payload) == 34 && payload[33] != 0x01 {
+		return nil, errors.New("WIF压缩标志无效")
+	}
+
+	return walletFromKeyBytes(payload[1:33])
+}
+
+//私钥的字节表示：固定为32字节，不足时在前面补0（Ed25519为32字节种子）
+func (w *Wallet) privateKeyBytes() ([]byte, error) {
+	if w.Scheme == SchemeEd25519 {
+		if len(w.EdPrivateKey) != ed25519.PrivateKeySize {
+			return nil, errors.New("私钥无效")
+		}
+		return copyBytes(w.EdPrivateKey[:ed25519.SeedSize]), nil
+	}
+	key := make([]byte, 32)
+	d := w.PrivateKey.D.Bytes()
+	if len(d) > len(key) {
+		return nil, errors.New("私钥无效")
+	}
+	copy(key[len(key)-len(d):], d)
+	return key, nil
+}
+
+//根据32字节私钥还原钱包（私钥和公钥）
+func walletFromKeyBytes(key []byte) (*Wallet, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(key)
+	if len(key) != 32 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("私钥无效")
+	}
+	privateKey := new(ecdsa.PrivateKey)
+	privateKey.Curve = curve
+	privateKey.D = d
+	privateKey.X, privateKey.Y = curve.ScalarBaseMult(key)
+
+	return newWallet(privateKey), nil
+}
+
+//根据签名算法和32字节私钥还原钱包
+func walletFromSchemeKey(scheme SchemeID, key []byte) (*Wallet, error) {
+	switch scheme {
+	case SchemeECDSAP256:
+		return walletFromKeyBytes(key)
+	case SchemeEd25519:
+		if len(key) != ed25519.SeedSize {
+			return nil, errors.New("私钥无效")
+		}
+		return newEd25519Wallet(ed25519.NewKeyFromSeed(key)), nil
+	}
+	return nil, errors.New("不支持的签名算法")
+}
+
+//根据私钥生成指定网络的地址
+func (w *Wallet) getAddress(network Network) string {
+	return PublicKeyToAddress(w.PublicKey, network)
+}
+
+//PublicKeyToAddress 根据公钥生成指定网络的地址：base58(版本号 + 公钥哈希 + 校验码)
+func PublicKeyToAddress(pubKey []byte, network Network) string {
 
 	//获得公钥哈希
-	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
+	pubKeyHash := GetPubKeyHashFromPublicKey(pubKey)
 
 	//拼接version和公钥哈希，得到21字节的数据
-	payload := append([]byte{byte(0x00)}, pubKeyHash...)
+	payload := append([]byte{byte(network)}, pubKeyHash...)
 
 	//生成4个字节的校验码
 	checksum := CheckSum(payload)
@@ -60,6 +213,15 @@ func (w *Wallet) getAddress() string {
 	return address
 }
 
+//IsAddressOfPublicKey 判断地址是否由公钥生成（地址有效且公钥哈希一致，网络不限）
+func IsAddressOfPublicKey(address string, pubKey []byte) bool {
+	deInfo, err := decodeAddress(address)
+	if err != nil {
+		return false
+	}
+	return PublicKeyToAddress(pubKey, Network(deInfo[0])) == address
+}
+
 //GetPubKeyHashFromPublicKey 通过公钥计算公钥哈希
 func GetPubKeyHashFromPublicKey(publickey []byte) []byte {
 
@@ -74,21 +236,54 @@ func GetPubKeyHashFromPublicKey(publickey []byte) []byte {
 	return pubKeyHash
 }
 
-//GetPubKeyHashFromAddress 通过地址获取公钥哈希
-func GetPubKeyHashFromAddress(address string) []byte {
+//GetPubKeyHashFromAddress 通过地址获取公钥哈希（地址必须属于指定网络）
+func GetPubKeyHashFromAddress(address string, network Network) ([]byte, error) {
 
-	//base58解码
-	deInfo := base58.Decode(address)
+	//严格解码并校验
+	deInfo, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(deInfo) != 25 {
-		fmt.Println("地址无效")
-		return nil
+	//校验版本号
+	if Network(deInfo[0]) != network {
+		return nil, errors.New("地址不属于当前网络")
 	}
 
 	//截取
 	pubKeyHash := deInfo[1 : len(deInfo)-4]
 
-	return pubKeyHash
+	return pubKeyHash, nil
+}
+
+//base58字母表（不含容易混淆的0、O、I、l）
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	//ErrInvalidCharacter 地址包含base58字母表以外的字符
+	ErrInvalidCharacter = errors.New("地址包含无效字符")
+	//ErrBadLength 地址解码后不是25字节（包括前导1的个数不规范）
+	ErrBadLength = errors.New("地址长度无效")
+	//ErrBadChecksum 地址校验码错误
+	ErrBadChecksum = errors.New("地址校验码错误")
+)
+
+//严格解码地址：字符必须都在base58字母表中，解码后为25字节且校验码正确，返回解码后的25字节数据
+func decodeAddress(address string) ([]byte, error) {
+	for _, c := range address {
+		if !strings.ContainsRune(base58Alphabet, c) {
+			return nil, ErrInvalidCharacter
+		}
+	}
+	deInfo := base58.Decode(address)
+	//编码唯一：重新编码必须得到原地址（多余的前导1会使长度不为25）
+	if len(deInfo) != 25 || base58.Encode(deInfo) != address {
+		return nil, ErrBadLength
+	}
+	if !bytes.Equal(deInfo[21:], CheckSum(deInfo[:21])) {
+		return nil, ErrBadChecksum
+	}
+	return deInfo, nil
 }
 
 //CheckSum 获取4字节的校验码
@@ -102,19 +297,10 @@ func CheckSum(payload []byte) []byte {
 
 //IsValidAddress 地址校验：判断地址是否有效
 func IsValidAddress(address string) bool {
-	//解码，得到25字节数据
-	deInfo := base58.Decode(address)
-	if len(deInfo) != 25 {
-		fmt.Println("地址校验失败")
+	_, err := decodeAddress(address)
+	if err != nil {
+		logger.Warn("地址校验失败:", err)
 		return false
 	}
-	//截取前21字节的payload
-	payload := deInfo[:len(deInfo)-4]
-	//截取后4字节的checksum1
-	checksum1 := deInfo[len(deInfo)-4:]
-
-	//计算payload, 获得checksum2
-	checksum2 := CheckSum(payload)
-	//对比checksum1和checksum2
-	return bytes.Equal(checksum1, checksum2)
+	return true
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+//测试向量：公钥哈希及其在主网和测试网的地址
+var addressVectors = []struct {
+	pubKey     string //公钥（X||Y），为空时直接使用公钥哈希
+	pubKeyHash string
+	mainnet    string
+	testnet    string
+}{
+	{
+		pubKeyHash: "0000000000000000000000000000000000000000",
+		mainnet:    "1111111111111111111114oLvT2",
+		testnet:    "mfWxJ45yp2SFn7UciZyNpvDKrzbhyfKrY8",
+	},
+	{
+		pubKey: "60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6" +
+			"7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299",
+		pubKeyHash: "13731d03bdc148c8d7aa231ca9355397546b2b70",
+		mainnet:    "12mqjrsBKVPLddcfpahHwA1zQ8zaqDY4sL",
+		testnet:    "mhHo2uxA8WpbQk6HY9ffm5EKG8bHki5CK5",
+	},
+}
+
+func TestAddressVersionBytes(t *testing.T) {
+	for _, v := range addressVectors {
+		pubKeyHash, _ := hex.DecodeString(v.pubKeyHash)
+		if v.pubKey != "" {
+			pubKey, _ := hex.DecodeString(v.pubKey)
+			if got := GetPubKeyHashFromPublicKey(pubKey); !bytes.Equal(got, pubKeyHash) {
+				t.Fatalf("公钥哈希为%x，期望%s", got, v.pubKeyHash)
+			}
+			w := &Wallet{PublicKey: pubKey}
+			if got := w.getAddress(Mainnet); got != v.mainnet {
+				t.Errorf("主网地址为%s，期望%s", got, v.mainnet)
+			}
+			if got := w.getAddress(Testnet); got != v.testnet {
+				t.Errorf("测试网地址为%s，期望%s", got, v.testnet)
+			}
+		}
+
+		for _, c := range []struct {
+			address string
+			network Network
+		}{{v.mainnet, Mainnet}, {v.testnet, Testnet}} {
+			got, err := GetPubKeyHashFromAddress(c.address, c.network)
+			if err != nil {
+				t.Fatalf("解码%s失败: %v", c.address, err)
+			}
+			if !bytes.Equal(got, pubKeyHash) {
+				t.Errorf("%s的公钥哈希为%x，期望%s", c.address, got, v.pubKeyHash)
+			}
+		}
+	}
+}
+
+func TestAddressCrossNetworkRejected(t *testing.T) {
+	for _, v := range addressVectors {
+		if _, err := GetPubKeyHashFromAddress(v.mainnet, Testnet); err == nil {
+			t.Errorf("主网地址%s不应被测试网接受", v.mainnet)
+		}
+		if _, err := GetPubKeyHashFromAddress(v.testnet, Mainnet); err == nil {
+			t.Errorf("测试网地址%s不应被主网接受", v.testnet)
+		}
+	}
+}
+
+func TestPublicKeyToAddress(t *testing.T) {
+	for _, v := range addressVectors {
+		if v.pubKey == "" {
+			continue
+		}
+		pubKey, _ := hex.DecodeString(v.pubKey)
+		if got := PublicKeyToAddress(pubKey, Mainnet); got != v.mainnet {
+			t.Errorf("主网地址为%s，期望%s", got, v.mainnet)
+		}
+		if got := PublicKeyToAddress(pubKey, Testnet); got != v.testnet {
+			t.Errorf("测试网地址为%s，期望%s", got, v.testnet)
+		}
+		for _, address := range []string{v.mainnet, v.testnet} {
+			if !IsAddressOfPublicKey(address, pubKey) {
+				t.Errorf("%s应由公钥%s生成", address, v.pubKey)
+			}
+		}
+
+		//其他公钥和无效地址
+		other := append([]byte{}, pubKey...)
+		other[0] ^= 0xff
+		if IsAddressOfPublicKey(v.mainnet, other) {
+			t.Errorf("%s不应由其他公钥生成", v.mainnet)
+		}
+		if IsAddressOfPublicKey(v.mainnet[:len(v.mainnet)-1]+"1", pubKey) {
+			t.Error("校验码错误的地址不应通过校验")
+		}
+	}
+}
+
+func TestAddressStrictDecoding(t *testing.T) {
+	valid := addressVectors[1].mainnet
+	//替换第3个字符
+	replace := func(c string) string { return valid[:2] + c + valid[3:] }
+
+	cases := []struct {
+		address string
+		err     error
+	}{
+		{replace("0"), ErrInvalidCharacter},
+		{replace("O"), ErrInvalidCharacter},
+		{replace("I"), ErrInvalidCharacter},
+		{replace("l"), ErrInvalidCharacter},
+		{valid + " ", ErrInvalidCharacter},
+		{"1" + valid, ErrBadLength},
+		{valid[:len(valid)-1], ErrBadLength},
+		{valid + "1", ErrBadLength},
+		{"", ErrBadLength},
+		{replace("3"), ErrBadChecksum},
+		{valid[:len(valid)-1] + "M", ErrBadChecksum},
+	}
+	for _, c := range cases {
+		if _, err := GetPubKeyHashFromAddress(c.address, Mainnet); err != c.err {
+			t.Errorf("%q: 错误为%v，期望%v", c.address, err, c.err)
+		}
+		if IsValidAddress(c.address) {
+			t.Errorf("%q不应为有效地址", c.address)
+		}
+	}
+	if _, err := GetPubKeyHashFromAddress(valid, Mainnet); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//WIF测试向量：私钥及其压缩格式的WIF
+var wifVectors = []struct {
+	key     string
+	network Network
+	wif     string
+}{
+	{"0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d", Mainnet, "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"},
+	{"0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d", Testnet, "cMzLdeGd5vEqxB8B6VFQoRopQ3sLAAvEzDAoQgvX54xwofSWj1fx"},
+	//私钥不足32字节时补0
+	{"0000000000000000000000000000000000000000000000000000000000000001", Mainnet, "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn"},
+}
+
+func TestWIFVectors(t *testing.T) {
+	defer func(network Network) { activeNetwork = network }(activeNetwork)
+	for _, v := range wifVectors {
+		activeNetwork = v.network
+		w := newWallet(testPrivateKey(t, v.key))
+		wif, err := w.ExportWIF()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wif != v.wif {
+			t.Errorf("WIF为%s，期望%s", wif, v.wif)
+		}
+
+		imported, err := ImportWIF(v.wif)
+		if err != nil {
+			t.Fatalf("导入%s失败: %v", v.wif, err)
+		}
+		if imported.PrivateKey.D.Cmp(w.PrivateKey.D) != 0 {
+			t.Errorf("导入的私钥为%x，期望%s", imported.PrivateKey.D, v.key)
+		}
+		if !bytes.Equal(imported.PublicKey, w.PublicKey) {
+			t.Errorf("导入的公钥为%x，期望%x", imported.PublicKey, w.PublicKey)
+		}
+	}
+
+	//未压缩格式同样可以导入
+	activeNetwork = Mainnet
+	imported, err := ImportWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(imported.PrivateKey.D.Bytes()); got != wifVectors[0].key {
+		t.Errorf("导入的私钥为%s，期望%s", got, wifVectors[0].key)
+	}
+}
+
+func TestImportWIFRejected(t *testing.T) {
+	defer func(network Network) { activeNetwork = network }(activeNetwork)
+	activeNetwork = Mainnet
+	for _, wif := range []string{
+		"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98618", //校验码错误
+		"cMzLdeGd5vEqxB8B6VFQoRopQ3sLAAvEzDAoQgvX54xwofSWj1fx", //测试网私钥
+		"KwdMAjGmerYanjeui5SHS7Jkmp",                           //长度错误
+	} {
+		if _, err := ImportWIF(wif); err == nil {
+			t.Errorf("%s应被拒绝", wif)
+		}
+	}
+}
+
+//公钥的X或Y不足32字节时补0，公钥总是64字节，签名可以通过校验
+func TestWalletPublicKeyPadded(t *testing.T) {
+	for _, key := range []string{
+		"000000000000000000000000000000000000000000000000000000000000017b", //d=379，X为31字节
+		"000000000000000000000000000000000000000000000000000000000000002b", //d=43，Y为31字节
+	} {
+		priKey := testPrivateKey(t, key)
+		w := newWallet(priKey)
+		if len(w.PublicKey) != 64 {
+			t.Fatalf("%s: 公钥为%d字节，期望64字节", key, len(w.PublicKey))
+		}
+		pub := parseECDSAPublicKey(w.PublicKey)
+		if pub.X.Cmp(priKey.X) != 0 || pub.Y.Cmp(priKey.Y) != 0 {
+			t.Fatalf("%s: 公钥解析结果与私钥不符", key)
+		}
+
+		tx, prevTXs := newFixedTestTX(priKey)
+		if !bytes.Equal(tx.TXInputs[0].PubKey, w.PublicKey) {
+			t.Fatalf("%s: 交易输入的公钥与钱包公钥不同", key)
+		}
+		if !tx.Sign(priKey, prevTXs, SigHashAll) {
+			t.Fatalf("%s: 交易签名失败", key)
+		}
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("%s: 签名校验失败", key)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+/*
+	钱包文件格式：
+		魔数"HBWL"(4字节) | 版本号(1字节) | 钱包数据
+	版本2的钱包数据（按地址排序，相同的钱包总是得到相同的文件）：
+		钱包个数 | 每个钱包的私钥(32字节) | 只读地址个数 | 每个只读地址
+	版本3在版本2的基础上，文件末尾附加4字节校验码（覆盖文件头和钱包数据），用于检测不完整的文件。
+	版本4在每个钱包的私钥前增加1字节签名算法标识（ECDSA-P256或Ed25519）。
+	版本5在只读地址之后增加交易标签：标签个数 | 每个标签的(交易ID, 标签内容)，按交易ID排序。
+	版本1为没有文件头的gob编码，需要先执行迁移升级到当前版本。
+	文件通过临时文件+重命名原子写入。
+*/
+
+//钱包文件魔数
+const walletMagic = "HBWL"
+
+//当前钱包文件版本
+const walletVersion = 5
+
+//ErrWalletMigrationRequired 钱包文件为旧版本
+var ErrWalletMigrationRequired = errors.New("钱包文件为旧版本，请执行 migratewallet 命令升级")
+
+//钱包文件迁移：将指定版本的钱包数据升级到下一个版本
+var walletMigrations = map[byte]func(data []byte) ([]byte, error){
+	1: migrateWalletV1,
+	2: migrateWalletV2,
+	3: migrateWalletV3,
+	4: migrateWalletV4,
+}
+
+//SaveWallets 将钱包保存到文件（当前版本格式）
+func (wm *WalletManager) SaveWallets(path string) error {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	return wm.saveWallets(path)
+}
+
+//保存钱包到文件（调用者需持有锁）
+func (wm *WalletManager) saveWallets(path string) error {
+	body, err := wm.encodeWallets()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, walletFileContent(walletVersion, body), 0600)
+}
+
+//LoadWallets 从文件加载钱包，文件版本不是当前版本时返回错误
+func (wm *WalletManager) LoadWallets(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	version, body, err := parseWalletFile(content)
+	if err != nil {
+		return err
+	}
+	if version != walletVersion {
+		return ErrWalletMigrationRequired
+	}
+	return wm.decodeWallets(body)
+}
+
+//MigrateWallets 将旧版本的钱包文件逐版本升级到当前版本
+func MigrateWallets(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	version, body, err := parseWalletFile(content)
+	if err != nil {
+		return err
+	}
+	for version < walletVersion {
+		migrate, ok := walletMigrations[version]
+		if !ok {
+			return fmt.Errorf("不支持从版本%d升级钱包文件", version)
+		}
+		body, err = migrate(body)
+		if err != nil {
+			return err
+		}
+		version++
+	}
+	return writeFileAtomic(path, walletFileContent(version, body), 0600)
+}
+
+//拼接文件头和钱包数据（版本3起附加校验码）
+func walletFileContent(version byte, body []byte) []byte {
+	content := append([]byte(walletMagic), version)
+	content = append(content, body...)
+	if version >= 3 {
+		content = appendChecksum(content)
+	}
+	return content
+}
+
+//解析钱包文件：没有魔数的文件为版本1
+func parseWalletFile(content []byte) (byte, []byte, error) {
+	if !bytes.HasPrefix(content, []byte(walletMagic)) {
+		return 1, content, nil
+	}
+	if len(content) < len(walletMagic)+1 {
+		return 0, nil, errors.New("钱包文件不完整")
+	}
+	version := content[len(walletMagic)]
+	if version == 0 || version > walletVersion {
+		return 0, nil, fmt.Errorf("钱包文件版本不支持: %d", version)
+	}
+	if version >= 3 {
+		var err error
+		content, err = stripChecksum(content)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	return version, content[len(walletMagic)+1:], nil
+}
+
+//编码钱包数据（当前版本）
+func (wm *WalletManager) encodeWallets() ([]byte, error) {
+	return wm.encodeWalletsVersion(walletVersion)
+}
+
+//编码指定版本（版本2起）的钱包数据
+func (wm *WalletManager) encodeWalletsVersion(version byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	addresses := wm.addresses()
+	writeUvarint(&buffer, uint64(len(addresses)))
+	for _, address := range addresses {
+		w := wm.Wallets[address]
+		key, err := w.privateKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+		if version >= 4 {
+			buffer.WriteByte(byte(w.Scheme))
+		}
+		buffer.Write(key)
+	}
+
+	watched := wm.watchAddresses()
+	writeUvarint(&buffer, uint64(len(watched)))
+	for _, address := range watched {
+		writeBytes(&buffer, []byte(address))
+	}
+
+	if version >= 5 {
+		var txids []string
+		for txid := range wm.Labels {
+			txids = append(txids, txid)
+		}
+		sort.Strings(txids)
+		writeUvarint(&buffer, uint64(len(txids)))
+		for _, txid := range txids {
+			writeBytes(&buffer, []byte(txid))
+			writeBytes(&buffer, []byte(wm.Labels[txid]))
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+//解码钱包数据（当前版本）
+func (wm *WalletManager) decodeWallets(body []byte) error {
+	reader := bytes.NewReader(body)
+	wallets := make(map[string]*Wallet)
+	watched := make(map[string]*WatchWallet)
+	labels := make(map[string]string)
+
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		scheme, err := reader.ReadByte()
+		if err != nil {
+			return errors.New("钱包文件不完整")
+		}
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return errors.New("钱包文件不完整")
+		}
+		w, err := walletFromSchemeKey(SchemeID(scheme), key)
+		if err != nil {
+			return err
+		}
+		wallets[w.getAddress(activeNetwork)] = w
+	}
+
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		address, err := readBytes(reader)
+		if err != nil {
+			return err
+		}
+		pubKeyHash, err := GetPubKeyHashFromAddress(string(address), activeNetwork)
+		if err != nil {
+			return err
+		}
+		watched[string(address)] = &WatchWallet{string(address), pubKeyHash}
+	}
+
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		txid, err := readBytes(reader)
+		if err != nil {
+			return err
+		}
+		label, err := readBytes(reader)
+		if err != nil {
+			return err
+		}
+		labels[string(txid)] = string(label)
+	}
+	if reader.Len() != 0 {
+		return errors.New("钱包文件包含多余的数据")
+	}
+
+	wm.Wallets = wallets
+	wm.Watched = watched
+	wm.Labels = labels
+	return nil
+}
+
+//版本1 -> 版本2：gob编码的WalletManager转换为版本2的钱包数据
+func migrateWalletV1(data []byte) ([]byte, error) {
+	wm := WalletManager{
+		Wallets: make(map[string]*Wallet),
+		Watched: make(map[string]*WatchWallet),
+	}
+	//注册椭圆曲线的接口函数后才能进行解码
+	gob.Register(elliptic.P256())
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&wm)
+	if err != nil {
+		return nil, errors.New("旧版本钱包文件解析失败: " + err.Error())
+	}
+	if wm.Watched == nil {
+		wm.Watched = make(map[string]*WatchWallet)
+	}
+
+	//公钥根据私钥重新计算
+	for address, w := range wm.Wallets {
+		key, err := w.privateKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+		w, err = walletFromKeyBytes(key)
+		if err != nil {
+			return nil, err
+		}
+		wm.Wallets[address] = w
+	}
+	return wm.encodeWalletsVersion(2)
+}
+
+//版本2 -> 版本3：钱包数据不变，写入时附加校验码
+func migrateWalletV2(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+//版本3 -> 版本4：每个钱包的私钥前增加签名算法标识（旧版本只有ECDSA-P256钱包）
+func migrateWalletV3(data []byte) ([]byte, error) {
+	reader := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writeUvarint(&buffer, count)
+	for i := uint64(0); i < count; i++ {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return nil, errors.New("钱包文件不完整")
+		}
+		buffer.WriteByte(byte(SchemeECDSAP256))
+		buffer.Write(key)
+	}
+	//只读地址部分不变
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(rest)
+	return buffer.Bytes(), nil
+}
+
+//版本4 -> 版本5：在只读地址之后增加交易标签（旧版本没有标签）
+func migrateWalletV4(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(data)
+	writeUvarint(&buffer, 0)
+	return buffer.Bytes(), nil
+}
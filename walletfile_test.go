@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//创建临时目录，返回的函数删除临时目录
+func newTestWalletDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hibtc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestWalletFileRoundTrip(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	wm := &WalletManager{Wallets: map[string]*Wallet{}, Watched: map[string]*WatchWallet{}}
+	for i := 0; i < 3; i++ {
+		w := newTestWallet(t)
+		wm.Wallets[w.getAddress(activeNetwork)] = w
+	}
+	watch := newTestWallet(t).getAddress(activeNetwork)
+	pubKeyHash, err := GetPubKeyHashFromAddress(watch, activeNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm.Watched[watch] = &WatchWallet{watch, pubKeyHash}
+
+	first := filepath.Join(dir, "first.dat")
+	if err := wm.SaveWallets(first); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &WalletManager{}
+	if err := loaded.LoadWallets(first); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Wallets) != 3 || len(loaded.Watched) != 1 || loaded.Watched[watch] == nil {
+		t.Fatalf("加载后有%d个钱包和%d个只读地址", len(loaded.Wallets), len(loaded.Watched))
+	}
+	for address, w := range wm.Wallets {
+		if got := loaded.Wallets[address]; got == nil || !bytes.Equal(got.PublicKey, w.PublicKey) {
+			t.Fatalf("钱包%s加载后不一致", address)
+		}
+	}
+
+	//相同的钱包总是得到相同的文件
+	second := filepath.Join(dir, "second.dat")
+	if err := loaded.SaveWallets(second); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ioutil.ReadFile(first)
+	b, _ := ioutil.ReadFile(second)
+	if !bytes.Equal(a, b) {
+		t.Fatal("重新保存的钱包文件内容不同")
+	}
+}
+
+func TestWalletFileMigrateV1(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	//版本1为没有文件头的gob编码
+	watch := newTestWallet(t).getAddress(activeNetwork)
+	pubKeyHash, err := GetPubKeyHashFromAddress(watch, activeNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := WalletManager{
+		Wallets: map[string]*Wallet{},
+		Watched: map[string]*WatchWallet{watch: {watch, pubKeyHash}},
+	}
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&old); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "wallet.dat")
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &WalletManager{}
+	if err := wm.LoadWallets(path); err != ErrWalletMigrationRequired {
+		t.Fatalf("加载旧版本钱包返回%v，期望需要迁移", err)
+	}
+	if err := MigrateWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := wm.LoadWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	if wm.Watched[watch] == nil || !bytes.Equal(wm.Watched[watch].PubKeyHash, pubKeyHash) {
+		t.Fatal("迁移后只读地址丢失")
+	}
+}
+
+func TestWalletFileRejected(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	w := newTestWallet(t)
+	wm := &WalletManager{Wallets: map[string]*Wallet{w.getAddress(activeNetwork): w}}
+	valid := filepath.Join(dir, "valid.dat")
+	if err := wm.SaveWallets(valid); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(valid)
+
+	cases := map[string][]byte{
+		"未知版本": walletFileContent(walletVersion+1, nil),
+		"只有魔数": []byte(walletMagic),
+		"数据截断": content[:len(content)-10],
+		"多余数据": append(append([]byte{}, content...), 0),
+	}
+	for name, data := range cases {
+		path := filepath.Join(dir, "bad.dat")
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&WalletManager{}).LoadWallets(path); err == nil || err == ErrWalletMigrationRequired {
+			t.Errorf("%s: 加载返回%v，期望格式错误", name, err)
+		}
+	}
+
+	//无法解析的旧版本文件在迁移时报错
+	corrupt := filepath.Join(dir, "corrupt.dat")
+	if err := ioutil.WriteFile(corrupt, []byte("not a wallet"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateWallets(corrupt); err == nil {
+		t.Fatal("损坏的钱包文件迁移成功")
+	}
+}
+
+//模拟写入过程中崩溃：截断的钱包文件加载失败，不会得到损坏的钱包
+func TestWalletFileTruncated(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	w := newTestWallet(t)
+	wm := &WalletManager{Wallets: map[string]*Wallet{w.getAddress(activeNetwork): w}}
+	path := filepath.Join(dir, "wallet.dat")
+	if err := wm.SaveWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	for _, size := range []int{len(content) - 1, len(content) - 4, len(walletMagic) + 3} {
+		if err := ioutil.WriteFile(path, content[:size], 0600); err != nil {
+			t.Fatal(err)
+		}
+		loaded := &WalletManager{}
+		if err := loaded.LoadWallets(path); err == nil {
+			t.Fatalf("截断为%d字节的钱包文件加载成功", size)
+		}
+		if loaded.Wallets != nil {
+			t.Fatal("加载失败时不应修改钱包")
+		}
+	}
+
+	//原子写入不留下临时文件
+	if err := wm.SaveWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("目录中有%d个文件，期望1个", len(files))
+	}
+}
+
+func TestWalletFileMigrateV2(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	w := newTestWallet(t)
+	wm := &WalletManager{Wallets: map[string]*Wallet{w.getAddress(activeNetwork): w}}
+	body, err := wm.encodeWalletsVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//版本2没有校验码
+	path := filepath.Join(dir, "wallet.dat")
+	if err := ioutil.WriteFile(path, walletFileContent(2, body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&WalletManager{}).LoadWallets(path); err != ErrWalletMigrationRequired {
+		t.Fatalf("加载版本2钱包返回%v，期望需要迁移", err)
+	}
+	if err := MigrateWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &WalletManager{}
+	if err := loaded.LoadWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Wallets[w.getAddress(activeNetwork)] == nil {
+		t.Fatal("迁移后钱包丢失")
+	}
+}
+
+func TestWalletFileMigrateV4(t *testing.T) {
+	dir, cleanup := newTestWalletDir(t)
+	defer cleanup()
+
+	w := newTestWallet(t)
+	wm := &WalletManager{Wallets: map[string]*Wallet{w.getAddress(activeNetwork): w}}
+	body, err := wm.encodeWalletsVersion(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "wallet.dat")
+	if err := ioutil.WriteFile(path, walletFileContent(4, body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&WalletManager{}).LoadWallets(path); err != ErrWalletMigrationRequired {
+		t.Fatalf("加载版本4钱包返回%v，期望需要迁移", err)
+	}
+	if err := MigrateWallets(path); err != nil {
+		t.Fatal(err)
+	}
+
+	//版本4没有交易标签
+	loaded := &WalletManager{}
+	if err := loaded.LoadWallets(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Wallets[w.getAddress(activeNetwork)] == nil || len(loaded.Labels) != 0 {
+		t.Fatalf("迁移后有%d个钱包和%d个标签", len(loaded.Wallets), len(loaded.Labels))
+	}
+}
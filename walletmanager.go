@@ -2,19 +2,31 @@ package main
 
 import (
 	"bytes"
-	"crypto/elliptic"
-	"encoding/gob"
+	"crypto"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"sort"
+	"sync"
 )
 
 //WalletManager 钱包管理：对外管理生成的钱包（公钥,私钥）
 //私钥 -> 公钥 -> 地址
 type WalletManager struct {
-	Wallets map[string]*Wallet //管理所有钱包的map(key为地址,value为钱包)
+	Wallets map[string]*Wallet      //管理所有钱包的map(key为地址,value为钱包)
+	Watched map[string]*WatchWallet //只读钱包(key为地址)
+	Labels  map[string]string       //交易标签(key为交易ID)：只保存在钱包文件中，不上链
+	mux     sync.RWMutex            //保护Wallets、Watched和Labels
 }
 
+//WatchWallet 只读钱包：只保存地址和公钥哈希，可以查询金额但不能签名
+type WatchWallet struct {
+	Address    string //地址
+	PubKeyHash []byte //公钥哈希
+}
+
+//ErrWatchOnly 只读钱包不能签名
+var ErrWatchOnly = errors.New("只读钱包（watch-only），无法签名")
+
 //NewWalletManager 创建WalletManager
 func NewWalletManager() *WalletManager {
 	//创建一个钱包管理
@@ -22,6 +34,8 @@ func NewWalletManager() *WalletManager {
 
 	//创建钱包map
 	wm.Wallets = make(map[string]*Wallet)
+	wm.Watched = make(map[string]*WatchWallet)
+	wm.Labels = make(map[string]string)
 
 	//从磁盘加载已创建的钱包到map
 	if !wm.loadFile() {
@@ -32,56 +46,163 @@ func NewWalletManager() *WalletManager {
 	return &wm
 }
 
-func (wm *WalletManager) createWallet() string {
+//CreateWallet 创建新钱包（ECDSA-P256密钥对）并保存到钱包文件，返回钱包地址
+func (wm *WalletManager) CreateWallet() (address string, err error) {
+	return wm.createWalletWithScheme(SchemeECDSAP256)
+}
+
+//创建使用指定签名算法的钱包并保存到钱包文件，返回地址
+func (wm *WalletManager) createWalletWithScheme(scheme SchemeID) (string, error) {
 	//创密钥对
-	w := NewWalletKeyPair()
+	var w *Wallet
+	switch scheme {
+	case SchemeECDSAP256:
+		w = NewWalletKeyPair()
+	case SchemeEd25519:
+		w = NewEd25519WalletKeyPair()
+	}
 	if w == nil {
-		fmt.Println("钱包密钥对创建失败")
-		return ""
+		return "", errors.New("钱包密钥对创建失败")
 	}
 
 	//获取地址
-	address := w.getAddress()
+	address := w.getAddress(activeNetwork)
 
 	//将钱包写入到map，key为钱包地址
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
 	wm.Wallets[address] = w
 
-	//将密钥对写入磁盘
-	if !wm.saveFile() {
-		return ""
+	//将密钥对写入磁盘，失败时不保留新钱包
+	if err := wm.saveWallets(walletFile); err != nil {
+		delete(wm.Wallets, address)
+		return "", err
 	}
 
 	//返回地址
-	return address
-
+	return address, nil
 }
 
-//钱包文件
-const walletFile = "wallet.dat"
+//NewChangeAddress 创建新的找零地址：新地址保存在钱包中，找零金额可以继续花费
+func (wm *WalletManager) NewChangeAddress() (string, error) {
+	address, err := wm.CreateWallet()
+	if err != nil {
+		return "", errors.New("创建找零地址失败: " + err.Error())
+	}
+	return address, nil
+}
 
-//保存WalletManager到磁盘
-func (wm *WalletManager) saveFile() bool {
-	//使用gob对wm进行编码
-	var buffer bytes.Buffer
+//ImportKey 导入WIF格式的私钥，返回对应的地址
+func (wm *WalletManager) ImportKey(wif string) (address string, err error) {
+	w, err := ImportWIF(wif)
+	if err != nil {
+		return "", err
+	}
 
-	//注册椭圆曲线的接口函数后才能进行编码
-	gob.Register(elliptic.P256())
+	//将钱包写入到map并保存（已导入的只读地址升级为完整钱包）
+	address = w.getAddress(activeNetwork)
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+	wm.Wallets[address] = w
+	delete(wm.Watched, address)
+	if !wm.saveFile() {
+		return "", errors.New("保存钱包失败")
+	}
+	return address, nil
+}
 
-	//编码
-	encoder := gob.NewEncoder(&buffer)
-	err := encoder.Encode(wm)
+//ImportAddress 导入只读地址：可以查询金额，但不能花费
+func (wm *WalletManager) ImportAddress(address string) error {
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
+	}
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+	if _, ok := wm.Wallets[address]; ok {
+		return errors.New("地址对应的私钥已存在")
+	}
+
+	wm.Watched[address] = &WatchWallet{address, pubKeyHash}
+	if !wm.saveFile() {
+		return errors.New("保存钱包失败")
+	}
+	return nil
+}
+
+//SigningWallet 获取地址对应的可签名钱包，只读地址返回ErrWatchOnly
+func (wm *WalletManager) SigningWallet(address string) (*Wallet, error) {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	if wallet, ok := wm.Wallets[address]; ok {
+		return wallet, nil
+	}
+	if _, ok := wm.Watched[address]; ok {
+		return nil, ErrWatchOnly
+	}
+	return nil, errors.New("未找到地址对应的私钥")
+}
+
+//PrivateKeyFor 实现KeyStore：找到公钥哈希对应的可签名钱包的私钥
+func (wm *WalletManager) PrivateKeyFor(pubKeyHash []byte) (crypto.PrivateKey, error) {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	for _, wallet := range wm.Wallets {
+		if bytes.Equal(GetPubKeyHashFromPublicKey(wallet.PublicKey), pubKeyHash) {
+			return wallet.signingKey(), nil
+		}
+	}
+	return nil, fmt.Errorf("钱包中没有公钥哈希%x对应的私钥", pubKeyHash)
+}
+
+//LabelTransaction 为交易设置标签（如"房租"）并保存到钱包文件，label为空时删除标签
+//标签只保存在本地钱包中，不影响交易本身
+func (wm *WalletManager) LabelTransaction(txid []byte, label string) error {
+	if len(txid) == 0 {
+		return errors.New("交易ID为空")
+	}
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+	if wm.Labels == nil {
+		wm.Labels = make(map[string]string)
 	}
 
-	//将WalletManager写入文件
-	err = ioutil.WriteFile(walletFile, buffer.Bytes(), 0600)
+	old, ok := wm.Labels[string(txid)]
+	if label == "" {
+		delete(wm.Labels, string(txid))
+	} else {
+		wm.Labels[string(txid)] = label
+	}
+	//保存失败时恢复原来的标签
+	if !wm.saveFile() {
+		if ok {
+			wm.Labels[string(txid)] = old
+		} else {
+			delete(wm.Labels, string(txid))
+		}
+		return errors.New("保存钱包失败")
+	}
+	return nil
+}
+
+//TransactionLabel 获取交易的标签，没有标签时返回空字符串
+func (wm *WalletManager) TransactionLabel(txid []byte) string {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	return wm.Labels[string(txid)]
+}
+
+//钱包文件
+const walletFile = "wallet.dat"
+
+//保存WalletManager到磁盘
+//调用者需持有锁
+func (wm *WalletManager) saveFile() bool {
+	err := wm.saveWallets(walletFile)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return false
 	}
-
 	return true
 }
 
@@ -90,33 +211,27 @@ func (wm *WalletManager) loadFile() bool {
 
 	//判断文件是否存在
 	if !IsFileExist(walletFile) {
-		fmt.Println("钱包文件不存在")
+		logger.Warn("钱包文件不存在")
 		return true
 	}
-	//读取文件
-	content, err := ioutil.ReadFile(walletFile)
-	if err != nil {
-		fmt.Println(err)
-		return false
-	}
-	//创建解码器
-	decoder := gob.NewDecoder(bytes.NewReader(content))
 
-	//注册椭圆曲线的接口函数后才能进行解码
-	gob.Register(elliptic.P256())
-
-	//解码并赋值到wm
-	err = decoder.Decode(wm)
+	err := wm.LoadWallets(walletFile)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error(err)
 		return false
 	}
-
 	return true
 }
 
-//获取所有钱包地址
-func (wm *WalletManager) listAddresses() []string {
+//Addresses 获取所有钱包地址（按字符串排序）
+func (wm *WalletManager) Addresses() []string {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	return wm.addresses()
+}
+
+//获取所有钱包地址并排序（调用者需持有锁）
+func (wm *WalletManager) addresses() []string {
 	var addresses []string
 	for address := range wm.Wallets {
 		addresses = append(addresses, address)
@@ -127,3 +242,44 @@ func (wm *WalletManager) listAddresses() []string {
 
 	return addresses
 }
+
+//WatchAddresses 获取所有只读地址（按字符串排序）
+func (wm *WalletManager) WatchAddresses() []string {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	return wm.watchAddresses()
+}
+
+//获取所有只读地址并排序（调用者需持有锁）
+func (wm *WalletManager) watchAddresses() []string {
+	var addresses []string
+	for address := range wm.Watched {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+//FindAllUTXO 获取所有钱包地址（包括只读地址）的utxo
+func (wm *WalletManager) FindAllUTXO(bc *BlockChain) []UTXOInfo {
+	wm.mux.RLock()
+	defer wm.mux.RUnlock()
+	var utxoInfos []UTXOInfo
+	for _, wallet := range wm.Wallets {
+		pubKeyHash := GetPubKeyHashFromPublicKey(wallet.PublicKey)
+		utxoInfos = append(utxoInfos, bc.FindUTXO(pubKeyHash)...)
+	}
+	for _, watch := range wm.Watched {
+		utxoInfos = append(utxoInfos, bc.FindUTXO(watch.PubKeyHash)...)
+	}
+	return utxoInfos
+}
+
+//TotalBalance 获取所有钱包地址（包括只读地址）的金额总和
+func (wm *WalletManager) TotalBalance(bc *BlockChain) int64 {
+	var total int64
+	for _, utxoInfo := range wm.FindAllUTXO(bc) {
+		total += utxoInfo.Value
+	}
+	return total
+}
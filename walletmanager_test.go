@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestWalletManagerAddressesAndTotalBalance(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	other := newTestWallet(t).getAddress(activeNetwork)
+
+	wm := &WalletManager{Wallets: map[string]*Wallet{}}
+	for _, wallet := range []*Wallet{w, newTestWallet(t), newTestWallet(t)} {
+		wm.Wallets[wallet.getAddress(activeNetwork)] = wallet
+	}
+
+	addresses := wm.Addresses()
+	if len(addresses) != 3 || !sort.StringsAreSorted(addresses) {
+		t.Fatalf("地址列表%v应有3个地址并按顺序排列", addresses)
+	}
+	for i := 0; i < 5; i++ {
+		again := wm.Addresses()
+		for j := range addresses {
+			if again[j] != addresses[j] {
+				t.Fatalf("地址列表顺序不稳定: %v, %v", addresses, again)
+			}
+		}
+	}
+
+	//w持有创世块奖励，其他两个钱包各挖到一个区块，other的奖励不计入
+	for _, address := range addresses {
+		if address != w.getAddress(activeNetwork) {
+			appendTestBlocks(t, bc, 2, address, other)
+		}
+	}
+	if total := wm.TotalBalance(bc); total != 3*initialReward {
+		t.Fatalf("总金额为%d，期望%d", total, 3*initialReward)
+	}
+}
+
+func TestWatchOnlyAddress(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+	cold := newTestWallet(t)
+	coldAddress := cold.getAddress(activeNetwork)
+
+	wm := NewWalletManager()
+	if err := wm.ImportAddress(coldAddress); err != nil {
+		t.Fatal(err)
+	}
+	if err := wm.ImportAddress("not an address"); err == nil {
+		t.Fatal("无效的地址应被拒绝")
+	}
+	if got := wm.TotalBalance(bc); got != 0 {
+		t.Fatalf("只读地址的金额为%d，期望0", got)
+	}
+
+	//只读地址收款后金额增加
+	tx := newTestSpend(t, w, genesisCoinbase(t, bc), 0, coldAddress, 10000)
+	if err := bc.AddBlock([]*Transaction{newTestCoinbase(t, bc, coldAddress, "1"), tx}); err != nil {
+		t.Fatal(err)
+	}
+	want := initialReward - 10000 + initialReward
+	if got := wm.TotalBalance(bc); got != want {
+		t.Fatalf("只读地址的金额为%d，期望%d", got, want)
+	}
+
+	//只读地址保存在钱包文件中
+	loaded := NewWalletManager()
+	if loaded == nil || len(loaded.WatchAddresses()) != 1 || loaded.WatchAddresses()[0] != coldAddress {
+		t.Fatal("重新加载后应包含只读地址")
+	}
+
+	//只读地址不能转账
+	if _, err := loaded.SigningWallet(coldAddress); err != ErrWatchOnly {
+		t.Fatalf("期望ErrWatchOnly，实际为%v", err)
+	}
+	payee := newTestWallet(t).getAddress(activeNetwork)
+	if _, err := NewTransactionFeeRate(coldAddress, payee, SatoshiPerBTC, 10, bc); err != ErrWatchOnly {
+		t.Fatalf("只读地址转账应返回ErrWatchOnly，实际为%v", err)
+	}
+	if tx := NewTransaction(coldAddress, payee, SatoshiPerBTC, bc); tx != nil {
+		t.Fatal("只读地址不能创建交易")
+	}
+}
+
+//并发导入只读地址和查询金额
+func TestWatchOnlyConcurrent(t *testing.T) {
+	bc, w, cleanup := newTestChain(t)
+	defer cleanup()
+
+	wm := NewWalletManager()
+	if err := wm.ImportAddress(w.getAddress(activeNetwork)); err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for i := 0; i < 8; i++ {
+		addresses = append(addresses, newTestWallet(t).getAddress(activeNetwork))
+	}
+
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(2)
+		go func(address string) {
+			defer wg.Done()
+			if err := wm.ImportAddress(address); err != nil {
+				t.Error(err)
+			}
+		}(address)
+		go func() {
+			defer wg.Done()
+			if got := wm.TotalBalance(bc); got != initialReward {
+				t.Errorf("金额为%d，期望%d", got, initialReward)
+			}
+			wm.WatchAddresses()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(wm.WatchAddresses()); got != len(addresses)+1 {
+		t.Fatalf("导入了%d个只读地址，期望%d个", got, len(addresses)+1)
+	}
+}
+
+func TestCreateWallet(t *testing.T) {
+	_, _, cleanup := newTestChain(t)
+	defer cleanup()
+
+	wm := NewWalletManager()
+	before := len(wm.Addresses())
+	address, err := wm.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(wm.Addresses()); got != before+1 {
+		t.Fatalf("创建钱包后有%d个地址，期望%d个", got, before+1)
+	}
+	pubKeyHash, err := GetPubKeyHashFromAddress(address, activeNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := wm.Wallets[address]; w == nil || !bytes.Equal(GetPubKeyHashFromPublicKey(w.PublicKey), pubKeyHash) {
+		t.Fatal("地址与钱包的公钥不对应")
+	}
+
+	//同时创建多个钱包，全部保存到钱包文件
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := wm.NewChangeAddress(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	loaded := NewWalletManager()
+	if loaded == nil || len(loaded.Addresses()) != before+5 || loaded.Wallets[address] == nil {
+		t.Fatal("钱包文件中的钱包与创建的钱包不一致")
+	}
+}
+
+func TestTransactionLabels(t *testing.T) {
+	_, _, cleanup := newTestChain(t)
+	defer cleanup()
+	txid := bytes.Repeat([]byte{0x42}, 32)
+
+	wm := NewWalletManager()
+	if err := wm.LabelTransaction(txid, "房租"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wm.LabelTransaction(nil, "房租"); err == nil {
+		t.Fatal("交易ID为空时应返回错误")
+	}
+	if got := wm.TransactionLabel(txid); got != "房租" {
+		t.Fatalf("标签为%q，期望房租", got)
+	}
+
+	//标签保存在钱包文件中
+	loaded := NewWalletManager()
+	if got := loaded.TransactionLabel(txid); got != "房租" {
+		t.Fatalf("重新加载后标签为%q，期望房租", got)
+	}
+
+	//空标签删除标签
+	if err := loaded.LabelTransaction(txid, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewWalletManager().TransactionLabel(txid); got != "" {
+		t.Fatalf("删除后标签为%q", got)
+	}
+}
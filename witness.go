@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+)
+
+/*
+	见证数据隔离（参考BIP141）：
+		input中的签名和公钥（解锁脚本）称为见证数据，
+		交易ID只对去除见证数据的交易计算，签名的编码变化不会改变交易ID；
+		WTXID对包含见证数据的完整交易计算。
+*/
+
+//TXWitness 见证数据：input的解锁脚本
+type TXWitness struct {
+	ScriptSign []byte //付款人对交易的签名
+	PubKey     []byte //付款人的公钥
+}
+
+//见证序列化格式：去除见证数据的交易 + 按input顺序排列的见证数据
+type witnessTransaction struct {
+	Stripped  *Transaction
+	Witnesses []TXWitness
+}
+
+//创建一个去除见证数据的交易副本（挖矿交易的input没有签名，其数据保留）
+func (tx *Transaction) stripped() *Transaction {
+	isCoinbase := tx.isCoinBaseTX()
+	var inputs []TXInput
+	for _, input := range tx.TXInputs {
+		if !isCoinbase {
+			input.ScriptSign = nil
+			input.PubKey = nil
+		}
+		inputs = append(inputs, input)
+	}
+	txCopy := Transaction{nil, inputs, tx.TXOutputs, tx.TimeStamp, tx.LockTime, tx.Version}
+	return &txCopy
+}
+
+//Witnesses 获取交易所有input的见证数据
+func (tx *Transaction) Witnesses() []TXWitness {
+	var witnesses []TXWitness
+	for _, input := range tx.TXInputs {
+		witnesses = append(witnesses, TXWitness{input.ScriptSign, input.PubKey})
+	}
+	return witnesses
+}
+
+//WTXID 计算包含见证数据的交易哈希
+func (tx *Transaction) WTXID() []byte {
+	hash := sha256.Sum256(tx.SerializeWitness())
+	return hash[:]
+}
+
+//SerializeWitness 见证序列化：见证数据与交易分开存放
+func (tx *Transaction) SerializeWitness() []byte {
+	wtx := witnessTransaction{tx.stripped(), tx.Witnesses()}
+	wtx.Stripped.TXID = tx.TXID
+
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(&wtx)
+	if err != nil {
+		return nil
+	}
+	return buffer.Bytes()
+}
+
+//DeserializeWitness 将见证序列化的字节流还原为交易
+func DeserializeWitness(data []byte) (*Transaction, error) {
+	var wtx witnessTransaction
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&wtx)
+	if err != nil {
+		return nil, err
+	}
+	if wtx.Stripped == nil || len(wtx.Witnesses) != len(wtx.Stripped.TXInputs) {
+		return nil, errors.New("见证数据与input个数不一致")
+	}
+
+	//将见证数据填回input
+	tx := wtx.Stripped
+	if !tx.isCoinBaseTX() {
+		for i, witness := range wtx.Witnesses {
+			tx.TXInputs[i].ScriptSign = witness.ScriptSign
+			tx.TXInputs[i].PubKey = witness.PubKey
+		}
+	}
+	return tx, nil
+}
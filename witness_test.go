@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+//只修改见证数据时交易ID不变，WTXID随之变化
+func TestTXIDIgnoresWitness(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	txid := tx.TXID
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.TXID, txid) {
+		t.Fatalf("签名后交易ID变化: %x -> %x", txid, tx.TXID)
+	}
+	wtxid := tx.WTXID()
+
+	//改变签名的编码（追加一个字节）
+	tx.TXInputs[0].ScriptSign = append(append([]byte{}, tx.TXInputs[0].ScriptSign...), 0x00)
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.TXID, txid) {
+		t.Fatalf("修改见证数据后交易ID变化: %x -> %x", txid, tx.TXID)
+	}
+	if bytes.Equal(tx.WTXID(), wtxid) {
+		t.Fatal("修改见证数据后WTXID应变化")
+	}
+
+	//修改交易内容时交易ID变化
+	tx.TXOutputs[0].Value--
+	if err := tx.setHash(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tx.TXID, txid) {
+		t.Fatal("修改output后交易ID应变化")
+	}
+}
+
+func TestSerializeWitnessRoundTrip(t *testing.T) {
+	priKey := testPrivateKey(t, rfc6979P256Key)
+	tx, prevTXs := newFixedTestTX(priKey)
+	if !tx.Sign(priKey, prevTXs, SigHashAll) {
+		t.Fatal("交易签名失败")
+	}
+
+	decoded, err := DeserializeWitness(tx.SerializeWitness())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.TXID, tx.TXID) || !bytes.Equal(decoded.WTXID(), tx.WTXID()) {
+		t.Fatal("见证反序列化后交易ID或WTXID不一致")
+	}
+	if !bytes.Equal(decoded.TXInputs[0].ScriptSign, tx.TXInputs[0].ScriptSign) ||
+		!bytes.Equal(decoded.TXInputs[0].PubKey, tx.TXInputs[0].PubKey) {
+		t.Fatal("见证数据未还原到input")
+	}
+	if !decoded.Verify(prevTXs) {
+		t.Fatal("还原后的交易应通过校验")
+	}
+
+	//见证数据个数与input不一致
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&witnessTransaction{tx.stripped(), nil}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeserializeWitness(buffer.Bytes()); err == nil {
+		t.Fatal("缺少见证数据时应返回错误")
+	}
+}